@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// addFlags are the settings for adding torrents. They are accepted before any
+// command, which is the `magnet2torrent [flags] <magnet>` form the registered
+// handler uses, and after `add`.
+type addFlags struct {
+	wait           bool
+	waitTimeout    time.Duration
+	untilComplete  bool
+	stallTimeout   time.Duration
+	category       string
+	createCategory bool
+	tags           string
+	savePath       string
+	paused         bool
+	contentLayout  string
+	skipChecking   bool
+	rename         string
+	onDuplicate    string
+	fromFile       string
+	concurrency    int
+	output         string
+}
+
+func defaultAddFlags() addFlags {
+	return addFlags{
+		waitTimeout:  2 * time.Minute,
+		stallTimeout: 10 * time.Minute,
+		concurrency:  4,
+		output:       outputText,
+	}
+}
+
+// globalAddFlags holds the values given before the command name; `add` starts
+// from them so `magnet2torrent -category linux add <magnet>` works as well.
+var globalAddFlags = defaultAddFlags()
+
+// register defines the add flags on fs, defaulting to the current values.
+func (f *addFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.wait, "wait", f.wait, "after adding, wait until qBittorrent has fetched the metadata and print the torrent name")
+	fs.DurationVar(&f.waitTimeout, "wait-timeout", f.waitTimeout, "how long -wait waits for metadata")
+	fs.BoolVar(&f.untilComplete, "until-complete", f.untilComplete, "after adding, follow download progress until the torrent completes")
+	fs.DurationVar(&f.stallTimeout, "stall-timeout", f.stallTimeout, "with -until-complete, give up when progress has not moved for this long (0 disables)")
+	fs.StringVar(&f.category, "category", f.category, "category for the added torrent")
+	fs.BoolVar(&f.createCategory, "create-category", f.createCategory, "create -category on the server if it does not exist (see autoCreateCategory)")
+	fs.StringVar(&f.tags, "tags", f.tags, "comma-separated tags for the added torrent")
+	fs.StringVar(&f.savePath, "save-path", f.savePath, "download directory for the added torrent")
+	fs.BoolVar(&f.paused, "paused", f.paused, "add the torrent stopped (paused)")
+	fs.StringVar(&f.contentLayout, "content-layout", f.contentLayout, "content layout: Original, Subfolder or NoSubfolder")
+	fs.BoolVar(&f.skipChecking, "skip-checking", f.skipChecking, "skip hash checking of existing data")
+	fs.StringVar(&f.rename, "rename", f.rename, "rename the added torrent")
+	fs.StringVar(&f.onDuplicate, "on-duplicate", f.onDuplicate, "when the torrent is already on the server: skip, merge (add new trackers) or force (re-add); default duplicatePolicy or skip")
+	fs.StringVar(&f.fromFile, "from-file", f.fromFile, "read magnet links or .torrent paths from this file, one per line")
+	fs.IntVar(&f.concurrency, "concurrency", f.concurrency, "how many inputs to add in parallel")
+	fs.StringVar(&f.output, "output", f.output, "output mode: text, json (one result object per input on stdout) or quiet (exit code only)")
+}
+
+// options converts the flags into addOptions, filling gaps from cfg.
+func (f addFlags) options(cfg *config.Config, watch watchOptions) addOptions {
+	opts := addOptions{wait: f.wait, waitTimeout: f.waitTimeout, untilComplete: f.untilComplete, watch: watch}
+	opts.watch.stallAfter = f.stallTimeout
+	opts.createCategory = f.createCategory || cfg.AutoCreateCategory
+	opts.duplicates = f.onDuplicate
+	if opts.duplicates == "" {
+		opts.duplicates = cfg.DuplicatePolicy
+	}
+	opts.add = qbclient.AddOptions{
+		Category:      f.category,
+		Tags:          splitList(f.tags),
+		SavePath:      f.savePath,
+		Stopped:       f.paused,
+		ContentLayout: f.contentLayout,
+		SkipChecking:  f.skipChecking,
+		Rename:        f.rename,
+	}
+	return opts
+}
+
+func runAdd(args []string, cfg *config.Config, logger *logging.Logger) error {
+	f := globalAddFlags
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	f.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: magnet2torrent add [flags] <magnet|url|file.torrent|-> ...\n\nAdd magnet links, URLs or .torrent files; \"-\" reads one per line from stdin.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 && f.fromFile == "" {
+		return usageErrorf("usage: magnet2torrent add [flags] <magnet|url|file.torrent|-> ...")
+	}
+
+	results, err := addInputs(fs.Args(), f, cfg, logger)
+	if err != nil {
+		return err
+	}
+	if len(results) == 1 {
+		return results[0].err
+	}
+	if failed := summarize(results, logger); failed > 0 {
+		return &batchError{results: results, failed: failed}
+	}
+	return nil
+}
+
+// addInputs gathers the inputs named by args and f, adds them and writes the
+// JSON results when asked to. Per-input failures are left in the results.
+func addInputs(args []string, f addFlags, cfg *config.Config, logger *logging.Logger) ([]addResult, error) {
+	watch := defaultWatchOptions()
+	if err := applyOutputMode(f.output, logger, &watch); err != nil {
+		return nil, err
+	}
+	inputs, err := gatherInputs(args, f.fromFile, os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+
+	results := processInputs(inputs, cfg, logger, f.options(cfg, watch), f.concurrency)
+	if f.output == outputJSON {
+		if err := writeResultsJSON(os.Stdout, results); err != nil {
+			logger.Errorf("write results: %v", err)
+		}
+	}
+	return results, nil
+}
+
+// batchError reports a batch with failed inputs; its exit code follows
+// batchExitCode.
+type batchError struct {
+	results []addResult
+	failed  int
+}
+
+func (e *batchError) Error() string {
+	return fmt.Sprintf("%d of %d inputs failed", e.failed, len(e.results))
+}
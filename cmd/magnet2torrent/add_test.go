@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/logging"
+)
+
+func TestRunAddStartsFromGlobalFlags(t *testing.T) {
+	stub := &stubQBClient{}
+	useStubClient(t, stub)
+	orig := globalAddFlags
+	t.Cleanup(func() { globalAddFlags = orig })
+	globalAddFlags.category = "linux"
+	globalAddFlags.tags = "iso"
+
+	logger := logging.NewLogger("error", "")
+	magnet := "magnet:?xt=urn:btih:" + testHash
+	if err := runAdd([]string{"-tags", "weekly", "-paused", magnet}, testConfig(), logger); err != nil {
+		t.Fatalf("runAdd error: %v", err)
+	}
+	if stub.lastMagnet != magnet {
+		t.Fatalf("magnet = %q", stub.lastMagnet)
+	}
+	opts := stub.lastAddOpts
+	if opts.Category != "linux" || strings.Join(opts.Tags, ",") != "weekly" || !opts.Stopped {
+		t.Fatalf("add options = %+v", opts)
+	}
+
+	if err := runAdd(nil, testConfig(), logger); exitCode(err) != exitUsage {
+		t.Fatalf("runAdd without inputs = %v, want usage error", err)
+	}
+}
+
+func TestRunAddBatchErrorExitCode(t *testing.T) {
+	stub := &stubQBClient{addErr: errors.New("boom")}
+	useStubClient(t, stub)
+
+	err := runAdd([]string{"magnet:?xt=urn:btih:" + testHash, "magnet:?xt=urn:btih:" + strings.Repeat("b", 40)}, testConfig(), logging.NewLogger("error", ""))
+	if err == nil || err.Error() != "2 of 2 inputs failed" {
+		t.Fatalf("runAdd error = %v", err)
+	}
+	if exitCode(err) != exitError {
+		t.Fatalf("exitCode = %d, want %d", exitCode(err), exitError)
+	}
+}
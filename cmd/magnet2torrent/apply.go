@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+)
+
+// desiredState is the apply file format: the categories, tags and
+// preferences a server should have.
+type desiredState struct {
+	Categories  map[string]desiredCategory `json:"categories"`
+	Tags        []string                   `json:"tags"`
+	Preferences map[string]any             `json:"preferences"`
+}
+
+type desiredCategory struct {
+	SavePath string `json:"savePath"`
+}
+
+// planStep is one change needed to reach the desired state.
+type planStep struct {
+	// op is "+" (create), "~" (change) or "-" (remove).
+	op          string
+	description string
+	apply       func(qb qbClient) error
+}
+
+func runApply(args []string, cfg *config.Config, logger *logging.Logger) error {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	var (
+		file    = fs.String("f", "", "desired-state JSON file (- for stdin)")
+		dryRun  = fs.Bool("dry-run", false, "print the plan without changing anything")
+		prune   = fs.Bool("prune", false, "also remove categories and tags missing from the file's categories and tags")
+		yes     = fs.Bool("yes", false, "do not ask before removing anything")
+		servers = fs.String("servers", "", "comma-separated server profiles to apply to (default: the selected server)")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return usageErrorf("usage: magnet2torrent apply -f state.json [-dry-run] [-prune [-yes]] [-servers a,b]")
+	}
+
+	desired, err := loadDesiredState(*file)
+	if err != nil {
+		return err
+	}
+
+	targets := splitList(*servers)
+	if len(targets) == 0 {
+		targets = []string{cfg.DefaultServer}
+	}
+
+	var failed int
+	for _, name := range targets {
+		if err := applyToServer(name, desired, *prune, *dryRun, *yes, cfg, logger); err != nil {
+			logger.Errorf("apply: %v", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d server(s) failed", failed, len(targets))
+	}
+	return nil
+}
+
+func applyToServer(name string, desired *desiredState, prune, dryRun, yes bool, cfg *config.Config, logger *logging.Logger) error {
+	qb, srv, err := connectServer(cfg, name, logger)
+	if err != nil {
+		return err
+	}
+
+	plan, err := buildPlan(qb, desired, prune)
+	if err != nil {
+		return fmt.Errorf("server %s: %w", srv.Name, err)
+	}
+
+	printPlan(os.Stdout, srv.Name, plan)
+	if dryRun || len(plan) == 0 {
+		return nil
+	}
+	if removals := countRemovals(plan); removals > 0 && !yes {
+		// Deleting a tag also strips it from every torrent.
+		ok, err := confirmFunc(fmt.Sprintf("Remove %d categories and tags from server %s?", removals, srv.Name))
+		if err != nil {
+			return fmt.Errorf("server %s: %w", srv.Name, err)
+		}
+		if !ok {
+			return fmt.Errorf("server %s: aborted", srv.Name)
+		}
+	}
+
+	for _, step := range plan {
+		if err := step.apply(qb); err != nil {
+			return fmt.Errorf("server %s: %s: %w", srv.Name, step.description, err)
+		}
+	}
+	logger.Infof("server %s: applied %d change(s)", srv.Name, len(plan))
+	return nil
+}
+
+func countRemovals(plan []planStep) int {
+	n := 0
+	for _, step := range plan {
+		if step.op == "-" {
+			n++
+		}
+	}
+	return n
+}
+
+func loadDesiredState(path string) (*desiredState, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path) // #nosec G304 - user-provided path is expected.
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state %s: %w", path, err)
+	}
+
+	var state desiredState
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&state); err != nil {
+		return nil, fmt.Errorf("parse state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// buildPlan diffs the server against desired. Categories and tags missing
+// from desired are only removed when prune is set, and only for the sections
+// the file declares: a file without "tags" leaves every tag alone.
+// Preferences not listed are left alone.
+func buildPlan(qb qbClient, desired *desiredState, prune bool) ([]planStep, error) {
+	var plan []planStep
+
+	if desired.Categories != nil {
+		actual, err := qb.Categories()
+		if err != nil {
+			return nil, fmt.Errorf("list categories: %w", err)
+		}
+		for _, name := range sortedKeys(desired.Categories) {
+			name, want := name, desired.Categories[name]
+			have, ok := actual[name]
+			switch {
+			case !ok:
+				plan = append(plan, planStep{"+", fmt.Sprintf("category %s (save path %q)", name, want.SavePath),
+					func(qb qbClient) error { return qb.CreateCategory(name, want.SavePath) }})
+			case have.SavePath != want.SavePath:
+				plan = append(plan, planStep{"~", fmt.Sprintf("category %s save path %q -> %q", name, have.SavePath, want.SavePath),
+					func(qb qbClient) error { return qb.EditCategory(name, want.SavePath) }})
+			}
+		}
+		if prune {
+			var extra []string
+			for _, name := range sortedKeys(actual) {
+				if _, ok := desired.Categories[name]; !ok {
+					extra = append(extra, name)
+				}
+			}
+			for _, name := range extra {
+				name := name
+				plan = append(plan, planStep{"-", "category " + name,
+					func(qb qbClient) error { return qb.RemoveCategories([]string{name}) }})
+			}
+		}
+	}
+
+	if desired.Tags != nil {
+		actual, err := qb.Tags()
+		if err != nil {
+			return nil, fmt.Errorf("list tags: %w", err)
+		}
+		have := map[string]bool{}
+		for _, tag := range actual {
+			have[tag] = true
+		}
+		want := map[string]bool{}
+		for _, tag := range desired.Tags {
+			want[tag] = true
+			if !have[tag] {
+				tag := tag
+				plan = append(plan, planStep{"+", "tag " + tag,
+					func(qb qbClient) error { return qb.CreateTags([]string{tag}) }})
+			}
+		}
+		if prune {
+			sort.Strings(actual)
+			for _, tag := range actual {
+				if !want[tag] {
+					tag := tag
+					plan = append(plan, planStep{"-", "tag " + tag,
+						func(qb qbClient) error { return qb.DeleteTags([]string{tag}) }})
+				}
+			}
+		}
+	}
+
+	if len(desired.Preferences) > 0 {
+		actual, err := qb.Preferences()
+		if err != nil {
+			return nil, fmt.Errorf("read preferences: %w", err)
+		}
+		// All preference changes go out in one setPreferences call, made by
+		// whichever of their steps runs first.
+		changes := map[string]any{}
+		sent := false
+		applyPrefs := func(qb qbClient) error {
+			if sent {
+				return nil
+			}
+			sent = true
+			return qb.SetPreferences(changes)
+		}
+		for _, key := range sortedKeys(desired.Preferences) {
+			if writeOnlyPreferences[key] {
+				return nil, fmt.Errorf("preference %q cannot be read back, so apply cannot keep it in sync; set it in qBittorrent instead", key)
+			}
+			have, ok := actual[key]
+			if !ok {
+				return nil, fmt.Errorf("unknown preference %q", key)
+			}
+			want := desired.Preferences[key]
+			if sameJSON(have, want) {
+				continue
+			}
+			changes[key] = want
+			description := fmt.Sprintf("preference %s %s -> %s", key, jsonString(have), jsonString(want))
+			if secretPreference(key) {
+				description = fmt.Sprintf("preference %s changed", key)
+			}
+			plan = append(plan, planStep{"~", description, applyPrefs})
+		}
+	}
+
+	return plan, nil
+}
+
+// writeOnlyPreferences are accepted by setPreferences but never returned by
+// /api/v2/app/preferences.
+var writeOnlyPreferences = map[string]bool{"web_ui_password": true}
+
+// secretPreference reports whether a preference holds a password or key,
+// whose values the plan must not show.
+func secretPreference(key string) bool {
+	for _, word := range []string{"password", "secret", "token", "api_key"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func printPlan(w io.Writer, server string, plan []planStep) {
+	if len(plan) == 0 {
+		fmt.Fprintf(w, "server %s: up to date\n", server)
+		return
+	}
+	fmt.Fprintf(w, "server %s: %d change(s)\n", server, len(plan))
+	for _, step := range plan {
+		fmt.Fprintf(w, "  %s %s\n", step.op, step.description)
+	}
+}
+
+// sameJSON compares two values as they would appear in JSON, so 3 and 3.0
+// are equal.
+func sameJSON(a, b any) bool {
+	var na, nb any
+	if json.Unmarshal([]byte(jsonString(a)), &na) != nil || json.Unmarshal([]byte(jsonString(b)), &nb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(na, nb)
+}
+
+func jsonString(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
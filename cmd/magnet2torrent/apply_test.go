@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func applyStub() *stubQBClient {
+	return &stubQBClient{
+		categories: map[string]qbclient.Category{
+			"linux": {Name: "linux", SavePath: "/old"},
+			"stale": {Name: "stale"},
+		},
+		tags:  []string{"keep", "junk"},
+		prefs: map[string]any{"max_active_downloads": float64(5), "dht": true},
+	}
+}
+
+func writeState(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	return path
+}
+
+const testState = `{
+  "categories": {"linux": {"savePath": "/data/iso"}, "tv": {"savePath": "/data/tv"}},
+  "tags": ["keep", "archive"],
+  "preferences": {"max_active_downloads": 3, "dht": true}
+}`
+
+func TestBuildPlan(t *testing.T) {
+	stub := applyStub()
+	desired, err := loadDesiredState(writeState(t, testState))
+	if err != nil {
+		t.Fatalf("loadDesiredState error: %v", err)
+	}
+
+	plan, err := buildPlan(stub, desired, true)
+	if err != nil {
+		t.Fatalf("buildPlan error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	printPlan(&buf, "home", plan)
+	// dht already matches, so it is not part of the plan.
+	want := `server home: 6 change(s)
+  ~ category linux save path "/old" -> "/data/iso"
+  + category tv (save path "/data/tv")
+  - category stale
+  + tag archive
+  - tag junk
+  ~ preference max_active_downloads 5 -> 3
+`
+	if buf.String() != want {
+		t.Fatalf("plan mismatch:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestRunApplyDryRunAndApply(t *testing.T) {
+	stub := applyStub()
+	useStubClient(t, stub)
+	logger := logging.NewLogger("error", "")
+	path := writeState(t, testState)
+
+	if err := runApply([]string{"-f", path, "-dry-run"}, testConfig(), logger); err != nil {
+		t.Fatalf("dry run error: %v", err)
+	}
+	if len(stub.calls) != 0 {
+		t.Fatalf("dry run should not change anything, got %v", stub.calls)
+	}
+
+	if err := runApply([]string{"-f", path}, testConfig(), logger); err != nil {
+		t.Fatalf("apply error: %v", err)
+	}
+	want := "edit-category linux,create-category tv,create-tags archive,set-preferences max_active_downloads"
+	if got := strings.Join(stub.calls, ","); got != want {
+		t.Fatalf("calls = %s\nwant    %s", got, want)
+	}
+
+	plan, err := buildPlan(stub, mustLoadState(t, path), false)
+	if err != nil || len(plan) != 0 {
+		t.Fatalf("expected no changes after apply, got %d (%v)", len(plan), err)
+	}
+}
+
+func TestApplyPruneOnlyDeclaredSections(t *testing.T) {
+	stub := applyStub()
+	useStubClient(t, stub)
+	logger := logging.NewLogger("error", "")
+	path := writeState(t, `{"categories": {"linux": {"savePath": "/old"}}}`)
+
+	plan, err := buildPlan(stub, mustLoadState(t, path), true)
+	if err != nil || len(plan) != 1 || plan[0].description != "category stale" {
+		t.Fatalf("plan = %+v, %v", plan, err)
+	}
+
+	origConfirm := confirmFunc
+	t.Cleanup(func() { confirmFunc = origConfirm })
+	asked := false
+	confirmFunc = func(string) (bool, error) {
+		asked = true
+		return false, nil
+	}
+	if err := runApply([]string{"-f", path, "-prune"}, testConfig(), logger); err == nil || !asked || len(stub.calls) != 0 {
+		t.Fatalf("declined prune: err %v, asked %t, calls %v", err, asked, stub.calls)
+	}
+
+	confirmFunc = func(string) (bool, error) {
+		t.Fatalf("-yes should skip confirmation")
+		return false, nil
+	}
+	if err := runApply([]string{"-f", path, "-prune", "-yes"}, testConfig(), logger); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(stub.calls, ","); got != "remove-categories stale" {
+		t.Fatalf("calls = %s", got)
+	}
+}
+
+func TestApplyRejectsUnknownKeys(t *testing.T) {
+	if _, err := loadDesiredState(writeState(t, `{"categorys": {}}`)); err == nil {
+		t.Fatalf("expected error for unknown field")
+	}
+
+	desired := mustLoadState(t, writeState(t, `{"preferences": {"no_such_pref": 1}}`))
+	if _, err := buildPlan(applyStub(), desired, false); err == nil || !strings.Contains(err.Error(), "unknown preference") {
+		t.Fatalf("expected unknown preference error, got %v", err)
+	}
+}
+
+func TestApplyHidesSecretPreferences(t *testing.T) {
+	stub := applyStub()
+	stub.prefs["proxy_password"] = "old-secret"
+	desired := mustLoadState(t, writeState(t, `{"preferences": {"proxy_password": "new-secret"}}`))
+	plan, err := buildPlan(stub, desired, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	printPlan(&buf, "default", plan)
+	if out := buf.String(); strings.Contains(out, "secret") || !strings.Contains(out, "preference proxy_password changed") {
+		t.Fatalf("plan:\n%s", out)
+	}
+
+	desired = mustLoadState(t, writeState(t, `{"preferences": {"web_ui_password": "hunter2"}}`))
+	if _, err := buildPlan(stub, desired, false); err == nil || strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("write-only preference: %v", err)
+	}
+}
+
+func mustLoadState(t *testing.T, path string) *desiredState {
+	t.Helper()
+	state, err := loadDesiredState(path)
+	if err != nil {
+		t.Fatalf("loadDesiredState error: %v", err)
+	}
+	return state
+}
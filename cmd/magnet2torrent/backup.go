@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"magnet2torrent/internal/backup"
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func runBackup(args []string, cfg *config.Config, logger *logging.Logger) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	var (
+		output   = fs.String("o", "", "archive to write (.tar.gz, - for stdout)")
+		category = fs.String("category", "", "only back up torrents in this category")
+		tag      = fs.String("tag", "", "only back up torrents with this tag")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("magnet2torrent-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	}
+
+	qb, srv, err := connect(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	var (
+		out io.Writer = os.Stdout
+		f   *os.File
+	)
+	if *output != "-" {
+		f, err = os.OpenFile(*output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("create backup: %w", err)
+		}
+		out = f
+	}
+
+	n, err := writeBackup(out, qb, srv.Name, qbclient.ListOptions{Category: *category, Tag: *tag}, logger)
+	if f != nil {
+		// The archive is only complete once its last block is written.
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("write backup: %w", closeErr)
+		}
+		if err != nil {
+			_ = os.Remove(*output)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	logger.Infof("backed up %d torrent(s) from %s to %s", n, srv.Name, *output)
+	return nil
+}
+
+// writeBackup exports every selected torrent and its settings into an archive.
+// Torrents without metadata are recorded by magnet URI.
+func writeBackup(out io.Writer, qb qbClient, server string, filter qbclient.ListOptions, logger *logging.Logger) (int, error) {
+	torrents, err := qb.Torrents(filter)
+	if err != nil {
+		return 0, fmt.Errorf("list torrents: %w", err)
+	}
+	categories, err := qb.Categories()
+	if err != nil {
+		return 0, fmt.Errorf("list categories: %w", err)
+	}
+
+	manifest := &backup.Manifest{CreatedAt: time.Now().UTC(), Server: server, Categories: map[string]backup.Category{}}
+	if caps, err := qb.Capabilities(); err == nil {
+		manifest.AppVersion = caps.AppVersion
+	}
+
+	w := backup.NewWriter(out)
+	for _, t := range torrents {
+		entry := entryFromTorrent(t)
+		if t.IsMetadataPending() {
+			logger.Warnf("%s has no metadata yet; recording its magnet link", t.Name)
+		} else {
+			data, err := qb.ExportTorrent(t.Hash)
+			if err != nil {
+				return 0, fmt.Errorf("export %s: %w", t.Name, err)
+			}
+			entry.File = backup.TorrentPath(t.Hash)
+			entry.MagnetURI = ""
+			if err := w.AddFile(entry.File, data); err != nil {
+				return 0, err
+			}
+		}
+		if c, ok := categories[t.Category]; ok {
+			manifest.Categories[t.Category] = backup.Category{SavePath: c.SavePath}
+		}
+		manifest.Torrents = append(manifest.Torrents, entry)
+	}
+
+	if err := w.Close(manifest); err != nil {
+		return 0, fmt.Errorf("finish backup: %w", err)
+	}
+	return len(manifest.Torrents), nil
+}
+
+func entryFromTorrent(t qbclient.Torrent) backup.Entry {
+	e := backup.Entry{
+		Hash:             t.Hash,
+		Name:             t.Name,
+		MagnetURI:        t.MagnetURI,
+		SavePath:         t.SavePath,
+		Category:         t.Category,
+		Tags:             t.TagList(),
+		Stopped:          t.IsStopped(),
+		RatioLimit:       t.RatioLimit,
+		SeedingTimeLimit: t.SeedingTimeLimit,
+	}
+	if t.UpLimit > 0 {
+		e.UpLimit = t.UpLimit
+	}
+	if t.DlLimit > 0 {
+		e.DlLimit = t.DlLimit
+	}
+	return e
+}
+
+func addOptionsFromEntry(e backup.Entry) qbclient.AddOptions {
+	ratio, seeding := e.RatioLimit, e.SeedingTimeLimit
+	return qbclient.AddOptions{
+		Category:         e.Category,
+		Tags:             e.Tags,
+		SavePath:         e.SavePath,
+		Stopped:          e.Stopped,
+		UpLimit:          e.UpLimit,
+		DlLimit:          e.DlLimit,
+		RatioLimit:       &ratio,
+		SeedingTimeLimit: &seeding,
+	}
+}
+
+// restoreOptions tune how archive entries are re-added.
+type restoreOptions struct {
+	skipChecking bool
+	dryRun       bool
+	// mapPath rewrites save paths for the target server; nil keeps them.
+	mapPath func(string) string
+}
+
+// restoreResult counts what a restore did.
+type restoreResult struct {
+	added, skipped, failed int
+}
+
+func runRestore(args []string, cfg *config.Config, logger *logging.Logger) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	var (
+		input = fs.String("i", "", "archive to read (- for stdin)")
+		opts  restoreOptions
+	)
+	fs.BoolVar(&opts.skipChecking, "skip-checking", false, "skip hash checking; use when data is already in place")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "show what would be restored")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return usageErrorf("usage: magnet2torrent restore -i backup.tar.gz [-skip-checking] [-dry-run]")
+	}
+
+	var in io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input) // #nosec G304 - user-provided path is expected.
+		if err != nil {
+			return fmt.Errorf("open backup: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	archive, err := backup.Read(in)
+	if err != nil {
+		return err
+	}
+
+	qb, srv, err := connect(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	res, err := restoreArchive(qb, archive, opts, logger)
+	if err != nil {
+		return err
+	}
+	logger.Infof("restore to %s: %d added, %d already present, %d failed", srv.Name, res.added, res.skipped, res.failed)
+	if res.failed > 0 {
+		return fmt.Errorf("%d torrent(s) failed to restore", res.failed)
+	}
+	return nil
+}
+
+// restoreArchive re-adds archive entries that the server does not have yet,
+// creating their categories first.
+func restoreArchive(qb qbClient, archive *backup.Archive, opts restoreOptions, logger *logging.Logger) (restoreResult, error) {
+	var res restoreResult
+
+	existing, err := qb.Torrents(qbclient.ListOptions{})
+	if err != nil {
+		return res, fmt.Errorf("list torrents: %w", err)
+	}
+	present := map[string]bool{}
+	for _, t := range existing {
+		present[t.Hash] = true
+	}
+
+	categories, err := qb.Categories()
+	if err != nil {
+		return res, fmt.Errorf("list categories: %w", err)
+	}
+
+	for _, e := range archive.Manifest.Torrents {
+		if present[e.Hash] {
+			logger.Infof("skip %s: already present", e.Name)
+			res.skipped++
+			continue
+		}
+		if opts.dryRun {
+			logger.Infof("would restore %s to %s", e.Name, e.SavePath)
+			res.added++
+			continue
+		}
+
+		savePath := archive.Manifest.Categories[e.Category].SavePath
+		if opts.mapPath != nil {
+			savePath = opts.mapPath(savePath)
+		}
+		if err := ensureCategoryPath(qb, categories, e.Category, savePath, logger); err != nil {
+			return res, err
+		}
+
+		if err := restoreEntry(qb, archive, e, opts); err != nil {
+			logger.Errorf("restore %s: %v", e.Name, err)
+			res.failed++
+			continue
+		}
+		logger.Infof("restored %s", e.Name)
+		res.added++
+	}
+	return res, nil
+}
+
+func restoreEntry(qb qbClient, archive *backup.Archive, e backup.Entry, opts restoreOptions) error {
+	addOpts := addOptionsFromEntry(e)
+	addOpts.SkipChecking = opts.skipChecking
+	if opts.mapPath != nil {
+		addOpts.SavePath = opts.mapPath(addOpts.SavePath)
+	}
+
+	if e.File != "" {
+		return qb.AddTorrentFile(e.Hash+".torrent", archive.Files[e.File], addOpts)
+	}
+	if e.MagnetURI == "" {
+		return errors.New("entry has neither a torrent file nor a magnet link")
+	}
+	return qb.AddMagnetWithOptions(e.MagnetURI, addOpts)
+}
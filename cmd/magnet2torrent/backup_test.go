@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/backup"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	logger := logging.NewLogger("error", "")
+	source := &stubQBClient{
+		torrents: []qbclient.Torrent{
+			{Hash: "aaa", Name: "debian", State: "stoppedUP", SavePath: "/data/iso", Category: "linux", Tags: "keep, iso", RatioLimit: 2, SeedingTimeLimit: -2, UpLimit: -1},
+			{Hash: "bbb", Name: "pending", State: "metaDL", MagnetURI: "magnet:?xt=urn:btih:bbb", SavePath: "/data"},
+		},
+		categories: map[string]qbclient.Category{"linux": {Name: "linux", SavePath: "/data/iso"}},
+		exports:    map[string][]byte{"aaa": []byte("d4:infoe")},
+	}
+
+	var buf bytes.Buffer
+	n, err := writeBackup(&buf, source, "home", qbclient.ListOptions{}, logger)
+	if err != nil || n != 2 {
+		t.Fatalf("writeBackup() = %d, %v", n, err)
+	}
+	archive, err := backup.Read(&buf)
+	if err != nil {
+		t.Fatalf("backup.Read error: %v", err)
+	}
+	first := archive.Manifest.Torrents[0]
+	if first.File != backup.TorrentPath("aaa") || first.MagnetURI != "" || !first.Stopped || first.UpLimit != 0 || len(first.Tags) != 2 {
+		t.Fatalf("unexpected entry: %+v", first)
+	}
+
+	target := &stubQBClient{torrents: []qbclient.Torrent{{Hash: "bbb", Name: "pending"}}}
+	opts := restoreOptions{skipChecking: true, mapPath: func(p string) string { return strings.Replace(p, "/data", "/mnt", 1) }}
+	res, err := restoreArchive(target, archive, opts, logger)
+	if err != nil {
+		t.Fatalf("restoreArchive error: %v", err)
+	}
+	if res.added != 1 || res.skipped != 1 || res.failed != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if target.categories["linux"].SavePath != "/mnt/iso" {
+		t.Fatalf("category not recreated with mapped path: %+v", target.categories)
+	}
+	if len(target.added) != 1 {
+		t.Fatalf("expected one torrent file add, got %+v", target.added)
+	}
+	got := target.added[0].opts
+	if got.SavePath != "/mnt/iso" || !got.Stopped || !got.SkipChecking || got.RatioLimit == nil || *got.RatioLimit != 2 || *got.SeedingTimeLimit != -2 {
+		t.Fatalf("unexpected add options: %+v", got)
+	}
+}
+
+func TestRestoreDryRun(t *testing.T) {
+	archive := &backup.Archive{Manifest: backup.Manifest{Torrents: []backup.Entry{{Hash: "aaa", Name: "debian", MagnetURI: "magnet:?xt=urn:btih:aaa"}}}}
+	target := &stubQBClient{}
+	res, err := restoreArchive(target, archive, restoreOptions{dryRun: true}, logging.NewLogger("error", ""))
+	if err != nil || res.added != 1 {
+		t.Fatalf("restoreArchive() = %+v, %v", res, err)
+	}
+	if target.lastMagnet != "" || len(target.added) != 0 || len(target.calls) != 0 {
+		t.Fatalf("dry run changed the server: %+v", target)
+	}
+}
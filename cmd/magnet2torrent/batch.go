@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/history"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/magnet"
+	"magnet2torrent/internal/metainfo"
+)
+
+// Sources recorded in history.
+const (
+	sourceCLI    = "cli"
+	sourceStdin  = "stdin"
+	sourceFile   = "file"
+	sourceResend = "resend"
+	sourceServe  = "serve"
+)
+
+// batchInput is one magnet link, URL or .torrent path and where it came from.
+type batchInput struct {
+	value  string
+	source string
+}
+
+// addItem is an input resolved into something qBittorrent can add.
+type addItem struct {
+	batchInput
+	// link is the magnet or URL to send; file holds .torrent data instead.
+	link     string
+	file     []byte
+	hash     string
+	name     string
+	trackers []string
+}
+
+// addResult is the outcome of one input.
+type addResult struct {
+	input  string
+	hash   string
+	name   string
+	server string
+	// status is one of the history.Result* values.
+	status string
+	err    error
+}
+
+// gatherInputs collects the positional arguments, reading newline-separated
+// entries from stdin for "-" and from fromFile when set. Blank lines and
+// lines starting with # are skipped.
+func gatherInputs(args []string, fromFile string, stdin io.Reader) ([]batchInput, error) {
+	var inputs []batchInput
+	readStdin := false
+	for _, arg := range args {
+		if arg != "-" {
+			inputs = append(inputs, batchInput{value: arg, source: sourceCLI})
+			continue
+		}
+		if readStdin {
+			return nil, usageErrorf(`"-" given more than once`)
+		}
+		readStdin = true
+		lines, err := readInputLines(stdin)
+		if err != nil {
+			return nil, withCode(codeInput, fmt.Errorf("read stdin: %w", err))
+		}
+		for _, line := range lines {
+			inputs = append(inputs, batchInput{value: line, source: sourceStdin})
+		}
+	}
+
+	if fromFile != "" {
+		f, err := os.Open(fromFile) // #nosec G304 - user-provided path is expected.
+		if err != nil {
+			return nil, withCode(codeInput, fmt.Errorf("open input list: %w", err))
+		}
+		defer f.Close()
+		lines, err := readInputLines(f)
+		if err != nil {
+			return nil, withCode(codeInput, fmt.Errorf("read %s: %w", fromFile, err))
+		}
+		for _, line := range lines {
+			inputs = append(inputs, batchInput{value: line, source: sourceFile})
+		}
+	}
+	return inputs, nil
+}
+
+func readInputLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// isLink reports whether s is sent to qBittorrent as a URL rather than read
+// as a .torrent file.
+func isLink(s string) bool {
+	lower := strings.ToLower(s)
+	return strings.HasPrefix(lower, "magnet:") || strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// loadItem resolves in, reading .torrent files from disk.
+func loadItem(in batchInput, opts addOptions, logger *logging.Logger) (addItem, error) {
+	item := addItem{batchInput: in}
+	follow := opts.wait || opts.untilComplete
+
+	if isLink(in.value) {
+		item.link = in.value
+		parsed, err := magnet.Parse(in.value)
+		if err != nil {
+			if follow {
+				// Fail before adding when we could not follow the torrent afterwards.
+				return item, withCode(codeInput, fmt.Errorf("cannot follow torrent: %w", err))
+			}
+			logger.Debugf("cannot parse info-hash, skipping duplicate check: %v", err)
+			return item, nil
+		}
+		item.hash, item.name, item.trackers = parsed.InfoHash, parsed.Name, parsed.Trackers
+		return item, nil
+	}
+
+	data, err := os.ReadFile(in.value) // #nosec G304 - user-provided path is expected.
+	if err != nil {
+		return item, withCode(codeInput, fmt.Errorf("not a magnet link and not a readable .torrent file: %w", err))
+	}
+	info, err := metainfo.Parse(data)
+	if err != nil {
+		return item, withCode(codeInput, fmt.Errorf("%s: %w", in.value, err))
+	}
+	item.file = data
+	item.hash, item.name, item.trackers = info.InfoHash, info.Name, info.Trackers
+	return item, nil
+}
+
+// processInputs adds every input to the selected server over one login, with
+// at most concurrency adds in flight, and records each outcome in history.
+// Results are in input order.
+func processInputs(inputs []batchInput, cfg *config.Config, logger *logging.Logger, opts addOptions, concurrency int) []addResult {
+	results := make([]addResult, len(inputs))
+	items := make([]*addItem, len(inputs))
+
+	server := cfg.DefaultServer
+	if srv, err := cfg.Server(""); err == nil {
+		server = srv.Name
+	}
+	finish := func(i int, item addItem, status string, err error) {
+		if err != nil {
+			status = history.ResultFailed
+		}
+		results[i].status, results[i].err = status, err
+		entry := newHistoryEntry(item, results[i].server, opts)
+		entry.Result = status
+		recordHistory(cfg, entry, err, logger)
+	}
+
+	policyErr := validateDuplicatePolicy(opts.duplicates)
+	pending := 0
+	for i, in := range inputs {
+		item, err := loadItem(in, opts, logger)
+		results[i] = addResult{input: in.value, hash: item.hash, name: item.name, server: server}
+		if err == nil {
+			err = policyErr
+		}
+		if err != nil {
+			finish(i, item, "", err)
+			continue
+		}
+		items[i] = &item
+		pending++
+	}
+	if pending == 0 {
+		return results
+	}
+
+	qb, srv, connErr := connect(cfg, logger)
+	if opts.wait || opts.untilComplete || concurrency < 1 {
+		// Progress output of several torrents would interleave.
+		concurrency = 1
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+	for i, item := range items {
+		if item == nil {
+			continue
+		}
+		if connErr != nil {
+			finish(i, *item, "", connErr)
+			continue
+		}
+		results[i].server = srv.Name
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, item addItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			status, err := addToServer(qb, srv, item, cfg, logger, opts)
+			finish(i, item, status, err)
+		}(i, *item)
+	}
+	wg.Wait()
+	return results
+}
+
+// summarize counts results by status and logs a one-line report.
+func summarize(results []addResult, logger *logging.Logger) (failed int) {
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.status]++
+		if r.err != nil {
+			logger.Errorf("%s: %v", truncate(r.input, 80), r.err)
+		}
+	}
+	logger.Infof("processed %d: %d added, %d duplicate, %d merged, %d failed",
+		len(results), counts[history.ResultAdded], counts[history.ResultDuplicate], counts[history.ResultMerged], counts[history.ResultFailed])
+	return counts[history.ResultFailed]
+}
+
+// fileName is the name a .torrent input is uploaded under.
+func (it addItem) fileName() string {
+	return filepath.Base(it.value)
+}
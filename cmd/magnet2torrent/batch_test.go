@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/history"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func TestGatherInputs(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(list, []byte("# weekly\nmagnet:?xt=urn:btih:ccc\n\n  /tmp/d.torrent  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	inputs, err := gatherInputs([]string{"magnet:?xt=urn:btih:aaa", "-"}, list, strings.NewReader("magnet:?xt=urn:btih:bbb\n"))
+	if err != nil {
+		t.Fatalf("gatherInputs error: %v", err)
+	}
+	var got []string
+	for _, in := range inputs {
+		got = append(got, in.source+"="+in.value)
+	}
+	want := "cli=magnet:?xt=urn:btih:aaa,stdin=magnet:?xt=urn:btih:bbb,file=magnet:?xt=urn:btih:ccc,file=/tmp/d.torrent"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("inputs = %v", got)
+	}
+
+	if _, err := gatherInputs([]string{"-", "-"}, "", strings.NewReader("")); err == nil {
+		t.Fatalf("expected error for repeated -")
+	}
+}
+
+func TestProcessInputsBatch(t *testing.T) {
+	dir := t.TempDir()
+	torrentPath := filepath.Join(dir, "debian.torrent")
+	torrent := "d8:announce15:http://t.test/a4:infod6:lengthi1e4:name6:debian12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaaee"
+	if err := os.WriteFile(torrentPath, []byte(torrent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &stubQBClient{torrents: []qbclient.Torrent{{Hash: testHash, Name: "present"}}}
+	logins := 0
+	origFactory := qbClientFactory
+	t.Cleanup(func() { qbClientFactory = origFactory })
+	qbClientFactory = func(srv config.Server, logger *logging.Logger) (qbClient, error) {
+		logins++
+		return stub, nil
+	}
+
+	cfg := testConfig()
+	cfg.HistoryFile = filepath.Join(dir, "history.jsonl")
+	inputs := []batchInput{
+		{value: "magnet:?xt=urn:btih:" + testHash, source: sourceCLI},
+		{value: "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=new", source: sourceStdin},
+		{value: torrentPath, source: sourceFile},
+		{value: filepath.Join(dir, "missing.torrent"), source: sourceFile},
+	}
+	logger := logging.NewLogger("error", "")
+	results := processInputs(inputs, cfg, logger, addOptions{}, 1)
+
+	var statuses []string
+	for _, r := range results {
+		statuses = append(statuses, r.status)
+	}
+	if got := strings.Join(statuses, ","); got != "duplicate,added,added,failed" {
+		t.Fatalf("statuses = %s", got)
+	}
+	if logins != 1 {
+		t.Fatalf("expected a single shared login, got %d", logins)
+	}
+	if len(stub.added) != 1 || stub.added[0].name != "debian.torrent" || results[2].name != "debian" || len(results[2].hash) != 40 {
+		t.Fatalf("torrent file not added: %+v / %+v", stub.added, results[2])
+	}
+	if summarize(results, logger) != 1 {
+		t.Fatalf("expected one failure in summary")
+	}
+
+	entries, err := history.NewStore(cfg.HistoryFile).Load()
+	if err != nil || len(entries) != 4 {
+		t.Fatalf("history = %d entries, %v", len(entries), err)
+	}
+	for _, e := range entries {
+		if (e.Source == sourceFile) != (e.File != "" && e.Magnet == "") {
+			t.Fatalf("entry should record exactly one of magnet or file: %+v", e)
+		}
+	}
+}
+
+// countingStub tracks how many adds run at once.
+type countingStub struct {
+	*stubQBClient
+	mu       sync.Mutex
+	inFlight int
+	maxSeen  int
+}
+
+func (c *countingStub) Torrents(qbclient.ListOptions) ([]qbclient.Torrent, error) { return nil, nil }
+
+func (c *countingStub) AddMagnetWithOptions(string, qbclient.AddOptions) error {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxSeen {
+		c.maxSeen = c.inFlight
+	}
+	c.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+	return nil
+}
+
+func TestProcessInputsBoundsConcurrency(t *testing.T) {
+	stub := &countingStub{stubQBClient: &stubQBClient{}}
+	useStubClient(t, stub)
+
+	var inputs []batchInput
+	for i := 0; i < 8; i++ {
+		inputs = append(inputs, batchInput{value: "https://example.test/" + string(rune('a'+i)) + ".torrent", source: sourceCLI})
+	}
+	results := processInputs(inputs, testConfig(), logging.NewLogger("error", ""), addOptions{}, 2)
+	for _, r := range results {
+		if r.err != nil {
+			t.Fatalf("unexpected error: %v", r.err)
+		}
+	}
+	if stub.maxSeen < 1 || stub.maxSeen > 2 {
+		t.Fatalf("max concurrent adds = %d, want at most 2", stub.maxSeen)
+	}
+}
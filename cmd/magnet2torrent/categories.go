@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func runCategories(args []string, cfg *config.Config, logger *logging.Logger) error {
+	usage := "usage: magnet2torrent categories list|create|edit|remove ..."
+	if len(args) == 0 {
+		return usageErrorf("%s", usage)
+	}
+
+	fs := flag.NewFlagSet("categories "+args[0], flag.ContinueOnError)
+	format := fs.String("format", "table", "output format for list: table or json")
+	savePath := fs.String("save-path", "", "save path for create/edit")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	names := fs.Args()
+
+	// Check the arguments before connecting, so mistakes fail fast.
+	switch args[0] {
+	case "list":
+	case "create":
+		if len(names) != 1 {
+			return usageErrorf("usage: magnet2torrent categories create [-save-path path] <name>")
+		}
+	case "edit":
+		// Without -save-path, edit would clear the category's path.
+		if len(names) != 1 || !flagGiven(fs, "save-path") {
+			return usageErrorf(`usage: magnet2torrent categories edit -save-path path <name> (-save-path "" clears it)`)
+		}
+	case "remove":
+		if len(names) == 0 {
+			return usageErrorf("usage: magnet2torrent categories remove <name> [name ...]")
+		}
+	default:
+		return usageErrorf("unknown categories action %q; %s", args[0], usage)
+	}
+
+	qb, _, err := connect(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		categories, err := qb.Categories()
+		if err != nil {
+			return fmt.Errorf("list categories: %w", err)
+		}
+		return renderCategories(os.Stdout, *format, categories)
+	case "create", "edit":
+		if args[0] == "create" {
+			err = qb.CreateCategory(names[0], *savePath)
+		} else {
+			err = qb.EditCategory(names[0], *savePath)
+		}
+		if err != nil {
+			return fmt.Errorf("%s category %s: %w", args[0], names[0], err)
+		}
+		logger.Infof("category %s: %s (save path %q)", args[0], names[0], *savePath)
+		return nil
+	default: // remove
+		if err := qb.RemoveCategories(names); err != nil {
+			return fmt.Errorf("remove categories: %w", err)
+		}
+		logger.Infof("removed categories: %v", names)
+		return nil
+	}
+}
+
+func runTags(args []string, cfg *config.Config, logger *logging.Logger) error {
+	usage := "usage: magnet2torrent tags list|create|delete ..."
+	if len(args) == 0 {
+		return usageErrorf("%s", usage)
+	}
+
+	fs := flag.NewFlagSet("tags "+args[0], flag.ContinueOnError)
+	format := fs.String("format", "table", "output format for list: table or json")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	names := fs.Args()
+
+	switch args[0] {
+	case "list":
+	case "create", "delete":
+		if len(names) == 0 {
+			return usageErrorf("usage: magnet2torrent tags %s <tag> [tag ...]", args[0])
+		}
+	default:
+		return usageErrorf("unknown tags action %q; %s", args[0], usage)
+	}
+
+	qb, _, err := connect(cfg, logger)
+	if err != nil {
+		return err
+	}
+	if caps, err := qb.Capabilities(); err != nil {
+		return err
+	} else if err := caps.Require(qbclient.FeatureTags); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		tags, err := qb.Tags()
+		if err != nil {
+			return fmt.Errorf("list tags: %w", err)
+		}
+		sort.Strings(tags)
+		if *format == "json" {
+			return writeJSON(os.Stdout, tags)
+		}
+		for _, tag := range tags {
+			fmt.Println(tag)
+		}
+		return nil
+	default: // create, delete
+		if args[0] == "create" {
+			err = qb.CreateTags(names)
+		} else {
+			err = qb.DeleteTags(names)
+		}
+		if err != nil {
+			return fmt.Errorf("%s tags: %w", args[0], err)
+		}
+		logger.Infof("tags %s: %v", args[0], names)
+		return nil
+	}
+}
+
+// flagGiven reports whether name was set on the command line, even to its
+// default value.
+func flagGiven(fs *flag.FlagSet, name string) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
+
+func renderCategories(w io.Writer, format string, categories map[string]qbclient.Category) error {
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	switch format {
+	case "json":
+		list := make([]qbclient.Category, 0, len(names))
+		for _, name := range names {
+			list = append(list, categories[name])
+		}
+		return writeJSON(w, list)
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSAVE PATH")
+		for _, name := range names {
+			fmt.Fprintf(tw, "%s\t%s\n", name, categories[name].SavePath)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q; use table or json", format)
+	}
+}
+
+// ensureCategory creates category on the server when it does not exist yet.
+func ensureCategory(qb qbClient, category string, logger *logging.Logger) error {
+	categories, err := qb.Categories()
+	if err != nil {
+		return fmt.Errorf("list categories: %w", err)
+	}
+	if _, ok := categories[category]; ok {
+		return nil
+	}
+	if err := qb.CreateCategory(category, ""); err != nil {
+		return fmt.Errorf("create category %s: %w", category, err)
+	}
+	logger.Infof("created missing category %s", category)
+	return nil
+}
+
+// ensureCategoryPath creates category with savePath unless known already lists
+// it, and records it in known so repeated calls only create it once.
+func ensureCategoryPath(qb qbClient, known map[string]qbclient.Category, category, savePath string, logger *logging.Logger) error {
+	if category == "" {
+		return nil
+	}
+	if _, ok := known[category]; ok {
+		return nil
+	}
+	if err := qb.CreateCategory(category, savePath); err != nil {
+		return fmt.Errorf("create category %s: %w", category, err)
+	}
+	known[category] = qbclient.Category{Name: category, SavePath: savePath}
+	logger.Infof("created category %s (save path %q)", category, savePath)
+	return nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func TestRunCategoriesAndTags(t *testing.T) {
+	stub := &stubQBClient{}
+	useStubClient(t, stub)
+	logger := logging.NewLogger("error", "")
+
+	if err := runCategories([]string{"create", "-save-path", "/data/iso", "linux"}, testConfig(), logger); err != nil {
+		t.Fatalf("categories create error: %v", err)
+	}
+	if err := runCategories([]string{"edit", "-save-path", "/data/linux", "linux"}, testConfig(), logger); err != nil {
+		t.Fatalf("categories edit error: %v", err)
+	}
+	if stub.categories["linux"].SavePath != "/data/linux" {
+		t.Fatalf("unexpected categories: %+v", stub.categories)
+	}
+	if err := runCategories([]string{"remove", "linux"}, testConfig(), logger); err != nil {
+		t.Fatalf("categories remove error: %v", err)
+	}
+	if err := runTags([]string{"create", "a", "b"}, testConfig(), logger); err != nil {
+		t.Fatalf("tags create error: %v", err)
+	}
+	// Bad actions and arguments fail before connecting.
+	stub.loginErr = errors.New("must not connect")
+	for _, args := range [][]string{{"rename", "x"}, {"edit", "linux"}, {"create"}, {"remove"}} {
+		if err := runCategories(args, testConfig(), logger); errorCode(err) != codeUsage {
+			t.Fatalf("categories %v = %v, want a usage error", args, err)
+		}
+	}
+	for _, args := range [][]string{{"rename"}, {"delete"}} {
+		if err := runTags(args, testConfig(), logger); errorCode(err) != codeUsage {
+			t.Fatalf("tags %v = %v, want a usage error", args, err)
+		}
+	}
+	stub.loginErr = nil
+
+	want := "create-category linux,edit-category linux,remove-categories linux,create-tags a|b"
+	if got := strings.Join(stub.calls, ","); got != want {
+		t.Fatalf("calls = %s, want %s", got, want)
+	}
+
+	stub.caps = &qbclient.Capabilities{AppVersion: "v4.1.9", WebAPIVersion: qbclient.Version{Major: 2, Minor: 2}}
+	if err := runTags([]string{"list"}, testConfig(), logger); err == nil || !strings.Contains(err.Error(), "tags needs qBittorrent 4.2.0") {
+		t.Fatalf("expected unsupported tags error, got %v", err)
+	}
+}
+
+func TestRenderCategories(t *testing.T) {
+	var buf bytes.Buffer
+	categories := map[string]qbclient.Category{
+		"tv":    {Name: "tv", SavePath: "/data/tv"},
+		"linux": {Name: "linux"},
+	}
+	if err := renderCategories(&buf, "table", categories); err != nil {
+		t.Fatalf("renderCategories error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "linux") || !strings.Contains(lines[2], "/data/tv") {
+		t.Fatalf("unexpected table:\n%s", buf.String())
+	}
+}
+
+func TestProcessMagnetCreatesMissingCategory(t *testing.T) {
+	stub := &stubQBClient{categories: map[string]qbclient.Category{"tv": {Name: "tv"}}}
+	useStubClient(t, stub)
+	logger := logging.NewLogger("error", "")
+
+	opts := addOptions{createCategory: true, add: qbclient.AddOptions{Category: "tv"}}
+	if err := processMagnet("magnet:?xt=urn:btih:example", testConfig(), logger, opts); err != nil {
+		t.Fatalf("processMagnet error: %v", err)
+	}
+	if len(stub.calls) != 0 {
+		t.Fatalf("existing category should not be created, got %v", stub.calls)
+	}
+
+	opts.add.Category = "linux"
+	if err := processMagnet("magnet:?xt=urn:btih:example", testConfig(), logger, opts); err != nil {
+		t.Fatalf("processMagnet error: %v", err)
+	}
+	if len(stub.calls) != 1 || stub.calls[0] != "create-category linux" || stub.lastAddOpts.Category != "linux" {
+		t.Fatalf("expected category creation before add, got %v / %+v", stub.calls, stub.lastAddOpts)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+)
+
+// commandActions are the first arguments of commands that take an action.
+var commandActions = map[string][]string{
+	"categories": {"list", "create", "edit", "remove"},
+	"tags":       {"list", "create", "delete"},
+	"history":    {"list", "export", "resend"},
+	"queue":      {"list", "top", "bottom", "up", "down"},
+	"config":     {"show", "get", "set", "edit", "path", "init", "schema", "migrate", "fix-perms"},
+	"completion": {"bash", "zsh", "fish"},
+}
+
+// flagValues are the fixed choices of enumerated flags, whatever the command.
+var flagValues = map[string][]string{
+	"output":         {outputText, outputJSON, outputQuiet},
+	"on-duplicate":   {config.DuplicateSkip, config.DuplicateMerge, config.DuplicateForce},
+	"content-layout": {"Original", "Subfolder", "NoSubfolder"},
+	"filter":         {"all", "downloading", "seeding", "completed", "stopped", "active", "inactive", "stalled", "errored"},
+}
+
+// commandFlagValues are the fixed choices of enumerated flags whose values
+// depend on the command, by flag and then command.
+var commandFlagValues = map[string]map[string][]string{
+	"format": {
+		"list":       {"table", "json", "csv"},
+		"history":    {"table", "json", "csv"},
+		"categories": {"table", "json"},
+		"tags":       {"table", "json"},
+		"queue":      {"table", "json"},
+		"servers":    {"table", "json"},
+		"doctor":     {"text", "json"},
+	},
+}
+
+// Flags completed by querying config or the live server through __complete,
+// and flags that name a file.
+var (
+	serverFlags   = []string{"server", "from", "to"}
+	categoryFlags = []string{"category"}
+	tagFlags      = []string{"tag", "tags"}
+	fileFlags     = []string{"config", "from-file", "f", "i", "o"}
+)
+
+func runCompletion(args []string, cfg *config.Config, logger *logging.Logger) error {
+	if len(args) != 1 {
+		return usageErrorf("usage: magnet2torrent completion bash|zsh|fish")
+	}
+	tmpl, ok := completionScripts[args[0]]
+	if !ok {
+		return usageErrorf("unknown shell %q; use bash, zsh or fish", args[0])
+	}
+	return writeCompletion(os.Stdout, tmpl, flag.CommandLine)
+}
+
+// runComplete prints one candidate per line for the shell scripts. Failures
+// print nothing: a completion must never spew errors into the prompt.
+func runComplete(args []string, cfg *config.Config, logger *logging.Logger) error {
+	logger.SetConsole(nil)
+	if len(args) != 1 {
+		return nil
+	}
+	words, err := completionWords(args[0], cfg, logger)
+	if err != nil {
+		logger.Debugf("complete %s: %v", args[0], err)
+		return nil
+	}
+	for _, w := range words {
+		fmt.Fprintln(os.Stdout, w)
+	}
+	return nil
+}
+
+func completionWords(kind string, cfg *config.Config, logger *logging.Logger) ([]string, error) {
+	switch kind {
+	case "commands":
+		names := make([]string, 0, len(commandSummaries))
+		for _, c := range commandSummaries {
+			names = append(names, c.name)
+		}
+		return names, nil
+	case "servers":
+		return cfg.ServerNames(), nil
+	case "categories":
+		return serverWords(cfg, logger, func(qb qbClient) ([]string, error) {
+			categories, err := qb.Categories()
+			if err != nil {
+				return nil, err
+			}
+			names := make([]string, 0, len(categories))
+			for name := range categories {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return names, nil
+		})
+	case "tags":
+		return serverWords(cfg, logger, func(qb qbClient) ([]string, error) {
+			tags, err := qb.Tags()
+			if err != nil {
+				return nil, err
+			}
+			if cfg.AddedTag != "" && !containsTag(tags, cfg.AddedTag) {
+				tags = append(tags, cfg.AddedTag)
+			}
+			sort.Strings(tags)
+			return tags, nil
+		})
+	default:
+		return nil, fmt.Errorf("unknown completion %q", kind)
+	}
+}
+
+// completionTimeout bounds the login and query behind a completion, so Tab
+// does not hang the shell while the server is down.
+var completionTimeout = 2 * time.Second
+
+// serverWords logs in and runs query, giving up after completionTimeout. The
+// process exits right after completing, taking an abandoned request with it.
+func serverWords(cfg *config.Config, logger *logging.Logger, query func(qbClient) ([]string, error)) ([]string, error) {
+	type result struct {
+		words []string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		qb, _, err := connect(cfg, logger)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		words, err := query(qb)
+		done <- result{words, err}
+	}()
+	select {
+	case r := <-done:
+		return r.words, r.err
+	case <-time.After(completionTimeout):
+		return nil, fmt.Errorf("no answer from the server within %s", completionTimeout)
+	}
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// completionData feeds the script templates.
+type completionData struct {
+	Commands []completionCommand
+	// Flags are the global flags; ValueFlags those that take an argument.
+	Flags      []string
+	ValueFlags []string
+	Actions    map[string][]string
+	Values     map[string][]string
+	// CommandValues are commandFlagValues.
+	CommandValues map[string]map[string][]string
+	Servers       []string
+	Categories    []string
+	Tags          []string
+	Files         []string
+}
+
+type completionCommand struct{ Name, Summary string }
+
+func writeCompletion(w io.Writer, tmpl *template.Template, global *flag.FlagSet) error {
+	data := completionData{
+		Actions:       commandActions,
+		Values:        flagValues,
+		CommandValues: commandFlagValues,
+		Servers:       serverFlags,
+		Categories:    categoryFlags,
+		Tags:          tagFlags,
+		Files:         fileFlags,
+	}
+	for _, c := range commandSummaries {
+		data.Commands = append(data.Commands, completionCommand{Name: c.name, Summary: c.summary})
+	}
+	global.VisitAll(func(f *flag.Flag) {
+		data.Flags = append(data.Flags, "-"+f.Name)
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			data.ValueFlags = append(data.ValueFlags, "-"+f.Name)
+		}
+	})
+	return tmpl.Execute(w, data)
+}
+
+var completionFuncs = template.FuncMap{
+	"join": strings.Join,
+	// dashed prefixes each flag name with "-", joined by sep.
+	"dashed": func(names []string, sep string) string {
+		out := make([]string, len(names))
+		for i, n := range names {
+			out[i] = "-" + n
+		}
+		return strings.Join(out, sep)
+	},
+	"names": func(cmds []completionCommand) string {
+		out := make([]string, len(cmds))
+		for i, c := range cmds {
+			out[i] = c.Name
+		}
+		return strings.Join(out, " ")
+	},
+	// shq and fishq quote s inside single quotes for sh/zsh and fish.
+	"shq":    func(s string) string { return strings.ReplaceAll(s, "'", `'\''`) },
+	"fishq":  func(s string) string { return strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) },
+	"sorted": sortedKeys[[]string],
+	// sortedFlags lists the flags of commandFlagValues.
+	"sortedFlags": sortedKeys[map[string][]string],
+}
+
+var completionScripts = map[string]*template.Template{
+	"bash": template.Must(template.New("bash").Funcs(completionFuncs).Parse(bashCompletion)),
+	"zsh":  template.Must(template.New("zsh").Funcs(completionFuncs).Parse(zshCompletion)),
+	"fish": template.Must(template.New("fish").Funcs(completionFuncs).Parse(fishCompletion)),
+}
+
+const bashCompletion = `# bash completion for magnet2torrent
+# Install: magnet2torrent completion bash > ~/.local/share/bash-completion/completions/magnet2torrent
+
+_magnet2torrent_query() {
+    local kind=$1; shift
+    command magnet2torrent "$@" __complete "$kind" </dev/null 2>/dev/null
+}
+
+_magnet2torrent() {
+    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+    local cmd="" i global=()
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case ${COMP_WORDS[i]} in
+            -config|-server) global+=("${COMP_WORDS[i]}" "${COMP_WORDS[i+1]}"); ((i++)) ;;
+            {{join .ValueFlags "|"}}) ((i++)) ;;
+            -*) ;;
+            *) cmd=${COMP_WORDS[i]}; break ;;
+        esac
+    done
+
+    case $prev in
+        {{dashed .Servers "|"}})
+            COMPREPLY=($(compgen -W "$(_magnet2torrent_query servers "${global[@]}")" -- "$cur")); return ;;
+        {{dashed .Categories "|"}})
+            COMPREPLY=($(compgen -W "$(_magnet2torrent_query categories "${global[@]}")" -- "$cur")); return ;;
+        {{dashed .Tags "|"}})
+            COMPREPLY=($(compgen -W "$(_magnet2torrent_query tags "${global[@]}")" -- "$cur")); return ;;
+        {{dashed .Files "|"}})
+            COMPREPLY=($(compgen -f -- "$cur")); return ;;
+{{- range $flag := sorted .Values}}
+        -{{$flag}}) COMPREPLY=($(compgen -W "{{join (index $.Values $flag) " "}}" -- "$cur")); return ;;
+{{- end}}
+{{- range $flag := sortedFlags .CommandValues}}{{$byCmd := index $.CommandValues $flag}}
+        -{{$flag}})
+            case $cmd in
+{{- range $cmd := sorted $byCmd}}
+                {{$cmd}}) COMPREPLY=($(compgen -W "{{join (index $byCmd $cmd) " "}}" -- "$cur")) ;;
+{{- end}}
+            esac
+            return ;;
+{{- end}}
+    esac
+
+    if [[ -z $cmd ]]; then
+        if [[ $cur == -* ]]; then
+            COMPREPLY=($(compgen -W "{{join .Flags " "}}" -- "$cur"))
+        else
+            COMPREPLY=($(compgen -W "{{names .Commands}}" -- "$cur") $(compgen -f -- "$cur"))
+        fi
+        return
+    fi
+
+    case $cmd in
+{{- range $cmd := sorted .Actions}}
+        {{$cmd}}) if [[ ${COMP_WORDS[COMP_CWORD-1]} == {{$cmd}} ]]; then COMPREPLY=($(compgen -W "{{join (index $.Actions $cmd) " "}}" -- "$cur")); return; fi ;;
+{{- end}}
+    esac
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$(command magnet2torrent $cmd -h </dev/null 2>&1 | sed -n 's/^  \(-[a-z-]*\).*/\1/p')" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+}
+
+complete -F _magnet2torrent magnet2torrent
+`
+
+const zshCompletion = `#compdef magnet2torrent
+# zsh completion for magnet2torrent
+# Install: magnet2torrent completion zsh > "${fpath[1]}/_magnet2torrent"
+
+_magnet2torrent_query() {
+    local kind=$1; shift
+    command magnet2torrent "$@" __complete "$kind" </dev/null 2>/dev/null
+}
+
+_magnet2torrent() {
+    local cur=${words[CURRENT]} prev=${words[CURRENT-1]}
+    local cmd="" i
+    local -a global
+    for ((i = 2; i < CURRENT; i++)); do
+        case ${words[i]} in
+            -config|-server) global+=("${words[i]}" "${words[i+1]}"); ((i++)) ;;
+            {{join .ValueFlags "|"}}) ((i++)) ;;
+            -*) ;;
+            *) cmd=${words[i]}; break ;;
+        esac
+    done
+
+    case $prev in
+        {{dashed .Servers "|"}})
+            compadd -- ${(f)"$(_magnet2torrent_query servers $global)"}; return ;;
+        {{dashed .Categories "|"}})
+            compadd -- ${(f)"$(_magnet2torrent_query categories $global)"}; return ;;
+        {{dashed .Tags "|"}})
+            compadd -- ${(f)"$(_magnet2torrent_query tags $global)"}; return ;;
+        {{dashed .Files "|"}})
+            _files; return ;;
+{{- range $flag := sorted .Values}}
+        -{{$flag}}) compadd -- {{join (index $.Values $flag) " "}}; return ;;
+{{- end}}
+{{- range $flag := sortedFlags .CommandValues}}{{$byCmd := index $.CommandValues $flag}}
+        -{{$flag}})
+            case $cmd in
+{{- range $cmd := sorted $byCmd}}
+                {{$cmd}}) compadd -- {{join (index $byCmd $cmd) " "}} ;;
+{{- end}}
+            esac
+            return ;;
+{{- end}}
+    esac
+
+    if [[ -z $cmd ]]; then
+        if [[ $cur == -* ]]; then
+            compadd -- {{join .Flags " "}}
+        else
+            local -a commands
+            commands=({{range .Commands}}'{{.Name}}:{{shq .Summary}}' {{end}})
+            _describe command commands
+            _files
+        fi
+        return
+    fi
+
+    case $cmd in
+{{- range $cmd := sorted .Actions}}
+        {{$cmd}}) if [[ $prev == {{$cmd}} ]]; then compadd -- {{join (index $.Actions $cmd) " "}}; return; fi ;;
+{{- end}}
+    esac
+    if [[ $cur == -* ]]; then
+        compadd -- ${(f)"$(command magnet2torrent $cmd -h </dev/null 2>&1 | sed -n 's/^  \(-[a-z-]*\).*/\1/p')"}
+    else
+        _files
+    fi
+}
+
+compdef _magnet2torrent magnet2torrent
+`
+
+const fishCompletion = `# fish completion for magnet2torrent
+# Install: magnet2torrent completion fish > ~/.config/fish/completions/magnet2torrent.fish
+
+# Prints the command word, skipping global flags and their values.
+function __magnet2torrent_command
+    set -l tokens (commandline -opc)
+    set -e tokens[1]
+    while set -q tokens[1]
+        switch $tokens[1]
+            case {{join .ValueFlags " "}}
+                set -e tokens[1]
+            case '-*'
+            case '*'
+                echo $tokens[1]
+                return 0
+        end
+        set -e tokens[1]
+    end
+    return 1
+end
+
+# True right after the command word given in $argv[1].
+function __magnet2torrent_using
+    set -l tokens (commandline -opc)
+    set -l cmd (__magnet2torrent_command)
+    test "$cmd" = $argv[1]; and test "$tokens[-1]" = $argv[1]
+end
+
+# Queries config or the server, passing on -config and -server.
+function __magnet2torrent_query
+    set -l tokens (commandline -opc)
+    set -l global
+    for i in (seq (count $tokens))
+        if contains -- $tokens[$i] -config -server; and test $i -lt (count $tokens)
+            set global $global $tokens[$i] $tokens[(math $i + 1)]
+        end
+    end
+    command magnet2torrent $global __complete $argv[1] </dev/null 2>/dev/null
+end
+
+complete -c magnet2torrent -n 'not __magnet2torrent_command' -F
+{{- range .Commands}}
+complete -c magnet2torrent -n 'not __magnet2torrent_command' -f -a {{.Name}} -d '{{fishq .Summary}}'
+{{- end}}
+{{- range .Flags}}
+complete -c magnet2torrent -n 'not __magnet2torrent_command' -o {{slice . 1}}
+{{- end}}
+{{- range .Servers}}
+complete -c magnet2torrent -o {{.}} -x -a '(__magnet2torrent_query servers)'
+{{- end}}
+{{- range .Categories}}
+complete -c magnet2torrent -o {{.}} -x -a '(__magnet2torrent_query categories)'
+{{- end}}
+{{- range .Tags}}
+complete -c magnet2torrent -o {{.}} -x -a '(__magnet2torrent_query tags)'
+{{- end}}
+{{- range .Files}}
+complete -c magnet2torrent -o {{.}} -r -F
+{{- end}}
+{{- range $flag := sorted .Values}}
+complete -c magnet2torrent -o {{$flag}} -x -a '{{join (index $.Values $flag) " "}}'
+{{- end}}
+{{- range $flag := sortedFlags .CommandValues}}{{$byCmd := index $.CommandValues $flag}}
+{{- range $cmd := sorted $byCmd}}
+complete -c magnet2torrent -n 'contains -- {{$cmd}} (__magnet2torrent_command)' -o {{$flag}} -x -a '{{join (index $byCmd $cmd) " "}}'
+{{- end}}
+{{- end}}
+{{- range $cmd := sorted .Actions}}
+complete -c magnet2torrent -n '__magnet2torrent_using {{$cmd}}' -f -a '{{join (index $.Actions $cmd) " "}}'
+{{- end}}
+`
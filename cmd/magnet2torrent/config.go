@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+)
+
+// configFilePath is the -config path in effect, set by main.
+var configFilePath = config.GetDefaultConfigPath()
+
+// configFlags are the settings given as flags, such as -server, set by main.
+var configFlags []config.Flag
+
+// configSources layers the system file, configFilePath, MAGNET2TORRENT_CONFIG,
+// the environment and configFlags.
+func configSources() config.Sources {
+	src := config.DefaultSources(configFilePath)
+	src.Flags = configFlags
+	return src
+}
+
+const configUsage = "usage: magnet2torrent config show [-origin]|get <key>|set <key> <value>|edit|path|init|schema|migrate|fix-perms"
+
+// How long to wait for another magnet2torrent to release the config: a
+// quick change such as config set, or a first-run prompt being answered.
+const (
+	configLockWait = 10 * time.Second
+	promptLockWait = 5 * time.Minute
+)
+
+// lockConfigFile locks configFilePath against changes by other processes,
+// waiting up to wait, and returns the function that releases it.
+func lockConfigFile(wait time.Duration, logger *logging.Logger) (func(), error) {
+	unlock, err := config.Lock(configFilePath, 0)
+	if errors.Is(err, config.ErrLocked) && wait > 0 {
+		logger.Infof("waiting for another magnet2torrent to finish with %s", configFilePath)
+		unlock, err = config.Lock(configFilePath, wait)
+	}
+	if err != nil {
+		return nil, withCode(codeConfig, err)
+	}
+	return unlock, nil
+}
+
+// runEditor opens path in editor and waits for it to exit; tests replace it.
+var runEditor = func(editor, path string) error {
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], path)...) // #nosec G204 - the user's own $EDITOR.
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+func runConfig(args []string, cfg *config.Config, logger *logging.Logger) error {
+	if len(args) == 0 {
+		return usageErrorf("%s", configUsage)
+	}
+
+	action, rest := args[0], args[1:]
+	switch action {
+	case "path":
+		if len(rest) != 0 {
+			return usageErrorf("usage: magnet2torrent config path")
+		}
+		fmt.Fprintln(os.Stdout, configFilePath)
+		return nil
+	case "show":
+		return runConfigShow(os.Stdout, rest)
+	case "get":
+		if len(rest) != 1 {
+			return usageErrorf("usage: magnet2torrent config get <key>")
+		}
+		return runConfigGet(os.Stdout, rest[0])
+	case "set":
+		if len(rest) != 2 {
+			return usageErrorf("usage: magnet2torrent config set <key> <value>")
+		}
+		return runConfigSet(rest[0], rest[1], logger)
+	case "edit":
+		if len(rest) != 0 {
+			return usageErrorf("usage: magnet2torrent config edit")
+		}
+		return runConfigEdit(logger)
+	case "schema":
+		if len(rest) != 0 {
+			return usageErrorf("usage: magnet2torrent config schema")
+		}
+		_, err := os.Stdout.Write(config.Schema)
+		return err
+	case "migrate":
+		if len(rest) != 0 {
+			return usageErrorf("usage: magnet2torrent config migrate")
+		}
+		return runConfigMigrate(logger)
+	case "fix-perms":
+		if len(rest) != 0 {
+			return usageErrorf("usage: magnet2torrent config fix-perms")
+		}
+		return runConfigFixPerms(logger)
+	case "init":
+		if len(rest) != 0 {
+			return usageErrorf("usage: magnet2torrent config init")
+		}
+		if !isInteractive() {
+			return withCode(codeConfig, fmt.Errorf("config init needs a terminal; use `magnet2torrent config set` in scripts"))
+		}
+		unlock, err := lockConfigFile(configLockWait, logger)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		// Start from the file rather than cfg, which carries variables and
+		// flags.
+		fileCfg, err := loadConfigFile()
+		if err != nil {
+			return err
+		}
+		return promptConfig(configFilePath, fileCfg, "Setting up magnet2torrent.", logger)
+	default:
+		return usageErrorf("unknown config action %q; %s", action, configUsage)
+	}
+}
+
+// loadConfigFile reads the user's config file over the system one, without
+// variables or flags, so that writing it back keeps only what the user
+// configured.
+func loadConfigFile() (*config.Config, error) {
+	cfg, _, err := config.LoadUser(configSources())
+	if err != nil {
+		return nil, withCode(codeConfig, err)
+	}
+	return cfg, nil
+}
+
+// loadEffectiveConfig reads every layer, as main does, for show and get.
+func loadEffectiveConfig() (*config.Config, error) {
+	cfg, _, err := config.Load(configSources())
+	if err != nil {
+		return nil, withCode(codeConfig, err)
+	}
+	return cfg, nil
+}
+
+func runConfigShow(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("config show", flag.ContinueOnError)
+	reveal := fs.Bool("show-secrets", false, "print passwords and credentials instead of masking them")
+	origin := fs.Bool("origin", false, "list each setting with the file, variable or flag it comes from")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageErrorf("usage: magnet2torrent config show [-show-secrets] [-origin]")
+	}
+
+	cfg, err := loadEffectiveConfig()
+	if err != nil {
+		return err
+	}
+	if !*reveal {
+		cfg = cfg.Redacted()
+	}
+	if !*origin {
+		return writeJSON(w, cfg)
+	}
+
+	settings, err := cfg.Settings()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tORIGIN")
+	for _, s := range settings {
+		value, err := json.Marshal(s.Value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Key, value, s.Origin)
+	}
+	return tw.Flush()
+}
+
+func runConfigGet(w io.Writer, key string) error {
+	cfg, err := loadEffectiveConfig()
+	if err != nil {
+		return err
+	}
+	value, err := cfg.Get(key)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	switch v := value.(type) {
+	case string, bool, int, int64:
+		fmt.Fprintln(w, v)
+	default:
+		return writeJSON(w, v)
+	}
+	return nil
+}
+
+func runConfigSet(key, value string, logger *logging.Logger) error {
+	unlock, err := lockConfigFile(configLockWait, logger)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	cfg, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	if err := cfg.Set(key, value); err != nil {
+		return usageErrorf("%v", err)
+	}
+	if err := saveConfigFile(configFilePath, cfg); err != nil {
+		return err
+	}
+	logger.Infof("set %s in %s", key, configFilePath)
+	return nil
+}
+
+// runConfigMigrate rewrites an older config file in the current format.
+// Loading already upgrades it in memory; this makes it permanent.
+func runConfigMigrate(logger *logging.Logger) error {
+	unlock, err := lockConfigFile(configLockWait, logger)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	cfg, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	from := cfg.MigratedFrom()
+	if from == config.CurrentVersion {
+		logger.Infof("%s is already config version %d", configFilePath, config.CurrentVersion)
+		return nil
+	}
+	if err := saveConfigFile(configFilePath, cfg); err != nil {
+		return err
+	}
+	logger.Infof("upgraded %s from config version %d to %d; the original is in %s.bak", configFilePath, from, config.CurrentVersion, configFilePath)
+	return nil
+}
+
+// runConfigEdit opens a copy of the config in $VISUAL or $EDITOR and saves it
+// only once it parses and its server profiles are valid. Invalid edits can be
+// reopened; when abandoned, the copy is kept so no work is lost.
+func runConfigEdit(logger *logging.Logger) error {
+	original, err := os.ReadFile(configFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		original, err = config.Marshal(configFilePath, config.DefaultConfig())
+	}
+	if err != nil {
+		return withCode(codeConfig, err)
+	}
+
+	// Keep the extension so the editor highlights the right format.
+	tmp, err := os.CreateTemp("", "magnet2torrent-config-*"+filepath.Ext(configFilePath))
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(original)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	editor := editorCommand()
+	for {
+		if err := runEditor(editor, tmpPath); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("run editor %q: %w", editor, err)
+		}
+		edited, err := os.ReadFile(tmpPath)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(edited, original) {
+			os.Remove(tmpPath)
+			logger.Infof("no changes to %s", configFilePath)
+			return nil
+		}
+
+		_, err = validateConfigData(edited)
+		if err == nil {
+			if err := saveLocked(edited, logger); err != nil {
+				return fmt.Errorf("%w; your edits are in %s", err, tmpPath)
+			}
+			os.Remove(tmpPath)
+			logger.Infof("config written to %s", configFilePath)
+			return nil
+		}
+
+		fmt.Fprintf(os.Stderr, "invalid config:\n  %v\n", err)
+		if again, _ := promptConfirm("Edit again?"); !again {
+			return withCode(codeConfig, fmt.Errorf("config not saved; your edits are in %s", tmpPath))
+		}
+	}
+}
+
+// saveConfigFile saves cfg to path, pointing at config edit when the file
+// has comments that saving would drop.
+func saveConfigFile(path string, cfg *config.Config) error {
+	err := config.SaveConfig(path, cfg)
+	if errors.Is(err, config.ErrComments) {
+		return withCode(codeConfig, fmt.Errorf("%w (`magnet2torrent config edit` keeps comments)", err))
+	}
+	return err
+}
+
+// saveLocked writes an edited config to configFilePath as it is, keeping its
+// comments, under the config lock. The editor is not kept waiting on it; an
+// edit replaces the file as a whole anyway.
+func saveLocked(data []byte, logger *logging.Logger) error {
+	unlock, err := lockConfigFile(configLockWait, logger)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return config.SaveConfigData(configFilePath, data)
+}
+
+// runConfigFixPerms makes the config files holding passwords readable by
+// their owner alone.
+func runConfigFixPerms(logger *logging.Logger) error {
+	cfg, err := loadEffectiveConfig()
+	if err != nil {
+		return err
+	}
+	exposed := cfg.ExposedFiles()
+	if len(exposed) == 0 {
+		logger.Infof("no config file with passwords in it is readable by other users")
+		return nil
+	}
+	var failed int
+	for _, p := range exposed {
+		if err := config.FixPermissions(p.File); err != nil {
+			logger.Errorf("%v", err)
+			failed++
+			continue
+		}
+		logger.Infof("made %s readable by its owner only", p.File)
+	}
+	if failed > 0 {
+		return withCode(codeConfig, fmt.Errorf("could not fix %d file(s); ask their owner or an administrator", failed))
+	}
+	return nil
+}
+
+// validateConfigData parses an edited config as the user's file, so its
+// format, includes and the system file apply as they will once saved, and
+// checks its values and every server profile it declares. Unknown keys count
+// as errors here: saving would silently drop them.
+func validateConfigData(data []byte) (*config.Config, error) {
+	cfg, err := config.ParseUser(configSources(), data)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := cfg.Validate()
+	problems := warnings
+	var invalid *config.ValidationError
+	if errors.As(err, &invalid) {
+		problems = append(problems, invalid.Problems...)
+	}
+	var lines []string
+	for _, p := range problems {
+		lines = append(lines, p.String())
+	}
+	for _, name := range cfg.ServerNames() {
+		srv, err := cfg.Server(name)
+		if err == nil {
+			err = validateServer(srv)
+		}
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("server %q: %v", name, err))
+		}
+	}
+	if len(lines) > 0 {
+		return nil, errors.New(strings.Join(lines, "\n  "))
+	}
+	return cfg, nil
+}
+
+func editorCommand() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if e := strings.TrimSpace(os.Getenv(env)); e != "" {
+			return e
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+)
+
+func useConfigFile(t *testing.T) string {
+	t.Helper()
+	orig := configFilePath
+	t.Cleanup(func() { configFilePath = orig })
+	configFilePath = filepath.Join(t.TempDir(), "config.json")
+	return configFilePath
+}
+
+func TestConfigSetGetShow(t *testing.T) {
+	path := useConfigFile(t)
+	logger := logging.NewLogger("error", "")
+
+	for _, kv := range [][2]string{
+		{"qbPassword", "hunter2"},
+		{"autoCreateCategory", "true"},
+		{"servers.nas.host", "https://nas.example:8080"},
+		{"servers.nas.headers.X-Api-Key", "abc123"},
+	} {
+		if err := runConfig([]string{"set", kv[0], kv[1]}, nil, logger); err != nil {
+			t.Fatalf("set %s: %v", kv[0], err)
+		}
+	}
+	for _, bad := range [][2]string{{"autoCreateCategory", "maybe"}, {"qbhost", "x"}, {"pathMaps", "not json"}, {"logLevel", "verbose"}} {
+		err := runConfig([]string{"set", bad[0], bad[1]}, nil, logger)
+		if err == nil || exitCode(err) != exitUsage {
+			t.Fatalf("set %s=%s: err %v", bad[0], bad[1], err)
+		}
+	}
+
+	saved, _, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.AutoCreateCategory || saved.Servers["nas"].Host != "https://nas.example:8080" {
+		t.Fatalf("saved config: %+v", saved)
+	}
+
+	var out bytes.Buffer
+	if err := runConfigGet(&out, "servers.nas.host"); err != nil || out.String() != "https://nas.example:8080\n" {
+		t.Fatalf("get host = %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	if err := runConfigShow(&out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "hunter2") || strings.Contains(out.String(), "abc123") {
+		t.Fatalf("show leaked a secret:\n%s", out.String())
+	}
+	out.Reset()
+	if err := runConfigShow(&out, []string{"-show-secrets"}); err != nil || !strings.Contains(out.String(), "hunter2") {
+		t.Fatalf("show -show-secrets = %v:\n%s", err, out.String())
+	}
+}
+
+func TestConfigShowOrigin(t *testing.T) {
+	path := useConfigFile(t)
+	t.Setenv(config.ExtraConfigEnv, "")
+	t.Setenv("MAGNET2TORRENT_LOG_LEVEL", "debug")
+	if err := os.WriteFile(path, []byte("{\n  \"configVersion\": 1,\n  \"qbHost\": \"http://localhost:8080\"\n}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runConfigShow(&out, []string{"-origin"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := map[string]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 {
+			lines[fields[0]] = fields[1] + " " + fields[2]
+		}
+	}
+	for key, want := range map[string]string{
+		"qbHost":   `"http://localhost:8080" ` + path + ":3",
+		"logLevel": `"debug" MAGNET2TORRENT_LOG_LEVEL`,
+		"appName":  `"magnet2torrent" default`,
+	} {
+		if lines[key] != want {
+			t.Errorf("%s: %q, want %q\n%s", key, lines[key], want, out.String())
+		}
+	}
+
+	// Variables are not written back to the file.
+	if err := runConfig([]string{"set", "qbUsername", "admin"}, nil, logging.NewLogger("error", "")); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _, err := config.LoadConfig(path); err != nil || saved.LogLevel != "info" {
+		t.Fatalf("saved: %+v, %v", saved, err)
+	}
+}
+
+func TestConfigEdit(t *testing.T) {
+	path := useConfigFile(t)
+	// Abandoned edits are kept in a temp file.
+	t.Setenv("TMPDIR", t.TempDir())
+	logger := logging.NewLogger("error", "")
+	if err := config.SaveConfig(path, testConfig()); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(path)
+
+	origEditor := runEditor
+	t.Cleanup(func() { runEditor = origEditor })
+	var edit string
+	runEditor = func(editor, file string) error {
+		return os.WriteFile(file, []byte(edit), 0o600)
+	}
+
+	edit = `{"qbHost": "http://example.test", "qbUsername": "admin", "qbPassword": ""}`
+	err := runConfig([]string{"edit"}, nil, logger)
+	if err == nil || exitCode(err) != exitConfig {
+		t.Fatalf("invalid edit: %v", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, before) {
+		t.Fatalf("invalid edit was saved:\n%s", after)
+	}
+
+	edit = `{"qbHost": "http://example.test", "qbUsername": "admin", "qbPassword": "changed", "qbpasword": "typo"}`
+	err = runConfig([]string{"edit"}, nil, logger)
+	if err == nil || exitCode(err) != exitConfig {
+		t.Fatalf("edit with unknown key: %v", err)
+	}
+
+	edit = `{"qbHost": "http://example.test", "qbUsername": "admin", "qbPassword": "changed"}`
+	if err := runConfig([]string{"edit"}, nil, logger); err != nil {
+		t.Fatalf("valid edit: %v", err)
+	}
+	saved, _, _ := config.LoadConfig(path)
+	if saved.QbPassword != "changed" {
+		t.Fatalf("edit not saved: %+v", saved)
+	}
+}
+
+func TestConfigMigrate(t *testing.T) {
+	path := useConfigFile(t)
+	logger := logging.NewLogger("error", "")
+	original := `{"qbHost": "localhost:8080", "qbUsername": "admin", "qbPassword": "adminadmin"}`
+	if err := os.WriteFile(path, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runConfig([]string{"migrate"}, nil, logger); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if bak, _ := os.ReadFile(path + ".bak"); string(bak) != original {
+		t.Fatalf("backup:\n%s", bak)
+	}
+	cfg, _, err := config.LoadConfig(path)
+	if err != nil || cfg.MigratedFrom() != config.CurrentVersion || cfg.QbHost != "http://localhost:8080" {
+		t.Fatalf("after migrate: %+v, %v", cfg, err)
+	}
+}
+
+func TestConfigFixPerms(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes do not describe access on Windows")
+	}
+	path := useConfigFile(t)
+	t.Setenv(config.ExtraConfigEnv, "")
+	if err := os.WriteFile(path, []byte(`{"configVersion": 1, "qbHost": "http://localhost:8080", "qbPassword": "secret"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logger := logging.NewLogger("error", "")
+
+	cfg, err := loadEffectiveConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPermissions(cfg, logger); err != nil {
+		t.Fatalf("warn policy: %v", err)
+	}
+	cfg.FilePermissions = config.PermissionsRefuse
+	if err := checkPermissions(cfg, logger); err == nil {
+		t.Fatalf("refuse policy accepted a readable file")
+	}
+
+	if err := runConfig([]string{"fix-perms"}, nil, logger); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("after fix-perms: %v, %v", info.Mode(), err)
+	}
+	if err := checkPermissions(cfg, logger); err != nil {
+		t.Fatalf("refuse policy after fix-perms: %v", err)
+	}
+
+	// A change waits for the lock another process holds.
+	unlock, err := config.Lock(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(50*time.Millisecond, unlock)
+	if err := runConfig([]string{"set", "qbUsername", "admin"}, nil, logger); err != nil {
+		t.Fatalf("set after unlock: %v", err)
+	}
+	unlock, err = config.Lock(path, 0)
+	if err != nil {
+		t.Fatalf("lock left held: %v", err)
+	}
+	unlock()
+}
+
+func TestPromptConfigKeepsDefaultServer(t *testing.T) {
+	path := useConfigFile(t)
+	data := `{"qbHost": "http://home:8080", "qbUsername": "a", "qbPassword": "b", "servers": {"seedbox": {"username": "u", "password": "p"}}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	origFlags := configFlags
+	t.Cleanup(func() { configFlags = origFlags })
+	configFlags = []config.Flag{{Name: "-server", Key: "defaultServer", Value: "seedbox"}}
+
+	answers := filepath.Join(t.TempDir(), "answers")
+	if err := os.WriteFile(answers, []byte("https://seedbox.example\n\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.Open(answers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	origStdin := os.Stdin
+	t.Cleanup(func() { os.Stdin = origStdin })
+	os.Stdin = stdin
+
+	cfg, _, err := config.Load(configSources())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := promptConfig(path, cfg, "Config not found or incomplete.", logging.NewLogger("error", "")); err != nil {
+		t.Fatalf("promptConfig: %v", err)
+	}
+
+	// A one-off -server picks the profile to set up but is not saved.
+	configFlags = nil
+	saved, _, err := config.LoadUser(configSources())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.DefaultServer != "" || saved.Servers["seedbox"].Host != "https://seedbox.example" || saved.QbHost != "http://home:8080" {
+		t.Fatalf("saved config: defaultServer %q, seedbox %+v, qbHost %q", saved.DefaultServer, saved.Servers["seedbox"], saved.QbHost)
+	}
+}
+
+func TestConfigEditKeepsComments(t *testing.T) {
+	orig := configFilePath
+	t.Cleanup(func() { configFilePath = orig })
+	configFilePath = filepath.Join(t.TempDir(), "config.yaml")
+	logger := logging.NewLogger("error", "")
+
+	origEditor := runEditor
+	t.Cleanup(func() { runEditor = origEditor })
+	edit := "# the NAS\nqbHost: http://nas.example:8080 # via VPN\nqbUsername: admin\nqbPassword: secret\n"
+	runEditor = func(editor, file string) error {
+		return os.WriteFile(file, []byte(edit), 0o600)
+	}
+	if err := runConfig([]string{"edit"}, nil, logger); err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	if saved, _ := os.ReadFile(configFilePath); string(saved) != edit {
+		t.Fatalf("edit not saved as written:\n%s", saved)
+	}
+
+	// Rewriting would drop the comments, so set refuses and says why.
+	err := runConfig([]string{"set", "logLevel", "debug"}, nil, logger)
+	if !errors.Is(err, config.ErrComments) || exitCode(err) != exitConfig || !strings.Contains(err.Error(), "config edit") {
+		t.Fatalf("set on a commented file: %v", err)
+	}
+	if saved, _ := os.ReadFile(configFilePath); string(saved) != edit {
+		t.Fatalf("set rewrote the file:\n%s", saved)
+	}
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// Doctor check outcomes.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+var (
+	doctorProbeTimeout = 10 * time.Second
+	// lowDiskSpace and certExpiryWarning turn a passing check into a warning.
+	lowDiskSpace      = int64(5 << 30)
+	certExpiryWarning = 14 * 24 * time.Hour
+)
+
+// doctorCheck is one line of the doctor report.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// doctorEnv holds the local paths doctor inspects; tests point them at a
+// temporary directory.
+type doctorEnv struct {
+	goos       string
+	configPath string
+	exe        string
+	// appsDirs are searched for desktop entries; mimeapps lists the
+	// mimeapps.list files in order of precedence.
+	appsDirs []string
+	mimeapps []string
+}
+
+// prober is implemented by clients that can check reachability without
+// logging in.
+type prober interface {
+	Probe(time.Duration) (*qbclient.ProbeResult, error)
+}
+
+// execOutput runs an external tool (reg.exe) and returns its output; tests
+// replace it.
+var execOutput = func(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output() // #nosec G204 - fixed tool names.
+}
+
+func runDoctor(args []string, cfg *config.Config, logger *logging.Logger) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageErrorf("usage: magnet2torrent doctor [-format text|json]")
+	}
+
+	env := defaultDoctorEnv()
+	checks := runDoctorChecks(cfg, env, logger)
+	if err := renderDoctor(os.Stdout, *format, checks); err != nil {
+		return err
+	}
+	if failed := countChecks(checks, checkFail); failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+func defaultDoctorEnv() doctorEnv {
+	env := doctorEnv{goos: runtime.GOOS, configPath: configFilePath}
+	if exe, err := executablePath(); err == nil {
+		env.exe = exe
+	}
+
+	home, _ := os.UserHomeDir()
+	xdg := func(name, fallback string) string {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+		return fallback
+	}
+	configHome := xdg("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	dataHome := xdg("XDG_DATA_HOME", filepath.Join(home, ".local", "share"))
+	configDirs := filepath.SplitList(xdg("XDG_CONFIG_DIRS", "/etc/xdg"))
+	dataDirs := filepath.SplitList(xdg("XDG_DATA_DIRS", "/usr/local/share:/usr/share"))
+
+	// Precedence follows the XDG MIME applications spec.
+	for _, desktop := range strings.Split(strings.ToLower(os.Getenv("XDG_CURRENT_DESKTOP")), ":") {
+		if desktop != "" {
+			env.mimeapps = append(env.mimeapps, filepath.Join(configHome, desktop+"-mimeapps.list"))
+		}
+	}
+	env.mimeapps = append(env.mimeapps, filepath.Join(configHome, "mimeapps.list"))
+	for _, dir := range configDirs {
+		env.mimeapps = append(env.mimeapps, filepath.Join(dir, "mimeapps.list"))
+	}
+	env.mimeapps = append(env.mimeapps, filepath.Join(dataHome, "applications", "mimeapps.list"))
+
+	env.appsDirs = append(env.appsDirs, filepath.Join(dataHome, "applications"))
+	for _, dir := range dataDirs {
+		env.appsDirs = append(env.appsDirs, filepath.Join(dir, "applications"))
+		env.mimeapps = append(env.mimeapps, filepath.Join(dir, "applications", "mimeapps.list"))
+	}
+	return env
+}
+
+func runDoctorChecks(cfg *config.Config, env doctorEnv, logger *logging.Logger) []doctorCheck {
+	checks := []doctorCheck{
+		checkConfigFile(env.configPath, env.goos),
+		checkConfigValues(cfg),
+		checkLogFile(cfg.LogFile),
+	}
+	checks = append(checks, checkServer(cfg, logger)...)
+	return append(checks, checkMagnetHandler(env)...)
+}
+
+func checkConfigFile(path, goos string) doctorCheck {
+	c := doctorCheck{Name: "config file"}
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		c.Status, c.Detail = checkFail, path+" does not exist"
+		c.Hint = "run magnet2torrent in a terminal to create it, or pass -config with the right path"
+	case err != nil:
+		c.Status, c.Detail = checkFail, err.Error()
+		c.Hint = "check the permissions of the config directory"
+	case goos != "windows" && info.Mode().Perm()&0o077 != 0:
+		c.Status, c.Detail = checkWarn, fmt.Sprintf("%s is mode %04o; other users can read the passwords in it", path, info.Mode().Perm())
+		c.Hint = "chmod 600 " + path
+	default:
+		c.Status, c.Detail = checkPass, path
+	}
+	return c
+}
+
+func checkConfigValues(cfg *config.Config) doctorCheck {
+	c := doctorCheck{Name: "config values"}
+	warnings, err := cfg.Validate()
+	var problems []string
+	for _, w := range warnings {
+		problems = append(problems, w.String())
+	}
+	var invalid *config.ValidationError
+	if errors.As(err, &invalid) {
+		for _, p := range invalid.Problems {
+			problems = append(problems, p.String())
+		}
+	}
+	switch {
+	case invalid != nil:
+		c.Status = checkFail
+	case len(problems) > 0:
+		c.Status = checkWarn
+	case cfg.MigratedFrom() != config.CurrentVersion:
+		c.Status = checkWarn
+		c.Detail = fmt.Sprintf("config version %d is upgraded on every run", cfg.MigratedFrom())
+		c.Hint = "run `magnet2torrent config migrate` to rewrite it (a .bak copy is kept)"
+		return c
+	default:
+		c.Status, c.Detail = checkPass, "all settings are valid"
+		return c
+	}
+	c.Detail = strings.Join(problems, "; ")
+	c.Hint = "run `magnet2torrent config edit` to fix them"
+	return c
+}
+
+func checkLogFile(path string) doctorCheck {
+	c := doctorCheck{Name: "log file"}
+	if path == "" {
+		c.Status, c.Detail = checkSkip, "logFile is empty; logging to a file is disabled"
+		return c
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err == nil {
+		var f *os.File
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644) // #nosec G302 G304
+		if err == nil {
+			err = f.Close()
+		}
+	}
+	if err != nil {
+		c.Status, c.Detail = checkFail, err.Error()
+		c.Hint = "fix the permissions of " + filepath.Dir(path) + " or point logFile at a writable path"
+		return c
+	}
+	c.Status, c.Detail = checkPass, path+" is writable"
+	return c
+}
+
+// checkServer checks the selected profile: configuration, reachability, TLS,
+// login, API version and free disk space. Later checks are skipped once one
+// fails, since they would fail for the same reason.
+func checkServer(cfg *config.Config, logger *logging.Logger) []doctorCheck {
+	remaining := []string{"reachability", "tls", "login", "api version", "disk space"}
+	skipRest := func(checks []doctorCheck, why string) []doctorCheck {
+		for _, name := range remaining[len(checks)-1:] {
+			checks = append(checks, doctorCheck{Name: name, Status: checkSkip, Detail: why})
+		}
+		return checks
+	}
+
+	srv, err := cfg.Server("")
+	if err == nil {
+		err = validateServer(srv)
+	}
+	if err != nil {
+		return skipRest([]doctorCheck{{Name: "server config", Status: checkFail, Detail: err.Error(), Hint: "edit the config file; `magnet2torrent config path` shows where it is"}}, "server config is invalid")
+	}
+	checks := []doctorCheck{{Name: "server config", Status: checkPass, Detail: fmt.Sprintf("profile %q, host %s", srv.Name, redactURL(srv.Host))}}
+
+	qb, err := qbClientFactory(srv, logger)
+	if err != nil {
+		checks[0] = doctorCheck{Name: "server config", Status: checkFail, Detail: err.Error(), Hint: "fix " + srv.SettingName("host") + " in the config file"}
+		return skipRest(checks, "server config is invalid")
+	}
+
+	if p, ok := qb.(prober); ok {
+		res, err := p.Probe(doctorProbeTimeout)
+		checks = append(checks, reachabilityCheck(srv, res, err))
+		if checks[len(checks)-1].Status == checkFail {
+			return skipRest(checks, "host is unreachable")
+		}
+		checks = append(checks, tlsCheck(srv, res, err, time.Now()))
+		if checks[len(checks)-1].Status == checkFail {
+			return skipRest(checks, "TLS connection failed")
+		}
+	} else {
+		checks = append(checks,
+			doctorCheck{Name: "reachability", Status: checkSkip, Detail: "client cannot probe without logging in"},
+			doctorCheck{Name: "tls", Status: checkSkip, Detail: "client cannot probe without logging in"})
+	}
+
+	if err := qb.Login(); err != nil {
+		c := doctorCheck{Name: "login", Status: checkFail, Detail: err.Error()}
+		var authErr *qbclient.AuthError
+		if errors.As(err, &authErr) {
+			c.Hint = fmt.Sprintf("check %s and %s; qBittorrent bans an address for a while after repeated failures", srv.SettingName("username"), srv.SettingName("password"))
+		} else {
+			c.Hint = "set logLevel to debug and check the log for the server's reply"
+		}
+		return skipRest(append(checks, c), "login failed")
+	}
+	checks = append(checks, doctorCheck{Name: "login", Status: checkPass, Detail: loginDetail(srv)})
+
+	checks = append(checks, apiVersionCheck(qb))
+	return append(checks, diskSpaceCheck(qb))
+}
+
+func loginDetail(srv config.Server) string {
+	if srv.NoAuth() {
+		return "server accepts requests without a login"
+	}
+	return "logged in as " + srv.Username
+}
+
+func reachabilityCheck(srv config.Server, res *qbclient.ProbeResult, err error) doctorCheck {
+	c := doctorCheck{Name: "reachability"}
+	if err != nil && !isTLSError(err) {
+		c.Status, c.Detail = checkFail, err.Error()
+		var (
+			dnsErr *net.DNSError
+			netErr net.Error
+		)
+		switch {
+		case errors.As(err, &dnsErr):
+			c.Hint = "the host name does not resolve; check " + srv.SettingName("host")
+		case errors.Is(err, syscall.ECONNREFUSED):
+			c.Hint = "nothing is listening there; is qBittorrent running with the Web UI enabled (Options > Web UI) on this port?"
+		case errors.As(err, &netErr) && netErr.Timeout():
+			c.Hint = "no answer; check firewalls, VPNs and the port in " + srv.SettingName("host")
+		default:
+			c.Hint = "check " + srv.SettingName("host") + " and " + srv.SettingName("proxy")
+		}
+		return c
+	}
+	if err != nil {
+		c.Status, c.Detail = checkPass, "host answers (TLS handshake failed, see below)"
+		return c
+	}
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusForbidden, http.StatusUnauthorized:
+		c.Status, c.Detail = checkPass, fmt.Sprintf("Web API answers at %s (status %d)", redactURL(srv.Host), res.StatusCode)
+	case http.StatusNotFound:
+		c.Status, c.Detail = checkWarn, "reached a web server but not the qBittorrent API (status 404)"
+		c.Hint = "check the sub-path in " + srv.SettingName("host") + ", e.g. https://example.com/qbt/"
+	default:
+		c.Status, c.Detail = checkWarn, fmt.Sprintf("unexpected status %d from the Web API", res.StatusCode)
+		c.Hint = "a reverse proxy in front of qBittorrent may be failing; check its logs and " + srv.SettingName("headers")
+	}
+	return c
+}
+
+func isTLSError(err error) bool {
+	var (
+		verifyErr   *tls.CertificateVerificationError
+		unknownAuth x509.UnknownAuthorityError
+		hostErr     x509.HostnameError
+		invalidErr  x509.CertificateInvalidError
+		recordErr   tls.RecordHeaderError
+	)
+	return errors.As(err, &verifyErr) || errors.As(err, &unknownAuth) || errors.As(err, &hostErr) ||
+		errors.As(err, &invalidErr) || errors.As(err, &recordErr)
+}
+
+func tlsCheck(srv config.Server, res *qbclient.ProbeResult, err error, now time.Time) doctorCheck {
+	c := doctorCheck{Name: "tls"}
+	u, _ := url.Parse(srv.Host)
+	switch {
+	case err != nil:
+		c.Status, c.Detail = checkFail, err.Error()
+		c.Hint = "the certificate is not trusted for this host; install its CA certificate, fix the host name, or use http:// on a trusted network"
+		var recordErr tls.RecordHeaderError
+		if errors.As(err, &recordErr) {
+			c.Hint = "the server does not speak TLS on this port; use http:// or enable HTTPS in the Web UI options"
+		}
+	case u == nil || u.Scheme == "unix":
+		c.Status, c.Detail = checkSkip, "unix socket"
+	case u.Scheme == "http" && isLocalHostname(u.Hostname()):
+		c.Status, c.Detail = checkPass, "plain HTTP to a local address"
+	case u.Scheme == "http":
+		c.Status, c.Detail = checkWarn, "plain HTTP; the password travels unencrypted"
+		c.Hint = "enable HTTPS in qBittorrent's Web UI options or put it behind a TLS reverse proxy"
+	case res == nil || res.TLS == nil || len(res.TLS.PeerCertificates) == 0:
+		c.Status, c.Detail = checkPass, "HTTPS"
+	default:
+		leaf := res.TLS.PeerCertificates[0]
+		c.Detail = fmt.Sprintf("%s, certificate valid until %s", tls.VersionName(res.TLS.Version), leaf.NotAfter.Format("2006-01-02"))
+		c.Status = checkPass
+		if leaf.NotAfter.Sub(now) < certExpiryWarning {
+			c.Status = checkWarn
+			c.Hint = "the certificate expires soon; renew it"
+		}
+	}
+	return c
+}
+
+func isLocalHostname(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// doctorFeatures are the optional features worth warning about; stop/start is
+// left out because older servers get the pause/resume endpoints instead.
+var doctorFeatures = []qbclient.Feature{qbclient.FeatureTags, qbclient.FeatureContentLayout, qbclient.FeatureExport}
+
+func apiVersionCheck(qb qbClient) doctorCheck {
+	c := doctorCheck{Name: "api version"}
+	caps, err := qb.Capabilities()
+	if err != nil {
+		c.Status, c.Detail = checkFail, err.Error()
+		c.Hint = "the server did not report its version; is this a qBittorrent Web UI?"
+		return c
+	}
+	c.Status, c.Detail = checkPass, fmt.Sprintf("qBittorrent %s, Web API %s", caps.AppVersion, caps.WebAPIVersion)
+	var missing []string
+	for _, f := range doctorFeatures {
+		if !caps.Supports(f) {
+			missing = append(missing, fmt.Sprintf("%s (%s+)", f.Name, f.Release))
+		}
+	}
+	if len(missing) > 0 {
+		c.Status = checkWarn
+		c.Detail += "; unsupported: " + strings.Join(missing, ", ")
+		c.Hint = "upgrade qBittorrent to use these features"
+	}
+	return c
+}
+
+func diskSpaceCheck(qb qbClient) doctorCheck {
+	c := doctorCheck{Name: "disk space"}
+	data, err := qb.SyncMainData(0)
+	if err != nil {
+		c.Status, c.Detail = checkWarn, err.Error()
+		return c
+	}
+	// Unlike qbclient.ServerState, a pointer tells "not reported" from zero.
+	var state struct {
+		FreeSpaceOnDisk *int64 `json:"free_space_on_disk"`
+	}
+	if len(data.ServerState) > 0 {
+		_ = json.Unmarshal(data.ServerState, &state)
+	}
+	switch free := state.FreeSpaceOnDisk; {
+	case free == nil:
+		c.Status, c.Detail = checkSkip, "server does not report free space"
+	case *free < lowDiskSpace:
+		c.Status, c.Detail = checkWarn, formatBytes(*free)+" free in the default save path"
+		c.Hint = "free up space or change the default save path; downloads stop when the disk fills"
+	default:
+		c.Status, c.Detail = checkPass, formatBytes(*free)+" free in the default save path"
+	}
+	return c
+}
+
+func checkMagnetHandler(env doctorEnv) []doctorCheck {
+	switch env.goos {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return checkMagnetHandlerXDG(env)
+	case "windows":
+		return []doctorCheck{checkMagnetHandlerWindows(env)}
+	default:
+		return []doctorCheck{{Name: "magnet handler", Status: checkSkip, Detail: "not checked on " + env.goos}}
+	}
+}
+
+func checkMagnetHandlerXDG(env doctorEnv) []doctorCheck {
+	registerHint := "run `magnet2torrent register`"
+	desktop, source := "", ""
+	for _, path := range env.mimeapps {
+		data, err := os.ReadFile(path) // #nosec G304 - XDG paths.
+		if err != nil {
+			continue
+		}
+		if d, ok := mimeDefault(string(data), magnetMIME); ok {
+			desktop, source = d, path
+			break
+		}
+	}
+
+	def := doctorCheck{Name: "magnet handler"}
+	switch desktop {
+	case "":
+		def.Status, def.Detail, def.Hint = checkFail, "no default application for "+magnetMIME, registerHint
+		return []doctorCheck{def,
+			{Name: "desktop entry", Status: checkSkip, Detail: "no handler registered"},
+			{Name: "handler exec", Status: checkSkip, Detail: "no handler registered"}}
+	case handlerDesktopName:
+		def.Status, def.Detail = checkPass, fmt.Sprintf("%s (from %s)", desktop, source)
+	default:
+		def.Status, def.Detail = checkWarn, fmt.Sprintf("magnet links open with %s (from %s)", desktop, source)
+		def.Hint = registerHint + " to handle them with magnet2torrent"
+	}
+	checks := []doctorCheck{def}
+
+	entry := doctorCheck{Name: "desktop entry"}
+	var path string
+	for _, dir := range env.appsDirs {
+		if p := filepath.Join(dir, desktop); fileExists(p) {
+			path = p
+			break
+		}
+	}
+	if path == "" {
+		entry.Status, entry.Detail, entry.Hint = checkFail, desktop+" not found in "+strings.Join(env.appsDirs, ", "), registerHint
+		return append(checks, entry, doctorCheck{Name: "handler exec", Status: checkSkip, Detail: "no desktop entry"})
+	}
+	data, err := os.ReadFile(path) // #nosec G304 - XDG paths.
+	if err != nil {
+		entry.Status, entry.Detail = checkFail, err.Error()
+		return append(checks, entry, doctorCheck{Name: "handler exec", Status: checkSkip, Detail: "desktop entry unreadable"})
+	}
+	fields := parseDesktopEntry(string(data))
+	if !mimeListHas(fields["MimeType"], magnetMIME) {
+		entry.Status, entry.Detail, entry.Hint = checkFail, path+" does not list "+magnetMIME+" in MimeType", registerHint
+	} else {
+		entry.Status, entry.Detail = checkPass, path
+	}
+	checks = append(checks, entry)
+
+	return append(checks, execCheck(fields["Exec"], env.exe, registerHint))
+}
+
+// execCheck verifies that a handler command line runs exe with the link.
+func execCheck(command, exe, hint string) doctorCheck {
+	c := doctorCheck{Name: "handler exec"}
+	prog := commandProgram(command)
+	if prog == "" {
+		c.Status, c.Detail, c.Hint = checkFail, "no Exec= command", hint
+		return c
+	}
+	if !filepath.IsAbs(prog) {
+		if found, err := exec.LookPath(prog); err == nil {
+			prog = found
+		}
+	}
+	info, err := os.Stat(prog)
+	if err != nil {
+		c.Status, c.Detail, c.Hint = checkFail, fmt.Sprintf("%s does not exist", prog), hint
+		return c
+	}
+	if self, err := os.Stat(exe); err != nil || !os.SameFile(info, self) {
+		c.Status, c.Detail, c.Hint = checkFail, fmt.Sprintf("runs %s, not this binary (%s)", prog, exe), hint+" to point it here"
+		return c
+	}
+	if !strings.Contains(command, "%u") && !strings.Contains(command, "%U") && !strings.Contains(command, "%1") {
+		c.Status, c.Detail, c.Hint = checkWarn, "the command does not pass the link ("+command+")", hint
+		return c
+	}
+	c.Status, c.Detail = checkPass, "runs "+prog
+	return c
+}
+
+func checkMagnetHandlerWindows(env doctorEnv) doctorCheck {
+	command, err := windowsHandlerCommand()
+	if err != nil {
+		return doctorCheck{Name: "magnet handler", Status: checkFail, Detail: windowsCommandKey + " is not set", Hint: "run `magnet2torrent register`"}
+	}
+	c := execCheck(command, env.exe, "run `magnet2torrent register`")
+	c.Name = "magnet handler"
+	return c
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// mimeDefault returns the first application listed for mime under
+// [Default Applications] in a mimeapps.list.
+func mimeDefault(content, mime string) (string, bool) {
+	inSection := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inSection = line == "[Default Applications]"
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !inSection || !ok || strings.TrimSpace(key) != mime {
+			continue
+		}
+		for _, app := range strings.Split(value, ";") {
+			if app = strings.TrimSpace(app); app != "" {
+				return app, true
+			}
+		}
+	}
+	return "", false
+}
+
+// parseDesktopEntry returns the keys of the [Desktop Entry] group.
+func parseDesktopEntry(content string) map[string]string {
+	fields := map[string]string{}
+	inGroup := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inGroup = line == "[Desktop Entry]"
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); inGroup && ok {
+			fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
+
+// commandProgram extracts the program from an Exec= or registry command line,
+// undoing the double-quote escaping desktopExecQuote applies.
+func commandProgram(command string) string {
+	command = strings.TrimSpace(command)
+	if !strings.HasPrefix(command, `"`) {
+		prog, _, _ := strings.Cut(command, " ")
+		return prog
+	}
+	var b strings.Builder
+	for i := 1; i < len(command); i++ {
+		switch ch := command[i]; {
+		case ch == '\\' && i+1 < len(command) && strings.ContainsRune("\"`$\\", rune(command[i+1])):
+			i++
+			b.WriteByte(command[i])
+		case ch == '"':
+			return b.String()
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+func countChecks(checks []doctorCheck, status string) int {
+	n := 0
+	for _, c := range checks {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func renderDoctor(w io.Writer, format string, checks []doctorCheck) error {
+	switch format {
+	case "json":
+		return writeJSON(w, checks)
+	case "text", "":
+		for _, c := range checks {
+			fmt.Fprintf(w, "[%s] %s: %s\n", strings.ToUpper(c.Status), c.Name, c.Detail)
+			if c.Hint != "" {
+				fmt.Fprintf(w, "       hint: %s\n", c.Hint)
+			}
+		}
+		fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed, %d skipped\n",
+			countChecks(checks, checkPass), countChecks(checks, checkWarn), countChecks(checks, checkFail), countChecks(checks, checkSkip))
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q; use text or json", format)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/history"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// duplicateRemoveTimeout bounds how long the force policy waits for the old
+// torrent to disappear before re-adding it.
+var duplicateRemoveTimeout = 10 * time.Second
+
+func validateDuplicatePolicy(policy string) error {
+	switch policy {
+	case "", config.DuplicateSkip, config.DuplicateMerge, config.DuplicateForce:
+		return nil
+	default:
+		return usageErrorf("duplicate policy %q is invalid; use %s, %s or %s", policy, config.DuplicateSkip, config.DuplicateMerge, config.DuplicateForce)
+	}
+}
+
+// handleDuplicate applies policy when the torrent for hash is already on the
+// server. It returns the history result when the torrent is present and must
+// not be added, or "" to go ahead with the add; under the force policy it
+// also returns the torrent it removed, to carry its settings over and to put
+// it back if the add fails.
+func handleDuplicate(qb qbClient, trackers []string, hash, policy, server string, logger *logging.Logger) (string, *replacedTorrent, error) {
+	existing, err := qb.Torrents(qbclient.ListOptions{Hashes: []string{hash}})
+	if err != nil {
+		return "", nil, fmt.Errorf("check for duplicates: %w", err)
+	}
+	if len(existing) == 0 {
+		return "", nil, nil
+	}
+	t := existing[0]
+
+	switch policy {
+	case config.DuplicateMerge:
+		added, err := mergeTrackers(qb, trackers, hash)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(added) == 0 {
+			logger.Infof("already present on %s: %s; no new trackers to merge", server, t.Name)
+		} else {
+			logger.Infof("already present on %s: %s; merged %d new tracker(s)", server, t.Name, len(added))
+		}
+		return history.ResultMerged, nil, nil
+	case config.DuplicateForce:
+		replaced, err := keepForRestore(qb, t, logger)
+		if err != nil {
+			return "", nil, err
+		}
+		logger.Warnf("already present on %s: %s; removing it (data kept) to add again", server, t.Name)
+		if err := qb.Delete([]string{hash}, false); err != nil {
+			return "", nil, fmt.Errorf("remove existing torrent: %w", err)
+		}
+		if err := waitRemoved(qb, hash); err != nil {
+			return "", nil, err
+		}
+		return "", replaced, nil
+	default:
+		logger.Infof("already present on %s: %s [%s]; not adding again", server, t.Name, hash)
+		return history.ResultDuplicate, nil, nil
+	}
+}
+
+// replacedTorrent is a torrent the force policy removed before adding it
+// again, with what is needed to add it back.
+type replacedTorrent struct {
+	torrent qbclient.Torrent
+	// file is its exported .torrent; nil falls back to the magnet link.
+	file []byte
+}
+
+// keepForRestore exports t so it can be put back if the re-add fails, and
+// refuses to go on when there is no way to.
+func keepForRestore(qb qbClient, t qbclient.Torrent, logger *logging.Logger) (*replacedTorrent, error) {
+	r := &replacedTorrent{torrent: t}
+	if !t.IsMetadataPending() {
+		data, err := qb.ExportTorrent(t.Hash)
+		if err == nil {
+			r.file = data
+			return r, nil
+		}
+		logger.Debugf("export %s: %v; keeping its magnet link instead", t.Name, err)
+	}
+	if t.MagnetURI == "" {
+		return nil, fmt.Errorf("cannot keep a copy of %s to restore; not removing it", t.Name)
+	}
+	return r, nil
+}
+
+// inherit fills in the settings opts leaves unset from the replaced torrent,
+// so a forced re-add keeps its category, tags, save path and limits.
+func (r *replacedTorrent) inherit(opts qbclient.AddOptions) qbclient.AddOptions {
+	old := addOptionsFromEntry(entryFromTorrent(r.torrent))
+	if opts.Category == "" {
+		opts.Category = old.Category
+	}
+	if opts.SavePath == "" {
+		opts.SavePath = old.SavePath
+	}
+	if opts.UpLimit == 0 {
+		opts.UpLimit = old.UpLimit
+	}
+	if opts.DlLimit == 0 {
+		opts.DlLimit = old.DlLimit
+	}
+	if opts.RatioLimit == nil {
+		opts.RatioLimit = old.RatioLimit
+	}
+	if opts.SeedingTimeLimit == nil {
+		opts.SeedingTimeLimit = old.SeedingTimeLimit
+	}
+	tags := append([]string{}, old.Tags...)
+	for _, tag := range opts.Tags {
+		if !containsTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	opts.Tags = tags
+	return opts
+}
+
+// restore adds the replaced torrent back as it was, after the add meant to
+// replace it failed.
+func (r *replacedTorrent) restore(qb qbClient) error {
+	opts := addOptionsFromEntry(entryFromTorrent(r.torrent))
+	if r.file != nil {
+		return qb.AddTorrentFile(r.torrent.Hash+".torrent", r.file, opts)
+	}
+	return qb.AddMagnetWithOptions(r.torrent.MagnetURI, opts)
+}
+
+// mergeTrackers adds the trackers that the existing torrent lacks.
+func mergeTrackers(qb qbClient, trackers []string, hash string) ([]string, error) {
+	current, err := qb.Trackers(hash)
+	if err != nil {
+		return nil, fmt.Errorf("list trackers: %w", err)
+	}
+	known := map[string]bool{}
+	for _, tr := range current {
+		known[strings.TrimSpace(tr.URL)] = true
+	}
+
+	var added []string
+	for _, u := range trackers {
+		if !known[u] {
+			known[u] = true
+			added = append(added, u)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	if err := qb.AddTrackers(hash, added); err != nil {
+		return nil, fmt.Errorf("add trackers: %w", err)
+	}
+	return added, nil
+}
+
+// waitRemoved polls until qBittorrent no longer lists hash, since deletion
+// completes asynchronously and an early re-add is rejected.
+func waitRemoved(qb qbClient, hash string) error {
+	deadline := time.Now().Add(duplicateRemoveTimeout)
+	for {
+		remaining, err := qb.Torrents(qbclient.ListOptions{Hashes: []string{hash}})
+		if err != nil {
+			return fmt.Errorf("check removal: %w", err)
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("torrent %s still listed after %s: %w", hash, duplicateRemoveTimeout, errWaitTimeout)
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
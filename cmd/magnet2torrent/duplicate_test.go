@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+const duplicateMagnet = "magnet:?xt=urn:btih:" + testHash + "&dn=debian&tr=udp://a.example:80&tr=udp://b.example:80"
+
+func duplicateStub(t *testing.T) *stubQBClient {
+	stub := &stubQBClient{
+		torrents: []qbclient.Torrent{{Hash: testHash, Name: "debian", State: "uploading", MagnetURI: duplicateMagnet}},
+		trackers: []qbclient.Tracker{{URL: "** [DHT] **"}, {URL: "udp://a.example:80"}},
+	}
+	useStubClient(t, stub)
+	return stub
+}
+
+func TestDuplicateSkip(t *testing.T) {
+	stub := duplicateStub(t)
+	if err := processMagnet(duplicateMagnet, testConfig(), logging.NewLogger("error", ""), addOptions{}); err != nil {
+		t.Fatalf("processMagnet error: %v", err)
+	}
+	if stub.lastMagnet != "" || len(stub.calls) != 0 {
+		t.Fatalf("duplicate should not be sent again: %q %v", stub.lastMagnet, stub.calls)
+	}
+}
+
+func TestDuplicateMergeTrackers(t *testing.T) {
+	stub := duplicateStub(t)
+	opts := addOptions{duplicates: config.DuplicateMerge}
+	if err := processMagnet(duplicateMagnet, testConfig(), logging.NewLogger("error", ""), opts); err != nil {
+		t.Fatalf("processMagnet error: %v", err)
+	}
+	if stub.lastMagnet != "" || strings.Join(stub.calls, ",") != "add-trackers "+testHash {
+		t.Fatalf("expected tracker merge only, got %q %v", stub.lastMagnet, stub.calls)
+	}
+	if len(stub.trackers) != 3 || stub.trackers[2].URL != "udp://b.example:80" {
+		t.Fatalf("expected only the new tracker to be added: %+v", stub.trackers)
+	}
+
+	// A second merge finds nothing new.
+	if err := processMagnet(duplicateMagnet, testConfig(), logging.NewLogger("error", ""), opts); err != nil {
+		t.Fatalf("processMagnet error: %v", err)
+	}
+	if len(stub.calls) != 1 {
+		t.Fatalf("expected no further tracker calls, got %v", stub.calls)
+	}
+}
+
+func TestDuplicateForceReadds(t *testing.T) {
+	shortWaitInterval(t)
+	stub := duplicateStub(t)
+	opts := addOptions{duplicates: config.DuplicateForce}
+	if err := processMagnet(duplicateMagnet, testConfig(), logging.NewLogger("error", ""), opts); err != nil {
+		t.Fatalf("processMagnet error: %v", err)
+	}
+	if strings.Join(stub.calls, ",") != "delete(files=false) "+testHash || stub.lastMagnet != duplicateMagnet {
+		t.Fatalf("expected delete then add, got %v / %q", stub.calls, stub.lastMagnet)
+	}
+}
+
+func TestDuplicateForceKeepsSettings(t *testing.T) {
+	shortWaitInterval(t)
+	stub := duplicateStub(t)
+	stub.torrents[0].Category, stub.torrents[0].Tags, stub.torrents[0].UpLimit = "linux", "keep", 1024
+	stub.exports = map[string][]byte{testHash: []byte("d1:ae")}
+	opts := addOptions{duplicates: config.DuplicateForce, add: qbclient.AddOptions{Tags: []string{"new"}}}
+	if err := processMagnet(duplicateMagnet, testConfig(), logging.NewLogger("error", ""), opts); err != nil {
+		t.Fatalf("processMagnet error: %v", err)
+	}
+	got := stub.lastAddOpts
+	if got.Category != "linux" || strings.Join(got.Tags, ",") != "keep,new" || got.UpLimit != 1024 {
+		t.Fatalf("re-add lost the old settings: %+v", got)
+	}
+}
+
+func TestDuplicateForceRestoresOnFailedAdd(t *testing.T) {
+	shortWaitInterval(t)
+	stub := duplicateStub(t)
+	stub.torrents[0].Category, stub.torrents[0].SavePath = "linux", "/data/iso"
+	stub.exports = map[string][]byte{testHash: []byte("d1:ae")}
+	stub.addErr = errors.New("rejected")
+	opts := addOptions{duplicates: config.DuplicateForce}
+	if err := processMagnet(duplicateMagnet, testConfig(), logging.NewLogger("error", ""), opts); err == nil {
+		t.Fatalf("expected the failed add to be reported")
+	}
+	if len(stub.added) != 1 || stub.added[0].name != testHash+".torrent" || stub.added[0].opts.Category != "linux" || stub.added[0].opts.SavePath != "/data/iso" {
+		t.Fatalf("removed torrent not put back: %+v", stub.added)
+	}
+
+	// Without an export or a magnet link there is no way back, so the
+	// torrent is left alone.
+	stub = duplicateStub(t)
+	stub.torrents[0].MagnetURI = ""
+	if err := processMagnet(duplicateMagnet, testConfig(), logging.NewLogger("error", ""), opts); err == nil || len(stub.calls) != 0 {
+		t.Fatalf("removed a torrent it could not restore: %v, calls %v", err, stub.calls)
+	}
+}
+
+func TestDuplicatePolicyValidation(t *testing.T) {
+	duplicateStub(t)
+	err := processMagnet(duplicateMagnet, testConfig(), logging.NewLogger("error", ""), addOptions{duplicates: "replace"})
+	if err == nil || !strings.Contains(err.Error(), `duplicate policy "replace" is invalid`) {
+		t.Fatalf("expected policy error, got %v", err)
+	}
+}
+
+func TestAddRejectedIsReported(t *testing.T) {
+	stub := &stubQBClient{addErr: qbclient.ErrAddRejected}
+	useStubClient(t, stub)
+	err := processMagnet("magnet:?xt=urn:btih:example", testConfig(), logging.NewLogger("error", ""), addOptions{})
+	if !errors.Is(err, qbclient.ErrAddRejected) {
+		t.Fatalf("expected ErrAddRejected, got %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/history"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// newHistoryEntry describes handling item on server with opts.
+func newHistoryEntry(item addItem, server string, opts addOptions) history.Entry {
+	e := history.Entry{
+		Time:     time.Now().UTC(),
+		Source:   item.source,
+		InfoHash: item.hash,
+		Name:     item.name,
+		Server:   server,
+		Options: history.Options{
+			Category:      opts.add.Category,
+			Tags:          opts.add.Tags,
+			SavePath:      opts.add.SavePath,
+			Stopped:       opts.add.Stopped,
+			ContentLayout: opts.add.ContentLayout,
+			SkipChecking:  opts.add.SkipChecking,
+			Rename:        opts.add.Rename,
+			OnDuplicate:   opts.duplicates,
+		},
+	}
+	if isLink(item.value) {
+		e.Magnet = item.value
+	} else if abs, err := filepath.Abs(item.value); err == nil {
+		e.File = abs
+	} else {
+		e.File = item.value
+	}
+	return e
+}
+
+// recordHistory appends e, marking it failed when err is set. History is
+// best-effort: a write failure is logged but never fails the add itself.
+func recordHistory(cfg *config.Config, e history.Entry, err error, logger *logging.Logger) {
+	if cfg.HistoryFile == "" {
+		return
+	}
+	if err != nil {
+		e.Result, e.Error = history.ResultFailed, err.Error()
+	}
+	if werr := history.NewStore(cfg.HistoryFile).Append(e); werr != nil {
+		logger.Warnf("could not record history: %v", werr)
+	}
+}
+
+// noteEarlierAdd mentions when hash was added to server before but is gone
+// now, so re-adding a removed torrent does not go unnoticed.
+func noteEarlierAdd(cfg *config.Config, hash, server string, logger *logging.Logger) {
+	if cfg.HistoryFile == "" {
+		return
+	}
+	entries, err := history.NewStore(cfg.HistoryFile).Load()
+	if err != nil {
+		logger.Debugf("history unavailable: %v", err)
+		return
+	}
+	if e, ok := history.LastAdded(entries, hash, server); ok {
+		logger.Infof("%s was added to %s on %s but is no longer there; adding it again", hash, server, e.Time.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+func runHistory(args []string, cfg *config.Config, logger *logging.Logger) error {
+	action := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	if cfg.HistoryFile == "" {
+		return errors.New("history is disabled; set historyFile in config")
+	}
+	store := history.NewStore(cfg.HistoryFile)
+
+	switch action {
+	case "list", "export":
+		return runHistoryList(action, args, store)
+	case "resend":
+		return runHistoryResend(args, store, cfg, logger)
+	default:
+		return usageErrorf("unknown history action %q; usage: magnet2torrent history [list|export|resend] ...", action)
+	}
+}
+
+func runHistoryList(action string, args []string, store *history.Store) error {
+	defaultFormat := "table"
+	if action == "export" {
+		defaultFormat = "json"
+	}
+
+	fs := flag.NewFlagSet("history "+action, flag.ContinueOnError)
+	var (
+		filter history.Filter
+		since  = fs.String("since", "", "only entries newer than a duration (24h) or date (2006-01-02)")
+		limit  = fs.Int("limit", 0, "only the most recent N entries")
+		format = fs.String("format", defaultFormat, "output format: table, json or csv")
+		output = fs.String("o", "-", "file to write (- for stdout)")
+	)
+	fs.StringVar(&filter.Query, "q", "", "search names, info-hashes and magnet links")
+	fs.StringVar(&filter.Hash, "hash", "", "info-hash or prefix")
+	fs.StringVar(&filter.Server, "server", "", "only entries sent to this server profile")
+	fs.StringVar(&filter.Result, "result", "", "only entries with this result: added, duplicate, merged or failed")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *since != "" {
+		t, err := parseSince(*since, time.Now())
+		if err != nil {
+			return err
+		}
+		filter.Since = t
+	}
+	if fs.NArg() > 0 && filter.Query == "" {
+		filter.Query = strings.Join(fs.Args(), " ")
+	}
+
+	entries, err := store.Load()
+	if err != nil {
+		return err
+	}
+	entries = history.Select(entries, filter)
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("create %s: %w", *output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+	return renderHistory(out, *format, entries)
+}
+
+// parseSince accepts a duration back from now or a calendar date.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid -since %q; use a duration like 48h or a date like 2006-01-02", s)
+}
+
+func renderHistory(w io.Writer, format string, entries []history.Entry) error {
+	switch format {
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tSERVER\tRESULT\tNAME\tHASH")
+		for _, e := range entries {
+			name := e.Name
+			if name == "" {
+				name = e.Magnet
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format("2006-01-02 15:04"), e.Server, e.Result, truncate(name, 50), e.InfoHash)
+		}
+		return tw.Flush()
+	case "json":
+		if entries == nil {
+			entries = []history.Entry{}
+		}
+		return writeJSON(w, entries)
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"time", "source", "server", "result", "infoHash", "name", "category", "tags", "savePath", "error", "magnet"})
+		for _, e := range entries {
+			_ = cw.Write([]string{
+				e.Time.Format(time.RFC3339),
+				e.Source,
+				e.Server,
+				e.Result,
+				e.InfoHash,
+				e.Name,
+				e.Options.Category,
+				strings.Join(e.Options.Tags, ","),
+				e.Options.SavePath,
+				e.Error,
+				e.Magnet,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown format %q; use table, json or csv", format)
+	}
+}
+
+func runHistoryResend(args []string, store *history.Store, cfg *config.Config, logger *logging.Logger) error {
+	fs := flag.NewFlagSet("history resend", flag.ContinueOnError)
+	var (
+		to        = fs.String("to", "", "server profile to send to (default: the one recorded)")
+		duplicate = fs.String("on-duplicate", "", "duplicate policy: skip, merge or force (default: the one recorded)")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("usage: magnet2torrent history resend [-to server] [-on-duplicate policy] <info-hash>")
+	}
+
+	entries, err := store.Load()
+	if err != nil {
+		return err
+	}
+	e, err := latestEntry(entries, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	opts := addOptions{
+		createCategory: cfg.AutoCreateCategory,
+		duplicates:     e.Options.OnDuplicate,
+		add: qbclient.AddOptions{
+			Category:      e.Options.Category,
+			Tags:          e.Options.Tags,
+			SavePath:      e.Options.SavePath,
+			Stopped:       e.Options.Stopped,
+			ContentLayout: e.Options.ContentLayout,
+			SkipChecking:  e.Options.SkipChecking,
+			Rename:        e.Options.Rename,
+		},
+	}
+	if *duplicate != "" {
+		opts.duplicates = *duplicate
+	}
+	if opts.duplicates == "" {
+		opts.duplicates = cfg.DuplicatePolicy
+	}
+
+	server := e.Server
+	if *to != "" {
+		server = *to
+	}
+	input := batchInput{value: e.Magnet, source: sourceResend}
+	if input.value == "" {
+		input.value = e.File
+	}
+	serverCfg := *cfg
+	serverCfg.DefaultServer = server
+	return processInputs([]batchInput{input}, &serverCfg, logger, opts, 1)[0].err
+}
+
+// latestEntry finds the most recent entry whose info-hash starts with prefix,
+// refusing prefixes that match more than one torrent.
+func latestEntry(entries []history.Entry, prefix string) (history.Entry, error) {
+	matches := history.Select(entries, history.Filter{Hash: prefix})
+	if len(matches) == 0 {
+		return history.Entry{}, fmt.Errorf("no history entry for %q", prefix)
+	}
+	last := matches[len(matches)-1]
+	for _, m := range matches {
+		if m.InfoHash != last.InfoHash {
+			return history.Entry{}, fmt.Errorf("%q matches several torrents; give more of the info-hash", prefix)
+		}
+	}
+	return last, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"magnet2torrent/internal/history"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func TestProcessMagnetRecordsHistory(t *testing.T) {
+	stub := &stubQBClient{}
+	useStubClient(t, stub)
+	logger := logging.NewLogger("error", "")
+	cfg := testConfig()
+	cfg.HistoryFile = filepath.Join(t.TempDir(), "history.jsonl")
+	link := "magnet:?xt=urn:btih:" + testHash + "&dn=debian"
+
+	opts := addOptions{add: qbclient.AddOptions{Category: "linux"}}
+	if err := processMagnet(link, cfg, logger, opts); err != nil {
+		t.Fatalf("processMagnet error: %v", err)
+	}
+	stub.torrents = []qbclient.Torrent{{Hash: testHash, Name: "debian"}}
+	if err := processMagnet(link, cfg, logger, opts); err != nil {
+		t.Fatalf("processMagnet error: %v", err)
+	}
+	stub.torrents, stub.addErr = nil, errors.New("boom")
+	if err := processMagnet(link, cfg, logger, opts); err == nil {
+		t.Fatalf("expected add error")
+	}
+
+	entries, err := history.NewStore(cfg.HistoryFile).Load()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("Load() = %+v, %v", entries, err)
+	}
+	var results []string
+	for _, e := range entries {
+		results = append(results, e.Result)
+	}
+	if got := strings.Join(results, ","); got != "added,duplicate,failed" {
+		t.Fatalf("results = %s", got)
+	}
+	first := entries[0]
+	if first.Source != sourceCLI || first.InfoHash != testHash || first.Name != "debian" || first.Server != "default" || first.Options.Category != "linux" {
+		t.Fatalf("unexpected entry: %+v", first)
+	}
+	if !strings.Contains(entries[2].Error, "boom") {
+		t.Fatalf("error not recorded: %+v", entries[2])
+	}
+
+	// Re-sending replays the recorded options.
+	stub.addErr = nil
+	stub.lastAddOpts = qbclient.AddOptions{}
+	if err := runHistory([]string{"resend", testHash[:8]}, cfg, logger); err != nil {
+		t.Fatalf("history resend error: %v", err)
+	}
+	if stub.lastMagnet != link || stub.lastAddOpts.Category != "linux" {
+		t.Fatalf("resend sent %q with %+v", stub.lastMagnet, stub.lastAddOpts)
+	}
+	entries, _ = history.NewStore(cfg.HistoryFile).Load()
+	if last := entries[len(entries)-1]; last.Source != sourceResend || last.Result != history.ResultAdded {
+		t.Fatalf("resend not recorded: %+v", last)
+	}
+}
+
+func TestRenderHistoryFormats(t *testing.T) {
+	entries := []history.Entry{{
+		Time:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Source:   sourceCLI,
+		Magnet:   "magnet:?xt=urn:btih:aaa",
+		InfoHash: "aaa",
+		Name:     "debian",
+		Server:   "home",
+		Options:  history.Options{Category: "linux", Tags: []string{"a", "b"}},
+		Result:   history.ResultAdded,
+	}}
+
+	var buf bytes.Buffer
+	if err := renderHistory(&buf, "csv", entries); err != nil {
+		t.Fatalf("csv error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || lines[1] != `2024-05-01T12:00:00Z,cli,home,added,aaa,debian,linux,"a,b",,,magnet:?xt=urn:btih:aaa` {
+		t.Fatalf("unexpected csv:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := renderHistory(&buf, "json", nil); err != nil || strings.TrimSpace(buf.String()) != "[]" {
+		t.Fatalf("empty json = %q, %v", buf.String(), err)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	if got, err := parseSince("48h", now); err != nil || !got.Equal(now.Add(-48*time.Hour)) {
+		t.Fatalf("parseSince(48h) = %v, %v", got, err)
+	}
+	if got, err := parseSince("2024-05-01", now); err != nil || got.Day() != 1 {
+		t.Fatalf("parseSince(date) = %v, %v", got, err)
+	}
+	if _, err := parseSince("last week", now); err == nil {
+		t.Fatalf("expected error for invalid -since")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// lifecycleAction describes one torrent control subcommand.
+type lifecycleAction struct {
+	summary     string
+	destructive bool
+	apply       func(qb qbClient, hashes []string, flags lifecycleFlags) error
+}
+
+type lifecycleFlags struct {
+	deleteFiles bool
+	off         bool
+}
+
+var lifecycleActions = map[string]lifecycleAction{
+	"stop": {
+		summary: "stop (pause) torrents",
+		apply:   func(qb qbClient, h []string, _ lifecycleFlags) error { return qb.Stop(h) },
+	},
+	"start": {
+		summary: "start (resume) torrents",
+		apply:   func(qb qbClient, h []string, _ lifecycleFlags) error { return qb.Start(h) },
+	},
+	"delete": {
+		summary:     "remove torrents, optionally with their files",
+		destructive: true,
+		apply:       func(qb qbClient, h []string, f lifecycleFlags) error { return qb.Delete(h, f.deleteFiles) },
+	},
+	"recheck": {
+		summary: "re-verify downloaded data",
+		apply:   func(qb qbClient, h []string, _ lifecycleFlags) error { return qb.Recheck(h) },
+	},
+	"reannounce": {
+		summary: "announce to trackers now",
+		apply:   func(qb qbClient, h []string, _ lifecycleFlags) error { return qb.Reannounce(h) },
+	},
+	"force-start": {
+		summary: "force start torrents, ignoring queue limits",
+		apply:   func(qb qbClient, h []string, f lifecycleFlags) error { return qb.SetForceStart(h, !f.off) },
+	},
+}
+
+// lifecycleAliases keeps the pre-5.0 qBittorrent verbs working.
+var lifecycleAliases = map[string]string{
+	"pause":  "stop",
+	"resume": "start",
+}
+
+// confirmFunc asks the user to confirm a destructive action; tests replace it.
+var confirmFunc = promptConfirm
+
+func lifecycleCommand(name string) commandFunc {
+	return func(args []string, cfg *config.Config, logger *logging.Logger) error {
+		return runLifecycle(name, args, cfg, logger)
+	}
+}
+
+func runLifecycle(name string, args []string, cfg *config.Config, logger *logging.Logger) error {
+	if canonical, ok := lifecycleAliases[name]; ok {
+		name = canonical
+	}
+	action, ok := lifecycleActions[name]
+	if !ok {
+		return fmt.Errorf("unknown action %q", name)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	var (
+		category = fs.String("category", "", "target torrents in this category")
+		tag      = fs.String("tag", "", "target torrents with this tag")
+		all      = fs.Bool("all", false, "target every torrent")
+		yes      = fs.Bool("yes", false, "do not ask for confirmation")
+		flags    lifecycleFlags
+	)
+	if name == "delete" {
+		fs.BoolVar(&flags.deleteFiles, "delete-files", false, "also delete downloaded data")
+	}
+	if name == "force-start" {
+		fs.BoolVar(&flags.off, "off", false, "clear force start instead of setting it")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: magnet2torrent %s [flags] [hash|name-glob ...]\n\n%s. Targets are matched by info-hash or by shell-style glob on the name (case-insensitive).\n\n", name, action.summary)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	patterns := fs.Args()
+	if len(patterns) == 0 && *category == "" && *tag == "" && !*all {
+		fs.Usage()
+		return errors.New("select torrents by hash, name glob, -category, -tag or -all")
+	}
+
+	qb, _, err := connect(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	targets, err := selectTorrents(qb, patterns, *category, *tag)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return errors.New("no torrents match")
+	}
+
+	if action.destructive && !*yes {
+		what := "Delete"
+		if flags.deleteFiles {
+			what = "Delete (with files)"
+		}
+		ok, err := confirmFunc(fmt.Sprintf("%s %d torrent(s):\n%s\nContinue?", what, len(targets), describeTorrents(targets)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("aborted")
+		}
+	}
+
+	hashes := make([]string, 0, len(targets))
+	for _, t := range targets {
+		hashes = append(hashes, t.Hash)
+	}
+	if err := action.apply(qb, hashes, flags); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	logger.Infof("%s: applied to %d torrent(s)", name, len(hashes))
+	return nil
+}
+
+// selectTorrents lists torrents in category/tag and keeps those matching any
+// pattern (info-hash or name glob). Without patterns every listed torrent is
+// selected.
+func selectTorrents(qb qbClient, patterns []string, category, tag string) ([]qbclient.Torrent, error) {
+	torrents, err := qb.Torrents(qbclient.ListOptions{Category: category, Tag: tag})
+	if err != nil {
+		return nil, fmt.Errorf("list torrents: %w", err)
+	}
+	if len(patterns) == 0 {
+		return torrents, nil
+	}
+
+	for _, p := range patterns {
+		if _, err := path.Match(strings.ToLower(p), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+
+	var out []qbclient.Torrent
+	for _, t := range torrents {
+		for _, p := range patterns {
+			if strings.EqualFold(t.Hash, p) {
+				out = append(out, t)
+				break
+			}
+			if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(t.Name)); ok {
+				out = append(out, t)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func describeTorrents(torrents []qbclient.Torrent) string {
+	lines := make([]string, 0, len(torrents))
+	for _, t := range torrents {
+		lines = append(lines, fmt.Sprintf("  %s  %s", t.Hash, t.Name))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// promptConfirm asks a yes/no question on the terminal. Without a TTY it
+// refuses, so scripts must pass -yes explicitly.
+func promptConfirm(question string) (bool, error) {
+	if !isInteractive() {
+		return false, errors.New("confirmation required; re-run with -yes")
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
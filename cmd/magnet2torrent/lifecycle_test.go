@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func lifecycleStub(t *testing.T) *stubQBClient {
+	t.Helper()
+	stub := &stubQBClient{torrents: []qbclient.Torrent{
+		{Hash: "aaa", Name: "Debian-12.iso", Category: "linux"},
+		{Hash: "bbb", Name: "debian-11.iso", Category: "linux"},
+		{Hash: "ccc", Name: "holiday.mkv"},
+	}}
+	useStubClient(t, stub)
+	return stub
+}
+
+func testConfig() *config.Config {
+	return &config.Config{QbHost: "http://example.test", QbUsername: "admin", QbPassword: "password"}
+}
+
+func TestRunLifecycleGlobAndHash(t *testing.T) {
+	stub := lifecycleStub(t)
+	logger := logging.NewLogger("error", "")
+
+	if err := runLifecycle("pause", []string{"debian-*"}, testConfig(), logger); err != nil {
+		t.Fatalf("pause error: %v", err)
+	}
+	if err := runLifecycle("force-start", []string{"-off", "CCC"}, testConfig(), logger); err != nil {
+		t.Fatalf("force-start error: %v", err)
+	}
+
+	want := []string{"stop aaa|bbb", "force-start(false) ccc"}
+	if strings.Join(stub.calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("calls = %v, want %v", stub.calls, want)
+	}
+
+	if err := runLifecycle("recheck", nil, testConfig(), logger); err == nil {
+		t.Fatalf("expected error without a selection")
+	}
+	if err := runLifecycle("recheck", []string{"nothing*"}, testConfig(), logger); err == nil {
+		t.Fatalf("expected error when nothing matches")
+	}
+}
+
+func TestRunLifecycleDeleteConfirmation(t *testing.T) {
+	stub := lifecycleStub(t)
+	logger := logging.NewLogger("error", "")
+
+	origConfirm := confirmFunc
+	t.Cleanup(func() { confirmFunc = origConfirm })
+
+	var asked string
+	confirmFunc = func(q string) (bool, error) {
+		asked = q
+		return false, nil
+	}
+	if err := runLifecycle("delete", []string{"-delete-files", "holiday*"}, testConfig(), logger); err == nil || !strings.Contains(err.Error(), "aborted") {
+		t.Fatalf("expected abort, got %v", err)
+	}
+	if !strings.Contains(asked, "with files") || !strings.Contains(asked, "holiday.mkv") {
+		t.Fatalf("unexpected confirmation prompt: %q", asked)
+	}
+	if len(stub.calls) != 0 {
+		t.Fatalf("nothing should be deleted after declining, got %v", stub.calls)
+	}
+
+	confirmFunc = func(string) (bool, error) {
+		t.Fatalf("-yes should skip confirmation")
+		return false, nil
+	}
+	if err := runLifecycle("delete", []string{"-yes", "-category", "linux"}, testConfig(), logger); err != nil {
+		t.Fatalf("delete error: %v", err)
+	}
+	if len(stub.calls) != 1 || stub.calls[0] != "delete(files=false) aaa|bbb" {
+		t.Fatalf("unexpected calls: %v", stub.calls)
+	}
+}
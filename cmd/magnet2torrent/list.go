@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// etaInfinity is the value qBittorrent reports when no ETA is known.
+const etaInfinity = 8640000
+
+func runList(args []string, cfg *config.Config, logger *logging.Logger) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	var (
+		filter   = fs.String("filter", "", "state filter: all, downloading, seeding, completed, paused, active, inactive, stalled, errored")
+		category = fs.String("category", "", "only torrents in this category")
+		tag      = fs.String("tag", "", "only torrents with this tag")
+		sortBy   = fs.String("sort", "", "sort by field, e.g. name, size, progress, added_on")
+		reverse  = fs.Bool("reverse", false, "reverse the sort order")
+		hashes   = fs.String("hash", "", "comma-separated info-hashes to show")
+		limit    = fs.Int("limit", 0, "maximum number of torrents to show")
+		mine     = fs.Bool("mine", false, "only torrents added by magnet2torrent (tagged with addedTag)")
+		format   = fs.String("format", "table", "output format: table, json or csv")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	opts := qbclient.ListOptions{
+		Filter:   *filter,
+		Category: *category,
+		Tag:      *tag,
+		Sort:     *sortBy,
+		Reverse:  *reverse,
+		Limit:    *limit,
+		Hashes:   splitList(*hashes),
+	}
+	if *mine {
+		if cfg.AddedTag == "" {
+			return errors.New("-mine needs addedTag to be set in config")
+		}
+		if opts.Tag != "" && opts.Tag != cfg.AddedTag {
+			return fmt.Errorf("-mine filters on tag %q and cannot be combined with -tag %q", cfg.AddedTag, opts.Tag)
+		}
+		opts.Tag = cfg.AddedTag
+	}
+
+	qb, _, err := connect(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	torrents, err := qb.Torrents(opts)
+	if err != nil {
+		return fmt.Errorf("list torrents: %w", err)
+	}
+
+	return renderTorrents(os.Stdout, *format, torrents)
+}
+
+func renderTorrents(w io.Writer, format string, torrents []qbclient.Torrent) error {
+	switch format {
+	case "table", "":
+		return renderTorrentTable(w, torrents)
+	case "json":
+		if torrents == nil {
+			torrents = []qbclient.Torrent{}
+		}
+		return writeJSON(w, torrents)
+	case "csv":
+		return renderTorrentCSV(w, torrents)
+	default:
+		return fmt.Errorf("unknown format %q; use table, json or csv", format)
+	}
+}
+
+func renderTorrentTable(w io.Writer, torrents []qbclient.Torrent) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSIZE\tPROGRESS\tSTATE\tDOWN\tUP\tETA\tRATIO\tCATEGORY")
+	for _, t := range torrents {
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%s\t%s/s\t%s/s\t%s\t%.2f\t%s\n",
+			truncate(t.Name, 50),
+			formatBytes(t.Size),
+			t.Progress*100,
+			t.State,
+			formatBytes(t.DlSpeed),
+			formatBytes(t.UpSpeed),
+			formatETA(t.ETA),
+			t.Ratio,
+			t.Category,
+		)
+	}
+	return tw.Flush()
+}
+
+func renderTorrentCSV(w io.Writer, torrents []qbclient.Torrent) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"hash", "name", "size", "progress", "state", "dlspeed", "upspeed", "eta", "ratio", "category", "tags"})
+	for _, t := range torrents {
+		_ = cw.Write([]string{
+			t.Hash,
+			t.Name,
+			strconv.FormatInt(t.Size, 10),
+			strconv.FormatFloat(t.Progress, 'f', 4, 64),
+			t.State,
+			strconv.FormatInt(t.DlSpeed, 10),
+			strconv.FormatInt(t.UpSpeed, 10),
+			strconv.FormatInt(t.ETA, 10),
+			strconv.FormatFloat(t.Ratio, 'f', 3, 64),
+			t.Category,
+			t.Tags,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func formatETA(seconds int64) string {
+	if seconds < 0 || seconds >= etaInfinity {
+		return "∞"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
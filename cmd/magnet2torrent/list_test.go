@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func sampleTorrents() []qbclient.Torrent {
+	return []qbclient.Torrent{
+		{Hash: "aaa", Name: "debian-12.iso", Size: 660 * 1024 * 1024, Progress: 0.5, State: "downloading", DlSpeed: 2048, ETA: 90, Ratio: 0.1, Category: "linux-isos"},
+		{Hash: "bbb", Name: "fedora.iso", Size: 2 * 1024 * 1024 * 1024, Progress: 1, State: "uploading", ETA: etaInfinity, Ratio: 1.5, Tags: "magnet2torrent"},
+	}
+}
+
+func TestRenderTorrentsTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderTorrents(&buf, "table", sampleTorrents()); err != nil {
+		t.Fatalf("renderTorrents error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"NAME", "debian-12.iso", "660.0 MiB", "50.0%", "1m30s", "2.0 GiB", "∞", "linux-isos"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("table output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderTorrentsJSONAndCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderTorrents(&buf, "json", sampleTorrents()); err != nil {
+		t.Fatalf("renderTorrents json error: %v", err)
+	}
+	var decoded []qbclient.Torrent
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 2 || decoded[1].Hash != "bbb" {
+		t.Fatalf("unexpected json output (%v): %s", err, buf.String())
+	}
+
+	buf.Reset()
+	if err := renderTorrents(&buf, "csv", sampleTorrents()); err != nil {
+		t.Fatalf("renderTorrents csv error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "hash,name,size") || !strings.HasPrefix(lines[1], "aaa,debian-12.iso,692060160,") {
+		t.Fatalf("unexpected csv output:\n%s", buf.String())
+	}
+
+	if err := renderTorrents(&buf, "xml", nil); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
+
+func TestRunListMineUsesAddedTag(t *testing.T) {
+	stub := &stubQBClient{}
+	useStubClient(t, stub)
+
+	cfg := &config.Config{QbHost: "http://example.test", QbUsername: "admin", QbPassword: "password", AddedTag: "magnet2torrent"}
+	if err := runList([]string{"-mine", "-sort", "added_on", "-hash", "aaa,bbb", "-format", "json"}, cfg, logging.NewLogger("error", "")); err != nil {
+		t.Fatalf("runList error: %v", err)
+	}
+	if stub.lastList.Tag != "magnet2torrent" || stub.lastList.Sort != "added_on" || len(stub.lastList.Hashes) != 2 {
+		t.Fatalf("unexpected list options: %+v", stub.lastList)
+	}
+
+	cfg.AddedTag = ""
+	if err := runList([]string{"-mine"}, cfg, logging.NewLogger("error", "")); err == nil {
+		t.Fatalf("expected error when addedTag is disabled")
+	}
+}
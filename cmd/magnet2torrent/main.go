@@ -5,11 +5,15 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/history"
 	"magnet2torrent/internal/logging"
 	"magnet2torrent/internal/qbclient"
 )
@@ -21,13 +25,18 @@ func main() {
 
 	var (
 		configPathFlag = flag.String("config", defaultConfigPath, "path to config file")
+		serverFlag     = flag.String("server", "", "name of the server profile to use (default: defaultServer or qbHost)")
 		versionFlag    = flag.Bool("version", false, "print version and exit")
 		versionShort   = flag.Bool("v", false, "print version and exit (shorthand)")
 	)
+	globalAddFlags.register(flag.CommandLine)
 
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "magnet2torrent - placeholder CLI for magnet handling\n\n")
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n  magnet2torrent [flags] [magnet]\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n  magnet2torrent [flags] [magnet|file.torrent|- ...]\n  magnet2torrent [flags] <command> [command flags]\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Commands:\n")
+		printCommands(flag.CommandLine.Output())
+		fmt.Fprintf(flag.CommandLine.Output(), "\nRun \"magnet2torrent <command> -h\" for a command's flags.\n\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "Flags:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(flag.CommandLine.Output(), "\nDefault config path: %s\n", defaultConfigPath)
@@ -41,33 +50,90 @@ func main() {
 	}
 
 	configPath := filepath.Clean(*configPathFlag)
-	cfg, usedDefaults, err := config.LoadConfig(configPath)
+	configFilePath = configPath
+	if *serverFlag != "" {
+		configFlags = append(configFlags, config.Flag{Name: "-server", Key: "defaultServer", Value: *serverFlag})
+	}
+	cfg, found, err := config.Load(configSources())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitConfig)
 	}
+	usedDefaults := !found
 
 	logger := logging.NewLogger(cfg.LogLevel, cfg.LogFile)
 
-	if usedDefaults || needsQBConfig(cfg) {
+	args := flag.Args()
+	command, isCommand := lookupCommand(args)
+	if isCommand {
+		// Keep stdout clean for command output.
+		logger.SetConsole(os.Stderr)
+	}
+	// Apply the mode early so the config prompt and commands honour it too.
+	if err := applyOutputMode(globalAddFlags.output, logger, &watchOptions{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+
+	// Completion output ends up in the shell prompt; config problems are
+	// reported by the command that is being completed.
+	if !(isCommand && completionCommands[args[0]]) {
+		configErr := checkConfig(configPath, cfg, logger)
+		if configErr == nil {
+			configErr = checkPermissions(cfg, logger)
+		}
+		if configErr != nil && !(isCommand && offlineCommands[args[0]]) {
+			os.Exit(exitConfig)
+		}
+	}
+
+	if (usedDefaults || needsQBConfig(cfg)) && !(isCommand && offlineCommands[args[0]]) {
 		if !isInteractive() {
-			logger.Errorf("config missing and no TTY available; create %s manually with qbHost/qbUsername/qbPassword", configPath)
-			os.Exit(1)
+			logger.Errorf("config missing and no TTY available; create %s manually with qbHost/qbUsername/qbPassword (%v)", configPath, validateQBConfig(cfg))
+			os.Exit(exitConfig)
 		}
 		if err := promptAndSaveConfig(configPath, cfg, logger); err != nil {
 			logger.Errorf("failed to save config: %v", err)
-			os.Exit(1)
+			os.Exit(exitConfig)
 		}
 	}
 
-	args := flag.Args()
+	if isCommand {
+		if err := command(args[1:], cfg, logger); err != nil {
+			if !errors.Is(err, flag.ErrHelp) {
+				logger.Errorf("%s: %v", args[0], err)
+			}
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	results, err := addInputs(args, globalAddFlags, cfg, logger)
+	if err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(exitCode(err))
+	}
+
 	magnet := "<none provided>"
-	if len(args) > 0 {
-		magnet = args[0]
-		if err := processMagnet(magnet, cfg, logger); err != nil {
-			logger.Errorf("failed to process magnet: %v", err)
-			os.Exit(1)
+	if len(results) > 0 {
+		magnet = results[0].input
+		if len(results) > 1 {
+			magnet = fmt.Sprintf("%d inputs", len(results))
 		}
+		if len(results) == 1 {
+			if err := results[0].err; err != nil {
+				logger.Errorf("failed to process magnet: %v", err)
+			}
+		} else {
+			summarize(results, logger)
+		}
+		if code := batchExitCode(results); code != exitOK {
+			os.Exit(code)
+		}
+	}
+
+	if globalAddFlags.output != outputText {
+		return
 	}
 
 	fmt.Printf("magnet2torrent wired and running\n")
@@ -82,61 +148,441 @@ func main() {
 
 type qbClient interface {
 	Login() error
-	AddMagnet(string) error
+	AddMagnetWithOptions(string, qbclient.AddOptions) error
+	Torrents(qbclient.ListOptions) ([]qbclient.Torrent, error)
+	TorrentByHash(string) (*qbclient.Torrent, error)
+	Files(string) ([]qbclient.File, error)
+	SyncMainData(int64) (*qbclient.MainData, error)
+	Capabilities() (*qbclient.Capabilities, error)
+	Categories() (map[string]qbclient.Category, error)
+	CreateCategory(string, string) error
+	EditCategory(string, string) error
+	RemoveCategories([]string) error
+	Tags() ([]string, error)
+	CreateTags([]string) error
+	DeleteTags([]string) error
+	Preferences() (map[string]any, error)
+	SetPreferences(map[string]any) error
+	ExportTorrent(string) ([]byte, error)
+	AddTorrentFile(string, []byte, qbclient.AddOptions) error
+	Trackers(string) ([]qbclient.Tracker, error)
+	AddTrackers(string, []string) error
+	Stop([]string) error
+	Start([]string) error
+	Delete([]string, bool) error
+	Recheck([]string) error
+	Reannounce([]string) error
+	SetForceStart([]string, bool) error
+	QueueTop([]string) error
+	QueueBottom([]string) error
+	QueueUp([]string) error
+	QueueDown([]string) error
 }
 
-var qbClientFactory = func(cfg *config.Config) qbClient {
-	return qbclient.New(cfg.QbHost, cfg.QbUsername, cfg.QbPassword)
+var qbClientFactory = func(srv config.Server, logger *logging.Logger) (qbClient, error) {
+	opts := qbclient.Options{Headers: srv.Headers, Proxy: srv.Proxy, NoAuth: srv.NoAuth(), Logf: logger.Debugf}
+	if srv.BasicAuth != nil {
+		opts.BasicAuthUsername = srv.BasicAuth.Username
+		opts.BasicAuthPassword = srv.BasicAuth.Password
+	}
+	return qbclient.NewWithOptions(srv.Host, srv.Username, srv.Password, opts)
+}
+
+// commandFunc runs a subcommand with the arguments that follow its name.
+type commandFunc func(args []string, cfg *config.Config, logger *logging.Logger) error
+
+// commands maps subcommand names to their handlers. Any other first argument
+// is treated as a magnet link, which is how the registered handler calls us.
+var commands = map[string]commandFunc{
+	"add":         runAdd,
+	"list":        runList,
+	"watch":       runWatch,
+	"stop":        lifecycleCommand("stop"),
+	"pause":       lifecycleCommand("pause"),
+	"start":       lifecycleCommand("start"),
+	"resume":      lifecycleCommand("resume"),
+	"delete":      lifecycleCommand("delete"),
+	"recheck":     lifecycleCommand("recheck"),
+	"reannounce":  lifecycleCommand("reannounce"),
+	"force-start": lifecycleCommand("force-start"),
+	"categories":  runCategories,
+	"tags":        runTags,
+	"apply":       runApply,
+	"backup":      runBackup,
+	"restore":     runRestore,
+	"migrate":     runMigrate,
+	"history":     runHistory,
+	"queue":       runQueue,
+	"servers":     runServers,
+	"config":      runConfig,
+	"register":    runRegister,
+	"doctor":      runDoctor,
+	"serve":       runServe,
+	"completion":  runCompletion,
+	"__complete":  runComplete,
 }
 
-func processMagnet(magnetLink string, cfg *config.Config, logger *logging.Logger) error {
+// commandSummaries lists the commands in the order shown by -h and offered
+// by shell completion. Aliases such as pause/resume are left out.
+var commandSummaries = []struct{ name, summary string }{
+	{"add", "add magnet links, URLs or .torrent files (the default)"},
+	{"list", "show torrents on the qBittorrent server"},
+	{"watch", "follow a torrent's progress until it completes"},
+	{"stop", "stop (pause) torrents"},
+	{"start", "start (resume) torrents"},
+	{"delete", "remove torrents, optionally with -delete-files"},
+	{"recheck", "re-verify downloaded data"},
+	{"reannounce", "announce to trackers now"},
+	{"force-start", "force start torrents (-off to clear)"},
+	{"queue", "show or reorder the download queue"},
+	{"categories", "list|create|edit|remove categories"},
+	{"tags", "list|create|delete tags"},
+	{"apply", "sync categories, tags and preferences from a state file"},
+	{"backup", "export all torrents to an archive"},
+	{"restore", "re-add torrents from a backup archive"},
+	{"migrate", "move torrents from one server profile to another"},
+	{"history", "search, export or re-send previously handled magnets"},
+	{"servers", "list configured server profiles"},
+	{"config", "show, get, set or edit settings"},
+	{"register", "register as the magnet: link handler"},
+	{"doctor", "diagnose config, server and handler problems"},
+	{"serve", "accept magnet links over a local HTTP endpoint"},
+	{"completion", "print a bash, zsh or fish completion script"},
+}
+
+// offlineCommands work without a usable server profile, so a missing config
+// does not trigger the first-run prompt for them.
+var offlineCommands = map[string]bool{
+	"servers":    true,
+	"config":     true,
+	"register":   true,
+	"doctor":     true,
+	"completion": true,
+	"__complete": true,
+}
+
+// completionCommands print shell completion; nothing else may reach the
+// terminal while they run.
+var completionCommands = map[string]bool{
+	"completion": true,
+	"__complete": true,
+}
+
+func printCommands(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	for _, c := range commandSummaries {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+}
+
+func lookupCommand(args []string) (commandFunc, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+	cmd, ok := commands[args[0]]
+	return cmd, ok
+}
+
+// connect validates the selected server profile, builds a client and logs in.
+func connect(cfg *config.Config, logger *logging.Logger) (qbClient, config.Server, error) {
 	if err := validateQBConfig(cfg); err != nil {
-		return err
+		return nil, config.Server{}, withCode(codeConfig, err)
 	}
 
-	qb := qbClientFactory(cfg)
+	srv, err := cfg.Server("")
+	if err != nil {
+		return nil, config.Server{}, withCode(codeConfig, err)
+	}
+
+	qb, err := qbClientFactory(srv, logger)
+	if err != nil {
+		return nil, srv, withCode(codeConfig, fmt.Errorf("qbittorrent client setup failed: %w", err))
+	}
 
 	if err := qb.Login(); err != nil {
-		return fmt.Errorf("qbittorrent login failed: %w", err)
+		return nil, srv, fmt.Errorf("qbittorrent login failed: %w", err)
 	}
+	return qb, srv, nil
+}
+
+// connectServer is connect for a named profile rather than the selected one.
+func connectServer(cfg *config.Config, name string, logger *logging.Logger) (qbClient, config.Server, error) {
+	serverCfg := *cfg
+	serverCfg.DefaultServer = name
+	return connect(&serverCfg, logger)
+}
+
+// addOptions are the command-line settings that apply to adding a magnet.
+type addOptions struct {
+	add            qbclient.AddOptions
+	createCategory bool
+	// duplicates is the config.Duplicate* policy; empty means skip.
+	duplicates    string
+	wait          bool
+	waitTimeout   time.Duration
+	untilComplete bool
+	watch         watchOptions
+}
+
+// processMagnet adds a single magnet link, URL or .torrent file.
+func processMagnet(input string, cfg *config.Config, logger *logging.Logger, opts addOptions) error {
+	results := processInputs([]batchInput{{value: input, source: sourceCLI}}, cfg, logger, opts, 1)
+	return results[0].err
+}
 
-	if err := qb.AddMagnet(magnetLink); err != nil {
-		return fmt.Errorf("could not send magnet to qbittorrent: %w", err)
+// addToServer adds item over an established connection and returns the
+// history result.
+func addToServer(qb qbClient, srv config.Server, item addItem, cfg *config.Config, logger *logging.Logger, opts addOptions) (string, error) {
+	var replaced *replacedTorrent
+	if item.hash != "" {
+		outcome, removed, err := handleDuplicate(qb, item.trackers, item.hash, opts.duplicates, srv.Name, logger)
+		if err != nil {
+			return "", err
+		}
+		if outcome != "" {
+			return outcome, followTorrent(qb, item.hash, opts, logger)
+		}
+		noteEarlierAdd(cfg, item.hash, srv.Name, logger)
+		replaced = removed
+	}
+
+	if opts.createCategory && opts.add.Category != "" {
+		if err := ensureCategory(qb, opts.add.Category, logger); err != nil {
+			return "", err
+		}
+	}
+
+	addOpts := opts.add
+	if replaced != nil {
+		addOpts = replaced.inherit(addOpts)
+	}
+	if cfg.AddedTag != "" {
+		// The implicit tag is best-effort: servers without tag support
+		// still get the magnet, unlike an explicit -tags request.
+		caps, err := qb.Capabilities()
+		if err != nil {
+			return "", fmt.Errorf("query qbittorrent version: %w", err)
+		}
+		if caps.Supports(qbclient.FeatureTags) {
+			if !containsTag(addOpts.Tags, cfg.AddedTag) {
+				addOpts.Tags = append(append([]string{}, addOpts.Tags...), cfg.AddedTag)
+			}
+		} else {
+			logger.Debugf("server lacks tag support; not tagging with %q", cfg.AddedTag)
+		}
+	}
+
+	if item.file != nil {
+		if err := qb.AddTorrentFile(item.fileName(), item.file, addOpts); err != nil {
+			return "", restoreReplaced(qb, replaced, fmt.Errorf("could not send torrent file to qbittorrent: %w", err), logger)
+		}
+		logger.Infof("torrent file %s forwarded to qBittorrent at %s", item.fileName(), srv.Host)
+	} else {
+		if err := qb.AddMagnetWithOptions(item.link, addOpts); err != nil {
+			return "", restoreReplaced(qb, replaced, fmt.Errorf("could not send magnet to qbittorrent: %w", err), logger)
+		}
+		logger.Infof("magnet forwarded to qBittorrent at %s", srv.Host)
 	}
+	return history.ResultAdded, followTorrent(qb, item.hash, opts, logger)
+}
 
-	logger.Infof("magnet forwarded to qBittorrent at %s", cfg.QbHost)
+// restoreReplaced puts back the torrent a forced re-add removed, if any, once
+// that add has failed with addErr, and returns addErr.
+func restoreReplaced(qb qbClient, replaced *replacedTorrent, addErr error, logger *logging.Logger) error {
+	if replaced == nil {
+		return addErr
+	}
+	if err := replaced.restore(qb); err != nil {
+		return fmt.Errorf("%w; putting back the removed torrent also failed: %v", addErr, err)
+	}
+	logger.Warnf("put back the removed torrent %s with its previous settings", replaced.torrent.Name)
+	return addErr
+}
+
+// followTorrent runs the -wait and -until-complete steps for hash.
+func followTorrent(qb qbClient, hash string, opts addOptions, logger *logging.Logger) error {
+	if opts.wait {
+		t, err := waitForMetadata(qb, hash, opts.waitTimeout, logger)
+		if err != nil {
+			return err
+		}
+		out := opts.watch.out
+		if out == nil {
+			out = os.Stdout
+		}
+		if err := reportResolved(out, qb, t); err != nil {
+			return err
+		}
+	}
+	if opts.untilComplete {
+		if _, err := watchTorrent(qb, hash, opts.watch, logger); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// validateQBConfig checks the server profile selected by cfg.
 func validateQBConfig(cfg *config.Config) error {
-	if cfg.QbHost == "" {
-		return errors.New("qbittorrent host is empty; set qbHost in config")
+	srv, err := cfg.Server("")
+	if err != nil {
+		return err
+	}
+	return validateServer(srv)
+}
+
+func validateServer(srv config.Server) error {
+	if srv.Host == "" {
+		return fmt.Errorf("qbittorrent host is empty; set %s in config", srv.SettingName("host"))
 	}
-	if cfg.QbUsername == "" {
-		return errors.New("qbittorrent username is empty; set qbUsername in config")
+	switch srv.Auth {
+	case "", config.AuthPassword:
+		if srv.Username == "" {
+			return fmt.Errorf("qbittorrent username is empty; set %s in config (or %s to %q if qBittorrent bypasses auth)", srv.SettingName("username"), srv.SettingName("auth"), config.AuthNone)
+		}
+		if srv.Password == "" {
+			return fmt.Errorf("qbittorrent password is empty; set %s in config", srv.SettingName("password"))
+		}
+	case config.AuthNone:
+	default:
+		return fmt.Errorf("qbittorrent auth mode %q is invalid; set %s to %q or %q", srv.Auth, srv.SettingName("auth"), config.AuthPassword, config.AuthNone)
+	}
+	if err := qbclient.ValidateHost(srv.Host); err != nil {
+		return fmt.Errorf("qbittorrent host is invalid; fix %s in config: %w", srv.SettingName("host"), err)
+	}
+	if srv.Proxy != "" {
+		if err := qbclient.ValidateProxy(srv.Proxy); err != nil {
+			return fmt.Errorf("qbittorrent proxy is invalid; fix %s in config: %w", srv.SettingName("proxy"), err)
+		}
+	}
+	return nil
+}
+
+// checkConfig logs unknown keys as warnings and invalid values as errors,
+// returning an error when there are any of the latter. Offline commands such
+// as `config edit` still run, so the file can be fixed.
+func checkConfig(path string, cfg *config.Config, logger *logging.Logger) error {
+	if from := cfg.MigratedFrom(); from != config.CurrentVersion {
+		logger.Debugf("config %s is version %d, upgraded in memory; `magnet2torrent config migrate` rewrites it", path, from)
+	}
+	warnings, err := cfg.Validate()
+	for _, w := range warnings {
+		logger.Warnf("config %s: %s", path, w)
+	}
+	var invalid *config.ValidationError
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	for _, p := range invalid.Problems {
+		logger.Errorf("config %s: %s", path, p)
+	}
+	return fmt.Errorf("%d invalid setting(s) in %s", len(invalid.Problems), path)
+}
+
+// checkPermissions warns about config files holding passwords that other
+// users can read, or rejects them when filePermissions is "refuse".
+func checkPermissions(cfg *config.Config, logger *logging.Logger) error {
+	if cfg.FilePermissions == config.PermissionsIgnore {
+		return nil
+	}
+	exposed := cfg.ExposedFiles()
+	refuse := cfg.FilePermissions == config.PermissionsRefuse
+	for _, p := range exposed {
+		if refuse {
+			logger.Errorf("config %s", p)
+		} else {
+			logger.Warnf("config %s; run `magnet2torrent config fix-perms`", p)
+		}
 	}
-	if cfg.QbPassword == "" {
-		return errors.New("qbittorrent password is empty; set qbPassword in config")
+	if refuse && len(exposed) > 0 {
+		return fmt.Errorf("%d config file(s) readable by other users; run `magnet2torrent config fix-perms`", len(exposed))
 	}
 	return nil
 }
 
 func needsQBConfig(cfg *config.Config) bool {
-	return cfg.QbHost == "" || cfg.QbUsername == "" || cfg.QbPassword == ""
+	srv, err := cfg.Server("")
+	if err != nil {
+		return false
+	}
+	if srv.NoAuth() {
+		return srv.Host == ""
+	}
+	return srv.Host == "" || srv.Username == "" || srv.Password == ""
+}
+
+// authProber is implemented by clients that can tell whether qBittorrent
+// bypasses authentication for this machine.
+type authProber interface {
+	AuthRequired() (bool, error)
+}
+
+// detectAuthBypass reports whether srv accepts API calls without a login.
+// Probe failures are treated as "auth required" so the prompt carries on.
+func detectAuthBypass(srv config.Server, logger *logging.Logger) bool {
+	srv.Auth = config.AuthNone
+	qb, err := qbClientFactory(srv, logger)
+	if err != nil {
+		return false
+	}
+	prober, ok := qb.(authProber)
+	if !ok {
+		return false
+	}
+	required, err := prober.AuthRequired()
+	return err == nil && !required
 }
 
 func promptAndSaveConfig(configPath string, cfg *config.Config, logger *logging.Logger) error {
+	// Several magnet links opened at once start several of us; one asks.
+	unlock, err := lockConfigFile(promptLockWait, logger)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if current, found, err := config.Load(configSources()); err == nil && found && !needsQBConfig(current) {
+		logger.Infof("config was set up by another magnet2torrent; using it")
+		*cfg = *current
+		return nil
+	}
+	return promptConfig(configPath, cfg, "Config not found or incomplete.", logger)
+}
+
+// promptConfig asks for the selected server's settings, offering the current
+// values as defaults, and saves the result.
+func promptConfig(configPath string, cfg *config.Config, intro string, logger *logging.Logger) error {
+	srv, err := cfg.Server("")
+	if err != nil {
+		return err
+	}
+
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Printf("Config not found or incomplete. Please provide qBittorrent settings.\n")
-	cfg.QbHost = promptValue(reader, "qBittorrent host (e.g. http://localhost:8080)", cfg.QbHost)
-	cfg.QbUsername = promptValue(reader, "qBittorrent username", cfg.QbUsername)
-	cfg.QbPassword = promptValue(reader, "qBittorrent password", cfg.QbPassword)
+	fmt.Printf("%s Please provide qBittorrent settings for server %q.\n", intro, srv.Name)
+	srv.Host = promptValue(reader, "qBittorrent host (e.g. http://localhost:8080)", srv.Host)
 
-	if err := validateQBConfig(cfg); err != nil {
+	if !srv.NoAuth() && srv.Username == "" && detectAuthBypass(srv, logger) {
+		fmt.Printf("qBittorrent accepts requests from this machine without a login; no credentials needed.\n")
+		srv.Auth = config.AuthNone
+	}
+	if !srv.NoAuth() {
+		srv.Username = promptValue(reader, "qBittorrent username", srv.Username)
+		srv.Password = promptValue(reader, "qBittorrent password", srv.Password)
+	}
+
+	if err := validateServer(srv); err != nil {
 		return err
 	}
+	cfg.SetServer(srv)
 
-	if err := config.SaveConfig(configPath, cfg); err != nil {
+	// cfg may carry the system file, variables and flags; save the answers
+	// to the user file alone.
+	fileCfg, _, err := config.LoadUser(configSources())
+	if err != nil {
+		return err
+	}
+	fileCfg.SetServer(srv)
+	if err := saveConfigFile(configPath, fileCfg); err != nil {
 		return err
 	}
 
@@ -159,9 +605,5 @@ func promptValue(reader *bufio.Reader, label string, defaultVal string) string {
 }
 
 func isInteractive() bool {
-	info, err := os.Stdin.Stat()
-	if err != nil {
-		return false
-	}
-	return (info.Mode() & os.ModeCharDevice) != 0
+	return isTerminal(os.Stdin)
 }
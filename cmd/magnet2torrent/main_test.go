@@ -2,35 +2,288 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 
 	"magnet2torrent/internal/config"
 	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
 )
 
 type stubQBClient struct {
-	loginErr   error
-	addErr     error
-	lastMagnet string
+	// mu guards the fields below; batches call the stub from several
+	// goroutines.
+	mu sync.Mutex
+
+	loginErr    error
+	addErr      error
+	lastMagnet  string
+	lastAddOpts qbclient.AddOptions
+	torrents    []qbclient.Torrent
+	lastList    qbclient.ListOptions
+	// byHash is returned in order by TorrentByHash, repeating the last entry.
+	byHash []*qbclient.Torrent
+	files  []qbclient.File
+	// mainData is returned in order by SyncMainData, repeating the last entry.
+	mainData []*qbclient.MainData
+	// calls records lifecycle operations as "action hash|hash".
+	calls []string
+	// caps defaults to a qBittorrent 5 server when nil.
+	caps *qbclient.Capabilities
+	// categories and tags back the category/tag management methods.
+	categories map[string]qbclient.Category
+	tags       []string
+	prefs      map[string]any
+	// exports holds .torrent data by hash; added records AddTorrentFile calls.
+	exports map[string][]byte
+	added   []stubAdd
+	// trackers backs Trackers; AddTrackers records "add-trackers hash" and
+	// appends to it.
+	trackers []qbclient.Tracker
+}
+
+type stubAdd struct {
+	name string
+	data []byte
+	opts qbclient.AddOptions
 }
 
 func (s *stubQBClient) Login() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.loginErr
 }
 
-func (s *stubQBClient) AddMagnet(magnet string) error {
+func (s *stubQBClient) AddMagnetWithOptions(magnet string, opts qbclient.AddOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.lastMagnet = magnet
+	s.lastAddOpts = opts
 	return s.addErr
 }
 
+func (s *stubQBClient) Torrents(opts qbclient.ListOptions) ([]qbclient.Torrent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastList = opts
+	var out []qbclient.Torrent
+	for _, t := range s.torrents {
+		if opts.Category != "" && t.Category != opts.Category {
+			continue
+		}
+		if opts.Tag != "" && !strings.Contains(","+t.Tags+",", ","+opts.Tag+",") {
+			continue
+		}
+		if len(opts.Hashes) > 0 && !containsString(opts.Hashes, t.Hash) {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func (s *stubQBClient) TorrentByHash(hash string) (*qbclient.Torrent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.byHash) == 0 {
+		return nil, nil
+	}
+	t := s.byHash[0]
+	if len(s.byHash) > 1 {
+		s.byHash = s.byHash[1:]
+	}
+	return t, nil
+}
+
+func (s *stubQBClient) Files(hash string) ([]qbclient.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files, nil
+}
+
+func (s *stubQBClient) SyncMainData(rid int64) (*qbclient.MainData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.mainData) == 0 {
+		return &qbclient.MainData{Rid: rid}, nil
+	}
+	d := s.mainData[0]
+	if len(s.mainData) > 1 {
+		s.mainData = s.mainData[1:]
+	}
+	return d, nil
+}
+
+func (s *stubQBClient) record(action string, hashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, action+" "+strings.Join(hashes, "|"))
+	return nil
+}
+
+func (s *stubQBClient) Stop(h []string) error        { return s.record("stop", h) }
+func (s *stubQBClient) Start(h []string) error       { return s.record("start", h) }
+func (s *stubQBClient) Recheck(h []string) error     { return s.record("recheck", h) }
+func (s *stubQBClient) Reannounce(h []string) error  { return s.record("reannounce", h) }
+func (s *stubQBClient) QueueTop(h []string) error    { return s.record("queue-top", h) }
+func (s *stubQBClient) QueueBottom(h []string) error { return s.record("queue-bottom", h) }
+func (s *stubQBClient) QueueUp(h []string) error     { return s.record("queue-up", h) }
+func (s *stubQBClient) QueueDown(h []string) error   { return s.record("queue-down", h) }
+
+func (s *stubQBClient) Delete(h []string, deleteFiles bool) error {
+	s.mu.Lock()
+	var kept []qbclient.Torrent
+	for _, t := range s.torrents {
+		if !containsString(h, t.Hash) {
+			kept = append(kept, t)
+		}
+	}
+	s.torrents = kept
+	s.mu.Unlock()
+	return s.record(fmt.Sprintf("delete(files=%t)", deleteFiles), h)
+}
+
+func (s *stubQBClient) SetForceStart(h []string, value bool) error {
+	return s.record(fmt.Sprintf("force-start(%t)", value), h)
+}
+
+func (s *stubQBClient) Capabilities() (*qbclient.Capabilities, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.caps != nil {
+		return s.caps, nil
+	}
+	return &qbclient.Capabilities{AppVersion: "v5.0.0", WebAPIVersion: qbclient.Version{Major: 2, Minor: 11, Patch: 2}}, nil
+}
+
+func (s *stubQBClient) Categories() (map[string]qbclient.Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := map[string]qbclient.Category{}
+	for k, v := range s.categories {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (s *stubQBClient) CreateCategory(name, savePath string) error {
+	s.mu.Lock()
+	if s.categories == nil {
+		s.categories = map[string]qbclient.Category{}
+	}
+	s.categories[name] = qbclient.Category{Name: name, SavePath: savePath}
+	s.mu.Unlock()
+	return s.record("create-category", []string{name})
+}
+
+func (s *stubQBClient) EditCategory(name, savePath string) error {
+	s.mu.Lock()
+	s.categories[name] = qbclient.Category{Name: name, SavePath: savePath}
+	s.mu.Unlock()
+	return s.record("edit-category", []string{name})
+}
+
+func (s *stubQBClient) RemoveCategories(names []string) error {
+	s.mu.Lock()
+	for _, n := range names {
+		delete(s.categories, n)
+	}
+	s.mu.Unlock()
+	return s.record("remove-categories", names)
+}
+
+func (s *stubQBClient) Tags() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tags, nil
+}
+
+func (s *stubQBClient) CreateTags(tags []string) error {
+	s.mu.Lock()
+	s.tags = append(s.tags, tags...)
+	s.mu.Unlock()
+	return s.record("create-tags", tags)
+}
+
+func (s *stubQBClient) DeleteTags(tags []string) error { return s.record("delete-tags", tags) }
+
+func (s *stubQBClient) Preferences() (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prefs, nil
+}
+
+func (s *stubQBClient) SetPreferences(prefs map[string]any) error {
+	s.mu.Lock()
+	keys := make([]string, 0, len(prefs))
+	for k, v := range prefs {
+		s.prefs[k] = v
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	s.mu.Unlock()
+	return s.record("set-preferences", keys)
+}
+
+func (s *stubQBClient) ExportTorrent(hash string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.exports[hash]
+	if !ok {
+		return nil, fmt.Errorf("no export for %s", hash)
+	}
+	return data, nil
+}
+
+func (s *stubQBClient) AddTorrentFile(name string, data []byte, opts qbclient.AddOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.added = append(s.added, stubAdd{name: name, data: data, opts: opts})
+	return nil
+}
+
+func (s *stubQBClient) Trackers(hash string) ([]qbclient.Tracker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trackers, nil
+}
+
+func (s *stubQBClient) AddTrackers(hash string, urls []string) error {
+	s.mu.Lock()
+	for _, u := range urls {
+		s.trackers = append(s.trackers, qbclient.Tracker{URL: u})
+	}
+	s.mu.Unlock()
+	return s.record("add-trackers", []string{hash})
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// useStubClient routes qbClientFactory to stub for the duration of the test.
+func useStubClient(t *testing.T, stub qbClient) {
+	t.Helper()
+	origFactory := qbClientFactory
+	t.Cleanup(func() { qbClientFactory = origFactory })
+	qbClientFactory = func(srv config.Server, logger *logging.Logger) (qbClient, error) { return stub, nil }
+}
+
 func TestProcessMagnetSuccess(t *testing.T) {
 	origFactory := qbClientFactory
 	defer func() { qbClientFactory = origFactory }()
 
 	stub := &stubQBClient{}
-	qbClientFactory = func(cfg *config.Config) qbClient {
-		return stub
+	qbClientFactory = func(srv config.Server, logger *logging.Logger) (qbClient, error) {
+		return stub, nil
 	}
 
 	cfg := &config.Config{
@@ -40,14 +293,46 @@ func TestProcessMagnetSuccess(t *testing.T) {
 	}
 	magnet := "magnet:?xt=urn:btih:example"
 
-	logger := logging.NewLogger("info")
-	if err := processMagnet(magnet, cfg, logger); err != nil {
+	logger := logging.NewLogger("info", "")
+	if err := processMagnet(magnet, cfg, logger, addOptions{}); err != nil {
 		t.Fatalf("processMagnet returned error: %v", err)
 	}
 
 	if stub.lastMagnet != magnet {
 		t.Fatalf("expected magnet %s, got %s", magnet, stub.lastMagnet)
 	}
+	if len(stub.lastAddOpts.Tags) != 0 {
+		t.Fatalf("expected no tags without addedTag, got %v", stub.lastAddOpts.Tags)
+	}
+}
+
+func TestProcessMagnetTagsAddedTorrents(t *testing.T) {
+	stub := &stubQBClient{}
+	useStubClient(t, stub)
+
+	cfg := &config.Config{QbHost: "http://example.test", QbUsername: "admin", QbPassword: "password", AddedTag: "magnet2torrent"}
+	if err := processMagnet("magnet:?xt=urn:btih:example", cfg, logging.NewLogger("info", ""), addOptions{}); err != nil {
+		t.Fatalf("processMagnet returned error: %v", err)
+	}
+	if len(stub.lastAddOpts.Tags) != 1 || stub.lastAddOpts.Tags[0] != "magnet2torrent" {
+		t.Fatalf("expected addedTag on add, got %v", stub.lastAddOpts.Tags)
+	}
+
+	opts := addOptions{add: qbclient.AddOptions{Category: "linux", Tags: []string{"iso"}}}
+	if err := processMagnet("magnet:?xt=urn:btih:example", cfg, logging.NewLogger("info", ""), opts); err != nil {
+		t.Fatalf("processMagnet returned error: %v", err)
+	}
+	if stub.lastAddOpts.Category != "linux" || strings.Join(stub.lastAddOpts.Tags, ",") != "iso,magnet2torrent" {
+		t.Fatalf("unexpected add options: %+v", stub.lastAddOpts)
+	}
+
+	stub.caps = &qbclient.Capabilities{AppVersion: "v4.1.9", WebAPIVersion: qbclient.Version{Major: 2, Minor: 2}}
+	if err := processMagnet("magnet:?xt=urn:btih:example", cfg, logging.NewLogger("info", ""), addOptions{}); err != nil {
+		t.Fatalf("processMagnet returned error: %v", err)
+	}
+	if len(stub.lastAddOpts.Tags) != 0 {
+		t.Fatalf("addedTag should be skipped on servers without tags, got %v", stub.lastAddOpts.Tags)
+	}
 }
 
 func TestProcessMagnetLoginError(t *testing.T) {
@@ -55,14 +340,14 @@ func TestProcessMagnetLoginError(t *testing.T) {
 	defer func() { qbClientFactory = origFactory }()
 
 	stub := &stubQBClient{loginErr: errors.New("login failed")}
-	qbClientFactory = func(cfg *config.Config) qbClient { return stub }
+	qbClientFactory = func(srv config.Server, logger *logging.Logger) (qbClient, error) { return stub, nil }
 
-	logger := logging.NewLogger("info")
+	logger := logging.NewLogger("info", "")
 	err := processMagnet("magnet:?xt=urn:btih:example", &config.Config{
 		QbHost:     "http://example.test",
 		QbUsername: "admin",
 		QbPassword: "password",
-	}, logger)
+	}, logger, addOptions{})
 	if err == nil || !strings.Contains(err.Error(), "login failed") {
 		t.Fatalf("expected login error, got %v", err)
 	}
@@ -73,14 +358,14 @@ func TestProcessMagnetAddError(t *testing.T) {
 	defer func() { qbClientFactory = origFactory }()
 
 	stub := &stubQBClient{addErr: errors.New("add failed")}
-	qbClientFactory = func(cfg *config.Config) qbClient { return stub }
+	qbClientFactory = func(srv config.Server, logger *logging.Logger) (qbClient, error) { return stub, nil }
 
-	logger := logging.NewLogger("info")
+	logger := logging.NewLogger("info", "")
 	err := processMagnet("magnet:?xt=urn:btih:example", &config.Config{
 		QbHost:     "http://example.test",
 		QbUsername: "admin",
 		QbPassword: "password",
-	}, logger)
+	}, logger, addOptions{})
 	if err == nil || !strings.Contains(err.Error(), "add failed") {
 		t.Fatalf("expected add error, got %v", err)
 	}
@@ -96,6 +381,26 @@ func TestValidateQBConfig(t *testing.T) {
 		{name: "missing user", cfg: config.Config{QbHost: "http://h", QbPassword: "p"}, wantErr: "qbittorrent username is empty"},
 		{name: "missing pass", cfg: config.Config{QbHost: "http://h", QbUsername: "u"}, wantErr: "qbittorrent password is empty"},
 		{name: "ok", cfg: config.Config{QbHost: "http://h", QbUsername: "u", QbPassword: "p"}, wantErr: ""},
+		{
+			name: "named server missing pass",
+			cfg: config.Config{
+				DefaultServer: "seedbox",
+				Servers:       map[string]config.Server{"seedbox": {Host: "https://h/qbt", Username: "u"}},
+			},
+			wantErr: "set servers.seedbox.password",
+		},
+		{name: "auth none", cfg: config.Config{QbHost: "http://h", QbAuth: config.AuthNone}, wantErr: ""},
+		{name: "bad auth mode", cfg: config.Config{QbHost: "http://h", QbAuth: "token"}, wantErr: `auth mode "token" is invalid`},
+		{name: "bad scheme", cfg: config.Config{QbHost: "ftp://h", QbUsername: "u", QbPassword: "p"}, wantErr: "qbittorrent host is invalid"},
+		{name: "unix socket", cfg: config.Config{QbHost: "unix:///run/qbittorrent.sock", QbUsername: "u", QbPassword: "p"}, wantErr: ""},
+		{
+			name: "bad proxy",
+			cfg: config.Config{
+				Servers: map[string]config.Server{"default": {Host: "http://h", Username: "u", Password: "p", Proxy: "ftp://p"}},
+			},
+			wantErr: "fix servers.default.proxy",
+		},
+		{name: "unknown server", cfg: config.Config{DefaultServer: "nas"}, wantErr: `unknown server "nas"`},
 	}
 
 	for _, tc := range cases {
@@ -113,3 +418,46 @@ func TestValidateQBConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessMagnetUsesSelectedServer(t *testing.T) {
+	origFactory := qbClientFactory
+	defer func() { qbClientFactory = origFactory }()
+
+	var got config.Server
+	stub := &stubQBClient{}
+	qbClientFactory = func(srv config.Server, logger *logging.Logger) (qbClient, error) {
+		got = srv
+		return stub, nil
+	}
+
+	cfg := &config.Config{
+		QbHost:        "http://localhost:8080",
+		QbUsername:    "admin",
+		QbPassword:    "password",
+		DefaultServer: "seedbox",
+		Servers: map[string]config.Server{
+			"seedbox": {
+				Host:     "https://box.example/qbt/",
+				Username: "u",
+				Password: "p",
+				Headers:  map[string]string{"Remote-User": "alice"},
+			},
+		},
+	}
+
+	if err := processMagnet("magnet:?xt=urn:btih:example", cfg, logging.NewLogger("info", ""), addOptions{}); err != nil {
+		t.Fatalf("processMagnet returned error: %v", err)
+	}
+	if got.Name != "seedbox" || got.Host != "https://box.example/qbt/" || got.Headers["Remote-User"] != "alice" {
+		t.Fatalf("factory got unexpected server: %+v", got)
+	}
+}
+
+func TestNeedsQBConfigAuthNone(t *testing.T) {
+	if needsQBConfig(&config.Config{QbHost: "http://localhost:8080", QbAuth: config.AuthNone}) {
+		t.Fatalf("expected auth none config with host to be complete")
+	}
+	if !needsQBConfig(&config.Config{QbHost: "http://localhost:8080"}) {
+		t.Fatalf("expected missing credentials to require prompting")
+	}
+}
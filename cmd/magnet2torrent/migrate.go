@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// migrateOptions tune how torrents are moved between servers.
+type migrateOptions struct {
+	// paths translates source save paths to target ones; torrents whose path
+	// maps are added with skip_checking since their data is already there.
+	// Unmapped ones go to the target's default (or category) path.
+	paths         map[string]string
+	removeSource  bool
+	dryRun        bool
+	verifyTimeout time.Duration
+}
+
+// migrateResult counts what a migration did.
+type migrateResult struct {
+	moved, present, failed int
+}
+
+func runMigrate(args []string, cfg *config.Config, logger *logging.Logger) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	var (
+		from     = fs.String("from", "", "source server profile")
+		to       = fs.String("to", "", "target server profile")
+		category = fs.String("category", "", "only migrate torrents in this category")
+		tag      = fs.String("tag", "", "only migrate torrents with this tag")
+		hashes   = fs.String("hash", "", "comma-separated info-hashes to migrate")
+		opts     = migrateOptions{paths: map[string]string{}}
+		extra    = map[string]string{}
+	)
+	fs.BoolVar(&opts.removeSource, "remove-source", false, "remove each torrent from the source once verified on the target (data is kept)")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "show what would be migrated")
+	fs.DurationVar(&opts.verifyTimeout, "verify-timeout", time.Minute, "how long to wait for a torrent to settle on the target")
+	fs.Func("map", "translate save paths, SOURCE=TARGET (repeatable; adds to pathMaps in config)", func(v string) error {
+		src, dst, ok := strings.Cut(v, "=")
+		if !ok || src == "" || dst == "" {
+			return fmt.Errorf("expected SOURCE=TARGET, got %q", v)
+		}
+		extra[src] = dst
+		return nil
+	})
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return usageErrorf("usage: magnet2torrent migrate -from SERVER -to SERVER [-category c] [-tag t] [-map src=dst] [-remove-source] [-dry-run]")
+	}
+	if *from == *to {
+		return errors.New("migrate: -from and -to name the same server")
+	}
+
+	for k, v := range cfg.PathMapping(*from, *to) {
+		opts.paths[k] = v
+	}
+	for k, v := range extra {
+		opts.paths[k] = v
+	}
+
+	source, _, err := connectServer(cfg, *from, logger)
+	if err != nil {
+		return fmt.Errorf("source %s: %w", *from, err)
+	}
+	target, _, err := connectServer(cfg, *to, logger)
+	if err != nil {
+		return fmt.Errorf("target %s: %w", *to, err)
+	}
+
+	torrents, err := source.Torrents(qbclient.ListOptions{Category: *category, Tag: *tag, Hashes: splitList(*hashes)})
+	if err != nil {
+		return fmt.Errorf("list torrents on %s: %w", *from, err)
+	}
+	if len(torrents) == 0 {
+		logger.Infof("nothing to migrate from %s", *from)
+		return nil
+	}
+
+	res, err := migrateTorrents(source, target, torrents, opts, logger)
+	if err != nil {
+		return err
+	}
+	logger.Infof("migrate %s -> %s: %d moved, %d already on target, %d failed", *from, *to, res.moved, res.present, res.failed)
+	if res.failed > 0 {
+		return fmt.Errorf("%d torrent(s) failed to migrate; re-run to retry", res.failed)
+	}
+	return nil
+}
+
+// migrateTorrents copies torrents to target and optionally removes them from
+// source. Every step checks the target first, so re-running an interrupted
+// migration resumes it: torrents already on the target are only verified.
+func migrateTorrents(source, target qbClient, torrents []qbclient.Torrent, opts migrateOptions, logger *logging.Logger) (migrateResult, error) {
+	var res migrateResult
+
+	sourceCategories, err := source.Categories()
+	if err != nil {
+		return res, fmt.Errorf("list source categories: %w", err)
+	}
+	targetCategories, err := target.Categories()
+	if err != nil {
+		return res, fmt.Errorf("list target categories: %w", err)
+	}
+
+	for _, t := range torrents {
+		existing, err := target.TorrentByHash(t.Hash)
+		if err != nil {
+			return res, fmt.Errorf("query target: %w", err)
+		}
+
+		if opts.dryRun {
+			savePath, mapped := config.TranslatePath(opts.paths, t.SavePath)
+			switch {
+			case existing != nil:
+				logger.Infof("%s is already on the target", t.Name)
+			case mapped:
+				logger.Infof("would migrate %s to %s without rechecking", t.Name, savePath)
+			default:
+				logger.Infof("would migrate %s to the target's default path (no mapping for %s; data will be checked)", t.Name, t.SavePath)
+			}
+			if opts.removeSource {
+				logger.Infof("would remove %s from the source", t.Name)
+			}
+			continue
+		}
+
+		if existing == nil {
+			catPath, mapped := config.TranslatePath(opts.paths, sourceCategories[t.Category].SavePath)
+			if !mapped {
+				catPath = "" // a source path means nothing on the target
+			}
+			if err := ensureCategoryPath(target, targetCategories, t.Category, catPath, logger); err != nil {
+				return res, err
+			}
+			if err := migrateAdd(source, target, t, opts); err != nil {
+				logger.Errorf("migrate %s: %v", t.Name, err)
+				res.failed++
+				continue
+			}
+		}
+
+		if err := verifyMigrated(target, t.Hash, opts.verifyTimeout); err != nil {
+			logger.Errorf("verify %s: %v", t.Name, err)
+			res.failed++
+			continue
+		}
+		if existing == nil {
+			res.moved++
+		} else {
+			res.present++
+		}
+		logger.Infof("%s is on the target", t.Name)
+
+		if opts.removeSource {
+			if err := source.Delete([]string{t.Hash}, false); err != nil {
+				logger.Errorf("remove %s from source: %v", t.Name, err)
+				res.failed++
+				continue
+			}
+			logger.Infof("removed %s from the source", t.Name)
+		}
+	}
+	return res, nil
+}
+
+// migrateAdd adds t to target with the same settings, exporting its .torrent
+// from source or falling back to the magnet link while metadata is pending.
+func migrateAdd(source, target qbClient, t qbclient.Torrent, opts migrateOptions) error {
+	addOpts := addOptionsFromEntry(entryFromTorrent(t))
+	// An unmapped source path means nothing on the target, so the target
+	// picks the path and checks (or downloads) the data itself.
+	savePath, mapped := config.TranslatePath(opts.paths, t.SavePath)
+	addOpts.SavePath, addOpts.SkipChecking = "", mapped
+	if mapped {
+		addOpts.SavePath = savePath
+	}
+
+	if t.IsMetadataPending() {
+		if t.MagnetURI == "" {
+			return errors.New("no metadata and no magnet link")
+		}
+		return target.AddMagnetWithOptions(t.MagnetURI, addOpts)
+	}
+	data, err := source.ExportTorrent(t.Hash)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return target.AddTorrentFile(t.Hash+".torrent", data, addOpts)
+}
+
+// verifyMigrated waits for hash to settle on target: listed, past fetching
+// metadata and checking its data, and not errored. Only then is it safe to
+// remove the source.
+func verifyMigrated(target qbClient, hash string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		t, err := target.TorrentByHash(hash)
+		if err != nil {
+			return err
+		}
+		switch {
+		case t == nil:
+		case t.IsErrored():
+			return fmt.Errorf("target reports state %s", t.State)
+		case !t.IsMetadataPending() && !t.IsChecking():
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if t == nil {
+				return fmt.Errorf("not listed on the target after %s: %w", timeout, errWaitTimeout)
+			}
+			return fmt.Errorf("still %s on the target after %s: %w", t.State, timeout, errWaitTimeout)
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// migrateTarget lists whatever has been added to it so verification succeeds.
+type migrateTarget struct {
+	*stubQBClient
+	listed map[string]*qbclient.Torrent
+}
+
+func (m *migrateTarget) TorrentByHash(hash string) (*qbclient.Torrent, error) {
+	return m.listed[hash], nil
+}
+
+func (m *migrateTarget) AddTorrentFile(name string, data []byte, opts qbclient.AddOptions) error {
+	hash := strings.TrimSuffix(name, ".torrent")
+	m.listed[hash] = &qbclient.Torrent{Hash: hash, State: "stoppedUP"}
+	return m.stubQBClient.AddTorrentFile(name, data, opts)
+}
+
+func TestMigrateTorrents(t *testing.T) {
+	shortWaitInterval(t)
+	logger := logging.NewLogger("error", "")
+	torrents := []qbclient.Torrent{
+		{Hash: "aaa", Name: "debian", State: "uploading", SavePath: "/data/iso", Category: "linux"},
+		{Hash: "bbb", Name: "fedora", State: "uploading", SavePath: "/other"},
+		{Hash: "ccc", Name: "arch", State: "uploading", SavePath: "/data/iso"},
+	}
+	source := &stubQBClient{
+		torrents:   torrents,
+		categories: map[string]qbclient.Category{"linux": {Name: "linux", SavePath: "/data/iso"}},
+		exports:    map[string][]byte{"aaa": []byte("d1:ae"), "bbb": []byte("d1:be")},
+	}
+	// ccc was already copied by an interrupted earlier run.
+	target := &migrateTarget{stubQBClient: &stubQBClient{}, listed: map[string]*qbclient.Torrent{"ccc": {Hash: "ccc", State: "stalledUP"}}}
+	opts := migrateOptions{paths: map[string]string{"/data": "/mnt/data"}, removeSource: true}
+
+	res, err := migrateTorrents(source, target, torrents, opts, logger)
+	if err != nil {
+		t.Fatalf("migrateTorrents error: %v", err)
+	}
+	if res.moved != 2 || res.present != 1 || res.failed != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	added := target.added
+	if len(added) != 2 || added[0].opts.SavePath != "/mnt/data/iso" || !added[0].opts.SkipChecking {
+		t.Fatalf("mapped torrent added wrongly: %+v", added)
+	}
+	if added[1].opts.SavePath != "" || added[1].opts.SkipChecking {
+		t.Fatalf("unmapped torrent must go to the target's default path and be checked: %+v", added[1].opts)
+	}
+	if target.categories["linux"].SavePath != "/mnt/data/iso" {
+		t.Fatalf("category not created on target: %+v", target.categories)
+	}
+	if got := strings.Join(source.calls, ","); got != "delete(files=false) aaa,delete(files=false) bbb,delete(files=false) ccc" {
+		t.Fatalf("source calls = %s", got)
+	}
+}
+
+func TestMigrateKeepsSourceWhenTargetErrors(t *testing.T) {
+	shortWaitInterval(t)
+	torrents := []qbclient.Torrent{{Hash: "aaa", Name: "debian", State: "uploading", SavePath: "/data"}}
+	source := &stubQBClient{torrents: torrents}
+	target := &migrateTarget{stubQBClient: &stubQBClient{}, listed: map[string]*qbclient.Torrent{"aaa": {Hash: "aaa", State: "missingFiles"}}}
+
+	res, err := migrateTorrents(source, target, torrents, migrateOptions{removeSource: true}, logging.NewLogger("error", ""))
+	if err != nil {
+		t.Fatalf("migrateTorrents error: %v", err)
+	}
+	if res.failed != 1 || len(source.calls) != 0 {
+		t.Fatalf("expected failure without source removal: %+v, calls %v", res, source.calls)
+	}
+}
+
+func TestVerifyMigratedWaitsForChecking(t *testing.T) {
+	shortWaitInterval(t)
+	target := &stubQBClient{byHash: []*qbclient.Torrent{
+		nil,
+		{Hash: "aaa", State: "metaDL"},
+		{Hash: "aaa", State: "checkingResumeData"},
+		{Hash: "aaa", State: "checkingUP"},
+		{Hash: "aaa", State: "stalledUP"},
+	}}
+	if err := verifyMigrated(target, "aaa", time.Minute); err != nil {
+		t.Fatalf("verifyMigrated: %v", err)
+	}
+	if len(target.byHash) != 1 {
+		t.Fatalf("returned before the torrent settled; %d states left", len(target.byHash))
+	}
+
+	target.byHash = []*qbclient.Torrent{{Hash: "aaa", State: "checkingUP"}}
+	if err := verifyMigrated(target, "aaa", 0); !errors.Is(err, errWaitTimeout) || !strings.Contains(err.Error(), "checkingUP") {
+		t.Fatalf("torrent still checking: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// Output modes for -output.
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputQuiet = "quiet"
+)
+
+// Error codes reported in JSON results. Each maps to a process exit code;
+// both are part of the scripting interface documented in the README.
+const (
+	codeError       = "error"
+	codeUsage       = "usage"
+	codeConfig      = "config"
+	codeConnection  = "connection"
+	codeAuth        = "auth"
+	codeInput       = "input"
+	codeRejected    = "rejected"
+	codeTimeout     = "timeout"
+	codeUnsupported = "unsupported"
+)
+
+// Exit codes. exitMixed is used when a batch fails with several error codes.
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitConfig      = 3
+	exitConnection  = 4
+	exitAuth        = 5
+	exitInput       = 6
+	exitRejected    = 7
+	exitTimeout     = 8
+	exitUnsupported = 9
+	exitMixed       = 10
+)
+
+var exitCodes = map[string]int{
+	codeError:       exitError,
+	codeUsage:       exitUsage,
+	codeConfig:      exitConfig,
+	codeConnection:  exitConnection,
+	codeAuth:        exitAuth,
+	codeInput:       exitInput,
+	codeRejected:    exitRejected,
+	codeTimeout:     exitTimeout,
+	codeUnsupported: exitUnsupported,
+}
+
+// codedError tags err with an error code that cannot be inferred from its type.
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+func withCode(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+func usageErrorf(format string, args ...any) error {
+	return withCode(codeUsage, fmt.Errorf(format, args...))
+}
+
+// parseFlags parses a command's flags, marking failures as usage errors.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	return withCode(codeUsage, fs.Parse(args))
+}
+
+// errorCode classifies err for JSON output and the exit code.
+func errorCode(err error) string {
+	var (
+		coded       *codedError
+		authErr     *qbclient.AuthError
+		unsupported *qbclient.UnsupportedError
+		status      *qbclient.StatusError
+		urlErr      *url.Error
+		netErr      net.Error
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.As(err, &authErr):
+		return codeAuth
+	case errors.As(err, &unsupported):
+		return codeUnsupported
+	case errors.Is(err, errWaitTimeout), errors.Is(err, errStalled):
+		return codeTimeout
+	case errors.Is(err, qbclient.ErrAddRejected):
+		return codeRejected
+	case errors.As(err, &status):
+		if status.StatusCode == 401 || status.StatusCode == 403 {
+			return codeAuth
+		}
+		return codeRejected
+	case errors.As(err, &urlErr), errors.As(err, &netErr):
+		return codeConnection
+	default:
+		return codeError
+	}
+}
+
+// exitCode picks the process exit code for err.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	var batch *batchError
+	if errors.As(err, &batch) {
+		return batchExitCode(batch.results)
+	}
+	return exitCodes[errorCode(err)]
+}
+
+// batchExitCode is the exit code for a set of results: the shared code of
+// all failures, or exitMixed when they differ.
+func batchExitCode(results []addResult) int {
+	code := exitOK
+	for _, r := range results {
+		if r.err == nil {
+			continue
+		}
+		c := exitCode(r.err)
+		if code != exitOK && c != code {
+			return exitMixed
+		}
+		code = c
+	}
+	return code
+}
+
+// resultJSON is one line of -output json.
+type resultJSON struct {
+	Input    string `json:"input"`
+	InfoHash string `json:"infoHash,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Server   string `json:"server,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+func newResultJSON(r addResult) resultJSON {
+	line := resultJSON{Input: r.input, InfoHash: r.hash, Name: r.name, Server: r.server, Status: r.status}
+	if r.err != nil {
+		line.Error, line.Code = r.err.Error(), errorCode(r.err)
+	}
+	return line
+}
+
+func writeResultsJSON(w io.Writer, results []addResult) error {
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		if err := enc.Encode(newResultJSON(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyOutputMode routes console logging for mode; JSON keeps stdout for
+// results and quiet relies on the exit code alone.
+func applyOutputMode(mode string, logger *logging.Logger, watch *watchOptions) error {
+	switch mode {
+	case outputText, "":
+	case outputJSON:
+		logger.SetConsole(os.Stderr)
+		watch.out, watch.tty = os.Stderr, isTerminal(os.Stderr)
+	case outputQuiet:
+		logger.SetConsole(nil)
+		watch.out, watch.tty = io.Discard, false
+	default:
+		return usageErrorf("unknown -output %q; use text, json or quiet", mode)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func TestErrorCodes(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code string
+		exit int
+	}{
+		{"nil", nil, "", exitOK},
+		{"config", withCode(codeConfig, errors.New("qbittorrent host is empty")), codeConfig, exitConfig},
+		{"usage", usageErrorf("usage: magnet2torrent x"), codeUsage, exitUsage},
+		{"auth", fmt.Errorf("qbittorrent login failed: %w", &qbclient.AuthError{Reason: "wrong password"}), codeAuth, exitAuth},
+		{"forbidden", &qbclient.StatusError{Path: "/api/v2/torrents/info", StatusCode: 403}, codeAuth, exitAuth},
+		{"rejected", fmt.Errorf("could not send magnet: %w", qbclient.ErrAddRejected), codeRejected, exitRejected},
+		{"timeout", fmt.Errorf("metadata: %w", errWaitTimeout), codeTimeout, exitTimeout},
+		{"stalled", fmt.Errorf("watch: %w", errStalled), codeTimeout, exitTimeout},
+		{"unsupported", &qbclient.UnsupportedError{Feature: qbclient.FeatureTags}, codeUnsupported, exitUnsupported},
+		{"connection", fmt.Errorf("login: %w", &url.Error{Op: "Post", URL: "http://x", Err: errors.New("connection refused")}), codeConnection, exitConnection},
+		{"other", errors.New("boom"), codeError, exitError},
+	}
+	for _, tc := range cases {
+		if got := errorCode(tc.err); got != tc.code {
+			t.Errorf("%s: errorCode = %q, want %q", tc.name, got, tc.code)
+		}
+		if got := exitCode(tc.err); got != tc.exit {
+			t.Errorf("%s: exitCode = %d, want %d", tc.name, got, tc.exit)
+		}
+	}
+}
+
+func TestBatchExitCode(t *testing.T) {
+	ok := addResult{status: "added"}
+	input := addResult{status: "failed", err: withCode(codeInput, errors.New("bad"))}
+	auth := addResult{status: "failed", err: &qbclient.AuthError{Reason: "no"}}
+
+	if got := batchExitCode([]addResult{ok, ok}); got != exitOK {
+		t.Fatalf("all ok = %d", got)
+	}
+	if got := batchExitCode([]addResult{ok, input, input}); got != exitInput {
+		t.Fatalf("same class = %d", got)
+	}
+	if got := batchExitCode([]addResult{input, ok, auth}); got != exitMixed {
+		t.Fatalf("mixed = %d", got)
+	}
+}
+
+func TestWriteResultsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	results := []addResult{
+		{input: "magnet:?xt=urn:btih:aaa", hash: "aaa", name: "debian", server: "home", status: "added"},
+		{input: "nope.torrent", server: "home", status: "failed", err: withCode(codeInput, errors.New("not a torrent file"))},
+	}
+	if err := writeResultsJSON(&buf, results); err != nil {
+		t.Fatalf("writeResultsJSON error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per result:\n%s", buf.String())
+	}
+	var second resultJSON
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	if second.Status != "failed" || second.Code != codeInput || second.Error != "not a torrent file" {
+		t.Fatalf("unexpected result: %+v", second)
+	}
+	if strings.Contains(lines[0], `"error"`) || !strings.Contains(lines[0], `"infoHash":"aaa"`) {
+		t.Fatalf("unexpected first line: %s", lines[0])
+	}
+}
+
+func TestApplyOutputMode(t *testing.T) {
+	logger := logging.NewLogger("error", "")
+	watch := defaultWatchOptions()
+	if err := applyOutputMode(outputQuiet, logger, &watch); err != nil || watch.tty {
+		t.Fatalf("quiet mode: %v, tty=%t", err, watch.tty)
+	}
+	if err := applyOutputMode("yaml", logger, &watch); errorCode(err) != codeUsage {
+		t.Fatalf("expected usage error, got %v", err)
+	}
+}
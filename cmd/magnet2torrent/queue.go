@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// queueMoves maps the queue actions to the client calls that perform them.
+var queueMoves = map[string]func(qb qbClient, hashes []string) error{
+	"top":    func(qb qbClient, h []string) error { return qb.QueueTop(h) },
+	"bottom": func(qb qbClient, h []string) error { return qb.QueueBottom(h) },
+	"up":     func(qb qbClient, h []string) error { return qb.QueueUp(h) },
+	"down":   func(qb qbClient, h []string) error { return qb.QueueDown(h) },
+}
+
+func runQueue(args []string, cfg *config.Config, logger *logging.Logger) error {
+	usage := "usage: magnet2torrent queue [list|top|bottom|up|down] ..."
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	move, isMove := queueMoves[action]
+	if action != "list" && !isMove {
+		return usageErrorf("unknown queue action %q; %s", action, usage)
+	}
+
+	fs := flag.NewFlagSet("queue "+action, flag.ContinueOnError)
+	var (
+		category = fs.String("category", "", "target torrents in this category")
+		tag      = fs.String("tag", "", "target torrents with this tag")
+		format   = fs.String("format", "table", "output format for list: table or json")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	patterns := fs.Args()
+	if isMove && len(patterns) == 0 && *category == "" && *tag == "" {
+		return usageErrorf("usage: magnet2torrent queue %s [-category c] [-tag t] [hash|name-glob ...]", action)
+	}
+
+	qb, _, err := connect(cfg, logger)
+	if err != nil {
+		return err
+	}
+	targets, err := selectTorrents(qb, patterns, *category, *tag)
+	if err != nil {
+		return err
+	}
+
+	if !isMove {
+		return renderQueue(os.Stdout, *format, queued(targets))
+	}
+
+	if len(targets) == 0 {
+		return errors.New("no torrents match")
+	}
+	hashes := make([]string, 0, len(targets))
+	for _, t := range targets {
+		hashes = append(hashes, t.Hash)
+	}
+	if err := move(qb, hashes); err != nil {
+		var status *qbclient.StatusError
+		if errors.As(err, &status) && status.StatusCode == http.StatusConflict {
+			return fmt.Errorf("queue %s: torrent queueing is disabled on the server; enable it under Options > BitTorrent", action)
+		}
+		return fmt.Errorf("queue %s: %w", action, err)
+	}
+	logger.Infof("queue %s: moved %d torrent(s)", action, len(hashes))
+	return nil
+}
+
+// queued keeps the torrents that hold a queue position, in queue order.
+func queued(torrents []qbclient.Torrent) []qbclient.Torrent {
+	var out []qbclient.Torrent
+	for _, t := range torrents {
+		if t.QueuePosition > 0 {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].QueuePosition < out[j].QueuePosition })
+	return out
+}
+
+func renderQueue(w io.Writer, format string, torrents []qbclient.Torrent) error {
+	switch format {
+	case "json":
+		if torrents == nil {
+			torrents = []qbclient.Torrent{}
+		}
+		return writeJSON(w, torrents)
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "POS\tNAME\tPROGRESS\tSTATE\tHASH")
+		for _, t := range torrents {
+			fmt.Fprintf(tw, "%d\t%s\t%.1f%%\t%s\t%s\n", t.QueuePosition, truncate(t.Name, 50), t.Progress*100, t.State, t.Hash)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q; use table or json", format)
+	}
+}
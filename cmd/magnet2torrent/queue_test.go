@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func TestRunQueueMoves(t *testing.T) {
+	stub := lifecycleStub(t)
+	logger := logging.NewLogger("error", "")
+
+	if err := runQueue([]string{"top", "-category", "linux"}, testConfig(), logger); err != nil {
+		t.Fatalf("queue top error: %v", err)
+	}
+	if err := runQueue([]string{"down", "holiday*"}, testConfig(), logger); err != nil {
+		t.Fatalf("queue down error: %v", err)
+	}
+	want := "queue-top aaa|bbb,queue-down ccc"
+	if got := strings.Join(stub.calls, ","); got != want {
+		t.Fatalf("calls = %s, want %s", got, want)
+	}
+
+	if err := runQueue([]string{"up"}, testConfig(), logger); exitCode(err) != exitUsage {
+		t.Fatalf("queue up without selection = %v, want usage error", err)
+	}
+	if err := runQueue([]string{"sideways"}, testConfig(), logger); exitCode(err) != exitUsage {
+		t.Fatalf("unknown action = %v, want usage error", err)
+	}
+}
+
+func TestRenderQueueOrder(t *testing.T) {
+	torrents := queued([]qbclient.Torrent{
+		{Hash: "aaa", Name: "second", QueuePosition: 2},
+		{Hash: "bbb", Name: "seeding", QueuePosition: -1},
+		{Hash: "ccc", Name: "first", QueuePosition: 1},
+	})
+	var buf bytes.Buffer
+	if err := renderQueue(&buf, "table", torrents); err != nil {
+		t.Fatalf("renderQueue error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "1") || !strings.Contains(lines[1], "first") || !strings.Contains(lines[2], "second") {
+		t.Fatalf("unexpected queue table:\n%s", buf.String())
+	}
+}
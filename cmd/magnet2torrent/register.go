@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+)
+
+const (
+	magnetMIME         = "x-scheme-handler/magnet"
+	handlerDesktopName = "magnet2torrent.desktop"
+	// windowsMagnetKey is the per-user registry key for the magnet: scheme.
+	windowsMagnetKey = `HKCU\Software\Classes\magnet`
+	// windowsCommandKey holds the command Windows runs for magnet: links.
+	windowsCommandKey = windowsMagnetKey + `\shell\open\command`
+)
+
+// registerOptions control where `register` writes; tests point them at a
+// temporary directory.
+type registerOptions struct {
+	exe        string
+	appsDir    string
+	mimeapps   string
+	unregister bool
+	dryRun     bool
+}
+
+// execCommand runs external tools (reg.exe, update-desktop-database); tests
+// replace it.
+var execCommand = func(name string, args ...string) error {
+	return exec.Command(name, args...).Run() // #nosec G204 - fixed tool names.
+}
+
+func runRegister(args []string, cfg *config.Config, logger *logging.Logger) error {
+	fs := flag.NewFlagSet("register", flag.ContinueOnError)
+	opts := registerOptions{appsDir: xdgApplicationsDir(), mimeapps: xdgMimeappsPath()}
+	fs.StringVar(&opts.exe, "exe", "", "binary to register (default: this executable)")
+	fs.BoolVar(&opts.unregister, "unregister", false, "remove the registration instead")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "print what would change without changing it")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageErrorf("usage: magnet2torrent register [-exe path] [-unregister] [-dry-run]")
+	}
+
+	if opts.exe == "" {
+		exe, err := executablePath()
+		if err != nil {
+			return err
+		}
+		opts.exe = exe
+	}
+
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return registerXDG(opts, logger)
+	case "windows":
+		return registerWindows(opts, logger)
+	default:
+		return fmt.Errorf("register is not supported on %s; associate magnet: links with %s in your browser or OS settings", runtime.GOOS, opts.exe)
+	}
+}
+
+// executablePath resolves the running binary, following symlinks so the
+// handler keeps working when a package manager swaps the link.
+func executablePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("locate executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return exe, nil
+}
+
+func xdgApplicationsDir() string {
+	base := os.Getenv("XDG_DATA_HOME")
+	if base == "" {
+		home, _ := os.UserHomeDir()
+		base = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(base, "applications")
+}
+
+func xdgMimeappsPath() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, _ := os.UserHomeDir()
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "mimeapps.list")
+}
+
+// registerXDG writes the desktop entry and makes it the default handler in
+// mimeapps.list, which is what `xdg-mime default` does on most desktops.
+func registerXDG(opts registerOptions, logger *logging.Logger) error {
+	desktopPath := filepath.Join(opts.appsDir, handlerDesktopName)
+	value := handlerDesktopName
+	if opts.unregister {
+		value = ""
+	}
+
+	current, err := os.ReadFile(opts.mimeapps)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("read %s: %w", opts.mimeapps, err)
+	}
+	updated := setMimeDefault(string(current), magnetMIME, value, handlerDesktopName)
+
+	if opts.dryRun {
+		if opts.unregister {
+			fmt.Printf("would remove %s\n", desktopPath)
+		} else {
+			fmt.Printf("would write %s:\n%s", desktopPath, desktopEntry(opts.exe))
+		}
+		if updated != string(current) {
+			fmt.Printf("would update %s:\n%s", opts.mimeapps, updated)
+		}
+		return nil
+	}
+
+	if opts.unregister {
+		if err := os.Remove(desktopPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove %s: %w", desktopPath, err)
+		}
+	} else {
+		if err := os.MkdirAll(opts.appsDir, 0o755); err != nil {
+			return fmt.Errorf("create %s: %w", opts.appsDir, err)
+		}
+		if err := os.WriteFile(desktopPath, []byte(desktopEntry(opts.exe)), 0o644); err != nil { // #nosec G306 - desktop entries are world-readable.
+			return fmt.Errorf("write %s: %w", desktopPath, err)
+		}
+	}
+	if updated != string(current) {
+		if err := os.MkdirAll(filepath.Dir(opts.mimeapps), 0o755); err != nil {
+			return fmt.Errorf("create %s: %w", filepath.Dir(opts.mimeapps), err)
+		}
+		if err := os.WriteFile(opts.mimeapps, []byte(updated), 0o644); err != nil { // #nosec G306 - mimeapps.list is world-readable.
+			return fmt.Errorf("write %s: %w", opts.mimeapps, err)
+		}
+	}
+	if err := execCommand("update-desktop-database", opts.appsDir); err != nil {
+		logger.Debugf("update-desktop-database: %v", err)
+	}
+
+	if opts.unregister {
+		logger.Infof("removed magnet: handler %s", desktopPath)
+	} else {
+		logger.Infof("registered %s as the magnet: handler via %s", opts.exe, desktopPath)
+	}
+	return nil
+}
+
+// desktopEntry renders the handler's .desktop file for exe.
+func desktopEntry(exe string) string {
+	return "[Desktop Entry]\n" +
+		"Type=Application\n" +
+		"Name=magnet2torrent\n" +
+		"Comment=Send magnet links to qBittorrent\n" +
+		"Exec=" + desktopExecQuote(exe) + " %u\n" +
+		"NoDisplay=true\n" +
+		"Terminal=false\n" +
+		"MimeType=" + magnetMIME + ";\n" +
+		"Categories=Network;FileTransfer;\n"
+}
+
+// desktopExecQuote quotes an Exec= program path per the Desktop Entry spec.
+func desktopExecQuote(path string) string {
+	if !strings.ContainsAny(path, " \t\"'\\`$<>~|&;*?#()") {
+		return path
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+	return `"` + r.Replace(path) + `"`
+}
+
+// setMimeDefault sets mime to value in the [Default Applications] section of
+// a mimeapps.list. An empty value removes the entry, but only when it still
+// points at owner, so another handler chosen since is left alone.
+func setMimeDefault(content, mime, value, owner string) string {
+	const section = "[Default Applications]"
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	inSection, sectionEnd, found := false, -1, false
+	var out []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if inSection {
+				sectionEnd = len(out)
+			}
+			inSection = trimmed == section
+		}
+		if inSection {
+			if key, val, ok := strings.Cut(trimmed, "="); ok && strings.TrimSpace(key) == mime {
+				found = true
+				switch {
+				case value != "":
+					line = mime + "=" + value + ";"
+				case !mimeListHas(val, owner):
+					// Someone else owns it now; keep the line.
+				default:
+					continue
+				}
+			}
+		}
+		out = append(out, line)
+	}
+	if inSection {
+		sectionEnd = len(out)
+	}
+
+	if !found && value != "" {
+		entry := mime + "=" + value + ";"
+		if sectionEnd < 0 {
+			if len(out) > 0 {
+				out = append(out, "")
+			}
+			out = append(out, section, entry)
+		} else {
+			// Insert before any blank lines that close the section.
+			at := sectionEnd
+			for at > 0 && strings.TrimSpace(out[at-1]) == "" {
+				at--
+			}
+			out = append(out[:at], append([]string{entry}, out[at:]...)...)
+		}
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// mimeListHas reports whether a semicolon-separated desktop file list
+// contains name.
+func mimeListHas(list, name string) bool {
+	for _, item := range strings.Split(list, ";") {
+		if strings.TrimSpace(item) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// registerWindows writes the per-user magnet: protocol keys with reg.exe, the
+// same keys scripts/register-magnet-windows.ps1 sets.
+func registerWindows(opts registerOptions, logger *logging.Logger) error {
+	var steps [][]string
+	if opts.unregister {
+		// The key may belong to another client; only remove our own.
+		command, err := windowsHandlerCommand()
+		if err != nil {
+			logger.Infof("no magnet: handler is registered under %s", windowsMagnetKey)
+			return nil
+		}
+		if prog := commandProgram(command); !sameProgram(prog, opts.exe) {
+			logger.Infof("the magnet: handler under %s runs %s, not %s; leaving it alone", windowsMagnetKey, prog, opts.exe)
+			return nil
+		}
+		steps = [][]string{{"delete", windowsMagnetKey, "/f"}}
+	} else {
+		steps = [][]string{
+			{"add", windowsMagnetKey, "/ve", "/d", "URL:Magnet Protocol", "/f"},
+			{"add", windowsMagnetKey, "/v", "URL Protocol", "/d", "", "/f"},
+			{"add", windowsMagnetKey + `\DefaultIcon`, "/ve", "/d", opts.exe + ",0", "/f"},
+			{"add", windowsMagnetKey + `\shell\open\command`, "/ve", "/d", `"` + opts.exe + `" "%1"`, "/f"},
+		}
+	}
+	for _, step := range steps {
+		if opts.dryRun {
+			fmt.Printf("would run: reg %s\n", strings.Join(step, " "))
+			continue
+		}
+		if err := execCommand("reg", step...); err != nil {
+			return fmt.Errorf("reg %s: %w", step[0], err)
+		}
+	}
+	if !opts.dryRun {
+		if opts.unregister {
+			logger.Infof("removed magnet: handler from %s", windowsMagnetKey)
+		} else {
+			logger.Infof("registered %s as the magnet: handler under %s", opts.exe, windowsMagnetKey)
+		}
+	}
+	return nil
+}
+
+// windowsHandlerCommand returns the registered magnet: command line.
+func windowsHandlerCommand() (string, error) {
+	out, err := execOutput("reg", "query", windowsCommandKey, "/ve")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if _, value, ok := strings.Cut(line, "REG_SZ"); ok {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no command", windowsCommandKey)
+}
+
+// sameProgram reports whether prog and exe name the same binary. Windows
+// paths compare case-insensitively.
+func sameProgram(prog, exe string) bool {
+	if strings.EqualFold(filepath.Clean(prog), filepath.Clean(exe)) {
+		return true
+	}
+	a, errA := os.Stat(prog)
+	b, errB := os.Stat(exe)
+	return errA == nil && errB == nil && os.SameFile(a, b)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/logging"
+)
+
+func TestSetMimeDefault(t *testing.T) {
+	existing := "[Added Associations]\ntext/plain=vim.desktop;\n\n[Default Applications]\ntext/html=firefox.desktop;\n\n[Removed Associations]\n"
+
+	got := setMimeDefault(existing, magnetMIME, handlerDesktopName, handlerDesktopName)
+	want := "[Added Associations]\ntext/plain=vim.desktop;\n\n[Default Applications]\ntext/html=firefox.desktop;\nx-scheme-handler/magnet=magnet2torrent.desktop;\n\n[Removed Associations]\n"
+	if got != want {
+		t.Fatalf("set:\n%s\nwant:\n%s", got, want)
+	}
+	if again := setMimeDefault(got, magnetMIME, handlerDesktopName, handlerDesktopName); again != got {
+		t.Fatalf("setting twice changed the file:\n%s", again)
+	}
+	if removed := setMimeDefault(got, magnetMIME, "", handlerDesktopName); removed != existing {
+		t.Fatalf("remove:\n%s\nwant:\n%s", removed, existing)
+	}
+
+	other := "[Default Applications]\nx-scheme-handler/magnet=transmission.desktop;\n"
+	if kept := setMimeDefault(other, magnetMIME, "", handlerDesktopName); kept != other {
+		t.Fatalf("unregister removed another handler:\n%s", kept)
+	}
+	if created := setMimeDefault("", magnetMIME, handlerDesktopName, handlerDesktopName); created != "[Default Applications]\nx-scheme-handler/magnet=magnet2torrent.desktop;\n" {
+		t.Fatalf("create:\n%s", created)
+	}
+}
+
+func TestRegisterXDG(t *testing.T) {
+	origExec := execCommand
+	t.Cleanup(func() { execCommand = origExec })
+	execCommand = func(string, ...string) error { return nil }
+
+	dir := t.TempDir()
+	opts := registerOptions{
+		exe:      "/opt/magnet 2 torrent/bin/magnet2torrent",
+		appsDir:  filepath.Join(dir, "applications"),
+		mimeapps: filepath.Join(dir, "mimeapps.list"),
+	}
+	logger := logging.NewLogger("error", "")
+	if err := registerXDG(opts, logger); err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+
+	desktop, err := os.ReadFile(filepath.Join(opts.appsDir, handlerDesktopName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(desktop), "Exec=\"/opt/magnet 2 torrent/bin/magnet2torrent\" %u\n") {
+		t.Fatalf("desktop entry:\n%s", desktop)
+	}
+	mimeapps, _ := os.ReadFile(opts.mimeapps)
+	if !strings.Contains(string(mimeapps), "x-scheme-handler/magnet=magnet2torrent.desktop;") {
+		t.Fatalf("mimeapps.list:\n%s", mimeapps)
+	}
+
+	opts.unregister = true
+	if err := registerXDG(opts, logger); err != nil {
+		t.Fatalf("unregister error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(opts.appsDir, handlerDesktopName)); !os.IsNotExist(err) {
+		t.Fatalf("desktop entry still present: %v", err)
+	}
+	if mimeapps, _ := os.ReadFile(opts.mimeapps); strings.Contains(string(mimeapps), "magnet2torrent") {
+		t.Fatalf("mimeapps.list still names us:\n%s", mimeapps)
+	}
+}
+
+func TestUnregisterWindowsLeavesOtherHandlers(t *testing.T) {
+	origExec, origOutput := execCommand, execOutput
+	t.Cleanup(func() { execCommand, execOutput = origExec, origOutput })
+	var ran []string
+	execCommand = func(name string, args ...string) error {
+		ran = append(ran, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	registered := `"C:\Program Files\qBittorrent\qbittorrent.exe" "%1"`
+	execOutput = func(string, ...string) ([]byte, error) {
+		return []byte("\r\n" + windowsCommandKey + "\r\n    (Default)    REG_SZ    " + registered + "\r\n"), nil
+	}
+	logger := logging.NewLogger("error", "")
+	opts := registerOptions{exe: `C:\Tools\magnet2torrent.exe`, unregister: true}
+
+	if err := registerWindows(opts, logger); err != nil || len(ran) != 0 {
+		t.Fatalf("removed another client's handler: %v, ran %v", err, ran)
+	}
+
+	registered = `"C:\tools\Magnet2Torrent.exe" "%1"`
+	if err := registerWindows(opts, logger); err != nil || len(ran) != 1 || !strings.HasPrefix(ran[0], "reg delete "+windowsMagnetKey) {
+		t.Fatalf("own handler not removed: %v, ran %v", err, ran)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+)
+
+// reloadInterval is how often serve looks for config file changes.
+const reloadInterval = 2 * time.Second
+
+// configWatcher keeps the config of a long-running command current. It polls
+// the config files, included ones too, and when one changes loads and
+// validates them again. A change that does not load or validate is logged and
+// the previous config stays active.
+type configWatcher struct {
+	load   func() (*config.Config, error)
+	paths  func() []string
+	logger *logging.Logger
+
+	cfg atomic.Pointer[config.Config]
+	// mu serializes checks; stamps is only used under it.
+	mu     sync.Mutex
+	stamps map[string]fileStamp
+}
+
+// fileStamp is what a poll compares; a missing file has the zero stamp, so
+// creating or removing one counts as a change too.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newConfigWatcher(cfg *config.Config, logger *logging.Logger) *configWatcher {
+	w := &configWatcher{
+		load: func() (*config.Config, error) {
+			cfg, _, err := config.Load(configSources())
+			return cfg, err
+		},
+		logger: logger,
+	}
+	w.paths = func() []string {
+		src := configSources()
+		return append([]string{src.System, src.User, src.Extra}, w.Config().Files()...)
+	}
+	w.cfg.Store(cfg)
+	w.stamps = w.stat()
+	return w
+}
+
+// Config returns the active config. Callers must not modify it.
+func (w *configWatcher) Config() *config.Config {
+	return w.cfg.Load()
+}
+
+// run checks for changes every interval until ctx is done.
+func (w *configWatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check reloads the config if a file changed since the last check and
+// returns the previous config when the new one was swapped in, nil otherwise.
+func (w *configWatcher) check() (old *config.Config) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stamps := w.stat()
+	if reflect.DeepEqual(stamps, w.stamps) {
+		return nil
+	}
+	// An invalid edit is reported once, not on every poll until it is fixed.
+	w.stamps = stamps
+
+	cfg, err := w.load()
+	if err == nil {
+		err = validateReload(cfg, w.logger)
+	}
+	if err != nil {
+		w.logger.Errorf("config reload: %v; keeping the previous config", err)
+		return nil
+	}
+	old = w.cfg.Swap(cfg)
+	// Includes may have been added or removed.
+	w.stamps = w.stat()
+
+	changes := configChanges(old, cfg)
+	if len(changes) == 0 {
+		w.logger.Debugf("config reload: files changed, settings did not")
+		return old
+	}
+	for _, c := range changes {
+		w.logger.Infof("config reload: %s", c)
+	}
+	for _, name := range changedServers(old, cfg) {
+		w.logger.Infof("config reload: server %s has new connection settings", name)
+	}
+	if old.LogLevel != cfg.LogLevel || old.LogFile != cfg.LogFile {
+		w.logger.Warnf("config reload: logLevel and logFile take effect on restart")
+	}
+	return old
+}
+
+func (w *configWatcher) stat() map[string]fileStamp {
+	stamps := map[string]fileStamp{}
+	for _, path := range w.paths() {
+		if path == "" {
+			continue
+		}
+		var s fileStamp
+		if info, err := os.Stat(path); err == nil {
+			s = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		stamps[path] = s
+	}
+	return stamps
+}
+
+// validateReload logs warnings and returns the problems that reject cfg.
+func validateReload(cfg *config.Config, logger *logging.Logger) error {
+	warnings, err := cfg.Validate()
+	for _, w := range warnings {
+		logger.Warnf("config reload: %s", w)
+	}
+	var invalid *config.ValidationError
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	for _, p := range invalid.Problems {
+		logger.Errorf("config reload: %s", p)
+	}
+	return fmt.Errorf("%d invalid setting(s)", len(invalid.Problems))
+}
+
+// configChanges describes the settings that differ between old and cur, one
+// line each, with secrets masked.
+func configChanges(old, cur *config.Config) []string {
+	before, after := settingValues(old), settingValues(cur)
+	shownBefore, shownAfter := settingValues(old.Redacted()), settingValues(cur.Redacted())
+
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	var changes []string
+	for _, k := range sortedKeys(keys) {
+		b, inBefore := before[k]
+		a, inAfter := after[k]
+		switch {
+		case !inBefore:
+			changes = append(changes, fmt.Sprintf("%s set to %s", k, shownAfter[k]))
+		case !inAfter:
+			changes = append(changes, fmt.Sprintf("%s removed", k))
+		case a == b:
+		case shownBefore[k] == shownAfter[k]:
+			// A masked secret changed.
+			changes = append(changes, fmt.Sprintf("%s changed", k))
+		default:
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", k, shownBefore[k], shownAfter[k]))
+		}
+	}
+	return changes
+}
+
+// settingValues maps each setting to its value as JSON.
+func settingValues(cfg *config.Config) map[string]string {
+	settings, err := cfg.Settings()
+	if err != nil {
+		return nil
+	}
+	values := make(map[string]string, len(settings))
+	for _, s := range settings {
+		data, err := json.Marshal(s.Value)
+		if err != nil {
+			continue
+		}
+		values[s.Key] = string(data)
+	}
+	return values
+}
+
+// changedServers lists the profiles whose connection settings differ between
+// old and cur, including ones added or removed.
+func changedServers(old, cur *config.Config) []string {
+	names := map[string]bool{}
+	for _, n := range old.ServerNames() {
+		names[n] = true
+	}
+	for _, n := range cur.ServerNames() {
+		names[n] = true
+	}
+	var changed []string
+	for _, name := range sortedKeys(names) {
+		before, errBefore := old.Server(name)
+		after, errAfter := cur.Server(name)
+		if (errBefore == nil) != (errAfter == nil) || !reflect.DeepEqual(before, after) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
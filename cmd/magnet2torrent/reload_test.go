@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+)
+
+func TestConfigWatcherReloads(t *testing.T) {
+	path := useConfigFile(t)
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"qbHost": "http://nas:8080", "qbUsername": "admin", "qbPassword": "secret"}`)
+	cfg, err := loadEffectiveConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newConfigWatcher(cfg, logging.NewLogger("error", ""))
+	if old := w.check(); old != nil {
+		t.Fatalf("check reloaded an unchanged config")
+	}
+
+	write(`{"qbHost": "http://nas:9090", "qbUsername": "admin", "qbPassword": "secret"}`)
+	if old := w.check(); old != cfg || w.Config().QbHost != "http://nas:9090" {
+		t.Fatalf("edit not picked up: old %p, qbHost %q", old, w.Config().QbHost)
+	}
+
+	active := w.Config()
+	write(`{"qbHost": "http://nas:9090", "qbUsername": "admin", "qbPassword": "secret", "logLevel": "verbose"}`)
+	if old := w.check(); old != nil || w.Config() != active {
+		t.Fatalf("invalid edit was swapped in")
+	}
+	write(`{"qbHost": "http://nas:9090", "qbUsername": "admin", "qbPassword": "secret", "logLevel": `)
+	if old := w.check(); old != nil || w.Config() != active {
+		t.Fatalf("unparsable edit was swapped in")
+	}
+}
+
+func TestConfigChanges(t *testing.T) {
+	old := &config.Config{
+		QbHost:     "http://localhost:8080",
+		QbPassword: "secret",
+		Servers:    map[string]config.Server{"nas": {Host: "https://nas:8080"}, "box": {Host: "https://box"}},
+	}
+	cur := &config.Config{
+		QbHost:     "http://localhost:8080",
+		QbPassword: "hunter2",
+		LogLevel:   "debug",
+		Servers:    map[string]config.Server{"nas": {Host: "https://nas:9090"}, "box": {Host: "https://box"}},
+	}
+
+	want := []string{
+		`logLevel: "" -> "debug"`,
+		"qbPassword changed",
+		`servers.nas.host: "https://nas:8080" -> "https://nas:9090"`,
+	}
+	if got := configChanges(old, cur); !reflect.DeepEqual(got, want) {
+		t.Fatalf("configChanges = %q, want %q", got, want)
+	}
+	if got := changedServers(old, cur); !reflect.DeepEqual(got, []string{"default", "nas"}) {
+		t.Fatalf("changedServers = %v", got)
+	}
+}
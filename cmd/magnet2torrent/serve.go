@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+)
+
+// maxServeBody caps POST /add bodies; a few thousand magnet links fit easily.
+const maxServeBody = 1 << 20
+
+func runServe(args []string, cfg *config.Config, logger *logging.Logger) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	var (
+		listen = fs.String("listen", "127.0.0.1:8791", "address to listen on")
+		token  = fs.String("token", os.Getenv("MAGNET2TORRENT_TOKEN"), "require this token as ?token= or a Bearer Authorization header (default $MAGNET2TORRENT_TOKEN)")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: magnet2torrent [add flags] serve [-listen addr] [-token t]\n\nAccept magnet links on GET/POST /add (magnet= or url= parameters, or one link per line in a text/plain body) and add them like `add` would. Add flags given before `serve` apply to every request.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageErrorf("usage: magnet2torrent serve [-listen addr] [-token t]")
+	}
+	if *token == "" && !isLoopbackAddr(*listen) {
+		return usageErrorf("serve: listening on %s needs -token; without one only loopback addresses are allowed", *listen)
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	watcher := newConfigWatcher(cfg, logger)
+	current := func() (*config.Config, addOptions) {
+		cfg := watcher.Config()
+		opts := globalAddFlags.options(cfg, defaultWatchOptions())
+		// Requests must not block on -wait or -until-complete, and there is
+		// no terminal to draw progress on.
+		opts.wait, opts.untilComplete = false, false
+		return cfg, opts
+	}
+	srv := &http.Server{Handler: newServeHandler(current, logger, *token), ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go watcher.run(ctx, reloadInterval)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Infof("serving on http://%s/add", ln.Addr())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// newServeHandler routes /add and /healthz. Only links are accepted; a
+// request must never make us read a local .torrent path. current returns the
+// config and options to add with, which change as the config is reloaded;
+// each request connects anew, so it uses the servers' current settings.
+func newServeHandler(current func() (*config.Config, addOptions), logger *logging.Logger, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/add", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if token != "" && !serveAuthorized(r, token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if token == "" && !isLoopbackHost(r.Host) {
+			// A DNS name rebound to 127.0.0.1 would otherwise let any site
+			// reach us as its own origin.
+			http.Error(w, "requests must be addressed to localhost without a token", http.StatusForbidden)
+			return
+		}
+		if token == "" && !browserInitiated(r) {
+			// A page may navigate here, which is no worse than clicking a
+			// magnet link, but must not add torrents from scripts or images.
+			http.Error(w, "only browser navigations are accepted without a token", http.StatusForbidden)
+			return
+		}
+		links, err := serveLinks(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(links) == 0 {
+			http.Error(w, "no magnet= or url= given", http.StatusBadRequest)
+			return
+		}
+
+		inputs := make([]batchInput, 0, len(links))
+		for _, link := range links {
+			if !isLink(link) {
+				http.Error(w, fmt.Sprintf("%q is not a magnet link or URL", link), http.StatusBadRequest)
+				return
+			}
+			inputs = append(inputs, batchInput{value: link, source: sourceServe})
+		}
+
+		cfg, opts := current()
+		results := processInputs(inputs, cfg, logger, opts, globalAddFlags.concurrency)
+		status := http.StatusOK
+		lines := make([]resultJSON, 0, len(results))
+		for _, res := range results {
+			line := newResultJSON(res)
+			if res.err != nil {
+				logger.Errorf("serve: %s: %v", res.input, res.err)
+				status = http.StatusBadGateway
+				if line.Code == codeInput || line.Code == codeUsage {
+					status = http.StatusBadRequest
+				}
+			}
+			lines = append(lines, line)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(lines)
+	})
+	return mux
+}
+
+// serveLinks collects magnet= and url= parameters, plus one link per line of
+// a text/plain POST body.
+func serveLinks(r *http.Request) ([]string, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxServeBody)
+	var links []string
+	if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") {
+		lines, err := readInputLines(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, lines...)
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"magnet", "url"} {
+		for _, v := range r.Form[key] {
+			if v = strings.TrimSpace(v); v != "" {
+				links = append(links, v)
+			}
+		}
+	}
+	return links, nil
+}
+
+func serveAuthorized(r *http.Request, token string) bool {
+	given := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		given = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// browserInitiated reports whether a request is one the user made: typed in
+// or bookmarked, from a page of ours, or a navigation from another site.
+// Requests without Sec-Fetch-Site, from old browsers or other programs,
+// cannot be told apart from a script on another site, so they need a token.
+func browserInitiated(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "none", "same-origin":
+		return true
+	case "same-site", "cross-site":
+		return r.Header.Get("Sec-Fetch-Mode") == "navigate"
+	}
+	return false
+}
+
+// isLoopbackHost reports whether a Host header names this machine.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLoopbackAddr reports whether a listen address only accepts local
+// connections.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
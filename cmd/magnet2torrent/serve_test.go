@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+)
+
+func TestServeHandler(t *testing.T) {
+	stub := &stubQBClient{}
+	useStubClient(t, stub)
+	logger := logging.NewLogger("error", "")
+	magnet := "magnet:?xt=urn:btih:" + testHash
+	h := newServeHandler(fixedConfig(testConfig()), logger, "secret")
+
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(httptest.NewRequest(http.MethodGet, "/add?magnet="+url.QueryEscape(magnet), nil)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: status %d", rec.Code)
+	}
+
+	rec := do(httptest.NewRequest(http.MethodGet, "/add?token=secret&magnet="+url.QueryEscape(magnet), nil))
+	if rec.Code != http.StatusOK || stub.lastMagnet != magnet {
+		t.Fatalf("GET add: status %d, body %s, magnet %q", rec.Code, rec.Body, stub.lastMagnet)
+	}
+	var results []resultJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 1 || results[0].Status != "added" {
+		t.Fatalf("results = %+v, %v", results, err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader("/etc/passwd\n"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", "Bearer secret")
+	if rec := do(req); rec.Code != http.StatusBadRequest {
+		t.Fatalf("local path: status %d", rec.Code)
+	}
+}
+
+// fixedConfig is a newServeHandler config source that never reloads.
+func fixedConfig(cfg *config.Config) func() (*config.Config, addOptions) {
+	return func() (*config.Config, addOptions) { return cfg, addOptions{} }
+}
+
+func TestServeRejectsCrossSiteWithoutToken(t *testing.T) {
+	useStubClient(t, &stubQBClient{})
+	h := newServeHandler(fixedConfig(testConfig()), logging.NewLogger("error", ""), "")
+
+	req := httptest.NewRequest(http.MethodGet, "/add?magnet="+url.QueryEscape("magnet:?xt=urn:btih:"+testHash), nil)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	req.Header.Set("Sec-Fetch-Mode", "no-cors")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("cross-site fetch: status %d", rec.Code)
+	}
+
+	for _, tc := range []struct {
+		host, site, mode string
+		want             int
+	}{
+		{"127.0.0.1:8791", "cross-site", "navigate", http.StatusOK},
+		{"localhost:8791", "none", "navigate", http.StatusOK},
+		{"[::1]:8791", "same-origin", "cors", http.StatusOK},
+		{"127.0.0.1:8791", "", "", http.StatusForbidden},
+		{"rebound.example:8791", "same-origin", "cors", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/add?magnet="+url.QueryEscape("magnet:?xt=urn:btih:"+testHash), nil)
+		req.Host = tc.host
+		if tc.site != "" {
+			req.Header.Set("Sec-Fetch-Site", tc.site)
+			req.Header.Set("Sec-Fetch-Mode", tc.mode)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("Host %s, Sec-Fetch-Site %q: status %d, want %d", tc.host, tc.site, rec.Code, tc.want)
+		}
+	}
+
+	if !isLoopbackAddr("127.0.0.1:8791") || !isLoopbackAddr("localhost:1") || isLoopbackAddr(":8791") || isLoopbackAddr("0.0.0.0:8791") {
+		t.Fatalf("isLoopbackAddr misclassified an address")
+	}
+}
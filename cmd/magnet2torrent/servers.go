@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+)
+
+// serverInfo is the secret-free view of a server profile shown by `servers`.
+type serverInfo struct {
+	Name    string `json:"name"`
+	Host    string `json:"host"`
+	Auth    string `json:"auth"`
+	Proxy   string `json:"proxy,omitempty"`
+	Default bool   `json:"default"`
+}
+
+func runServers(args []string, cfg *config.Config, logger *logging.Logger) error {
+	fs := flag.NewFlagSet("servers", flag.ContinueOnError)
+	format := fs.String("format", "table", "output format: table or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageErrorf("usage: magnet2torrent servers [-format table|json]")
+	}
+
+	selected, err := cfg.Server("")
+	if err != nil {
+		return withCode(codeConfig, err)
+	}
+	var servers []serverInfo
+	for _, name := range cfg.ServerNames() {
+		srv, err := cfg.Server(name)
+		if err != nil {
+			return withCode(codeConfig, err)
+		}
+		auth := srv.Auth
+		if auth == "" {
+			auth = config.AuthPassword
+		}
+		servers = append(servers, serverInfo{Name: name, Host: redactURL(srv.Host), Auth: auth, Proxy: redactURL(srv.Proxy), Default: name == selected.Name})
+	}
+	return renderServers(os.Stdout, *format, servers)
+}
+
+func renderServers(w io.Writer, format string, servers []serverInfo) error {
+	switch format {
+	case "json":
+		if servers == nil {
+			servers = []serverInfo{}
+		}
+		return writeJSON(w, servers)
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "\tNAME\tHOST\tAUTH\tPROXY")
+		for _, s := range servers {
+			mark := ""
+			if s.Default {
+				mark = "*"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", mark, s.Name, s.Host, s.Auth, s.Proxy)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q; use table or json", format)
+	}
+}
+
+// redactURL hides the password in a host or proxy URL.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	return u.Redacted()
+}
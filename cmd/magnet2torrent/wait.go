@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+// waitPollInterval is how often the torrent is polled while waiting; tests
+// shorten it.
+var waitPollInterval = 2 * time.Second
+
+var errWaitTimeout = errors.New("timed out")
+
+// waitForMetadata polls qBittorrent until the torrent identified by hash has
+// left the metadata download state, then returns it. A torrent that is not
+// listed yet is treated as still pending since qBittorrent adds asynchronously.
+func waitForMetadata(qb qbClient, hash string, timeout time.Duration, logger *logging.Logger) (*qbclient.Torrent, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		t, err := qb.TorrentByHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("query torrent %s: %w", hash, err)
+		}
+
+		switch {
+		case t == nil:
+			logger.Debugf("torrent %s not listed yet", hash)
+		case t.IsErrored():
+			return t, fmt.Errorf("torrent %s is in state %s", hash, t.State)
+		case !t.IsMetadataPending():
+			return t, nil
+		default:
+			logger.Debugf("torrent %s still fetching metadata (%s)", hash, t.State)
+		}
+
+		if time.Now().After(deadline) {
+			return t, fmt.Errorf("metadata for %s not received after %s: %w", hash, timeout, errWaitTimeout)
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// reportResolved prints the name, size and file count of a resolved torrent.
+func reportResolved(w io.Writer, qb qbClient, t *qbclient.Torrent) error {
+	files, err := qb.Files(t.Hash)
+	if err != nil {
+		return fmt.Errorf("list files of %s: %w", t.Hash, err)
+	}
+	size := t.TotalSize
+	if size == 0 {
+		size = t.Size
+	}
+	fmt.Fprintf(w, "resolved: %s (%s, %d files) [%s]\n", t.Name, formatBytes(size), len(files), t.Hash)
+	return nil
+}
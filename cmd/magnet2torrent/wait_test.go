@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+const testHash = "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+
+func shortWaitInterval(t *testing.T) {
+	t.Helper()
+	orig := waitPollInterval
+	waitPollInterval = time.Millisecond
+	t.Cleanup(func() { waitPollInterval = orig })
+}
+
+func TestWaitForMetadataResolves(t *testing.T) {
+	shortWaitInterval(t)
+
+	stub := &stubQBClient{byHash: []*qbclient.Torrent{
+		nil,
+		{Hash: testHash, State: "metaDL"},
+		{Hash: testHash, Name: "debian-12.iso", State: "downloading", TotalSize: 1024},
+	}}
+
+	got, err := waitForMetadata(stub, testHash, time.Second, logging.NewLogger("error", ""))
+	if err != nil {
+		t.Fatalf("waitForMetadata error: %v", err)
+	}
+	if got.Name != "debian-12.iso" {
+		t.Fatalf("unexpected torrent: %+v", got)
+	}
+}
+
+func TestWaitForMetadataTimeoutAndError(t *testing.T) {
+	shortWaitInterval(t)
+	logger := logging.NewLogger("error", "")
+
+	pending := &stubQBClient{byHash: []*qbclient.Torrent{{Hash: testHash, State: "metaDL"}}}
+	if _, err := waitForMetadata(pending, testHash, 5*time.Millisecond, logger); !errors.Is(err, errWaitTimeout) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+
+	errored := &stubQBClient{byHash: []*qbclient.Torrent{{Hash: testHash, State: "error"}}}
+	if _, err := waitForMetadata(errored, testHash, time.Second, logger); err == nil || !strings.Contains(err.Error(), "state error") {
+		t.Fatalf("expected error state, got %v", err)
+	}
+}
+
+func TestProcessMagnetWaitRequiresInfoHash(t *testing.T) {
+	stub := &stubQBClient{}
+	useStubClient(t, stub)
+
+	cfg := &config.Config{QbHost: "http://example.test", QbUsername: "admin", QbPassword: "password"}
+	err := processMagnet("magnet:?dn=no-hash", cfg, logging.NewLogger("error", ""), addOptions{wait: true, waitTimeout: time.Second})
+	if err == nil || !strings.Contains(err.Error(), "cannot follow") {
+		t.Fatalf("expected info-hash error, got %v", err)
+	}
+	if stub.lastMagnet != "" {
+		t.Fatalf("magnet should not be sent when it cannot be followed")
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"magnet2torrent/internal/config"
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+var (
+	errStalled = errors.New("stalled")
+	errRemoved = errors.New("removed")
+)
+
+var hashPattern = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// watchOptions control how progress is followed and reported.
+type watchOptions struct {
+	interval   time.Duration
+	stallAfter time.Duration
+	// logEvery spaces out progress lines when out is not a terminal.
+	logEvery time.Duration
+	tty      bool
+	out      io.Writer
+	// reconnect, when set, is called before each poll and returns a client
+	// to continue with after the config was reloaded, or nil.
+	reconnect func() (qbClient, error)
+}
+
+func defaultWatchOptions() watchOptions {
+	return watchOptions{
+		interval:   2 * time.Second,
+		stallAfter: 10 * time.Minute,
+		logEvery:   30 * time.Second,
+		tty:        isTerminal(os.Stdout),
+		out:        os.Stdout,
+	}
+}
+
+func runWatch(args []string, cfg *config.Config, logger *logging.Logger) error {
+	opts := defaultWatchOptions()
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.DurationVar(&opts.interval, "interval", opts.interval, "how often to poll qBittorrent")
+	fs.DurationVar(&opts.stallAfter, "stall-timeout", opts.stallAfter, "give up when progress has not moved for this long (0 disables)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: magnet2torrent watch [flags] <hash|name>\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("watch needs exactly one torrent hash or name")
+	}
+
+	qb, srv, err := connect(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	hash, err := resolveTorrent(qb, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// Follow config edits, staying on the server the torrent is on.
+	watcher := newConfigWatcher(cfg, logger)
+	opts.reconnect = func() (qbClient, error) {
+		old := watcher.check()
+		if old == nil {
+			return nil, nil
+		}
+		before, _ := old.Server(srv.Name)
+		after, err := watcher.Config().Server(srv.Name)
+		if err != nil || reflect.DeepEqual(before, after) {
+			return nil, err
+		}
+		qb, _, err := connectServer(watcher.Config(), srv.Name, logger)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("reconnected to %s with its new settings", srv.Name)
+		return qb, nil
+	}
+
+	_, err = watchTorrent(qb, hash, opts, logger)
+	return err
+}
+
+// resolveTorrent maps a hash or a (case-insensitive, partial) name to a single
+// torrent hash.
+func resolveTorrent(qb qbClient, target string) (string, error) {
+	if hashPattern.MatchString(target) {
+		return strings.ToLower(target), nil
+	}
+
+	torrents, err := qb.Torrents(qbclient.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("list torrents: %w", err)
+	}
+
+	var matches []qbclient.Torrent
+	needle := strings.ToLower(target)
+	for _, t := range torrents {
+		if strings.EqualFold(t.Name, target) {
+			return t.Hash, nil
+		}
+		if strings.Contains(strings.ToLower(t.Name), needle) {
+			matches = append(matches, t)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no torrent matches %q", target)
+	case 1:
+		return matches[0].Hash, nil
+	default:
+		names := make([]string, 0, len(matches))
+		for _, m := range matches {
+			names = append(names, m.Name)
+		}
+		return "", fmt.Errorf("%q matches %d torrents (%s); use the hash instead", target, len(matches), strings.Join(names, ", "))
+	}
+}
+
+// watchTorrent follows a torrent through sync/maindata until it completes,
+// errors, disappears or stops making progress for opts.stallAfter.
+func watchTorrent(qb qbClient, hash string, opts watchOptions, logger *logging.Logger) (*qbclient.Torrent, error) {
+	state := qbclient.NewSyncState()
+	var (
+		seen         bool
+		lastProgress = -1.0
+		lastMoved    = time.Now()
+		lastLogged   time.Time
+	)
+
+	for {
+		if opts.reconnect != nil {
+			next, err := opts.reconnect()
+			switch {
+			case err != nil:
+				logger.Warnf("config reload: %v; keeping the current connection", err)
+			case next != nil:
+				qb, state = next, qbclient.NewSyncState()
+			}
+		}
+
+		data, err := qb.SyncMainData(state.Rid)
+		if err != nil {
+			return nil, fmt.Errorf("sync with qBittorrent: %w", err)
+		}
+		if err := state.Apply(data); err != nil {
+			return nil, err
+		}
+
+		t, ok := state.Torrent(hash)
+		switch {
+		case !ok && seen:
+			finishProgress(opts)
+			return nil, fmt.Errorf("torrent %s was removed: %w", hash, errRemoved)
+		case !ok:
+			logger.Debugf("torrent %s not listed yet", hash)
+		default:
+			seen = true
+			if t.Progress > lastProgress {
+				lastProgress = t.Progress
+				lastMoved = time.Now()
+			}
+
+			if opts.tty {
+				renderProgress(opts.out, t)
+			} else if time.Since(lastLogged) >= opts.logEvery || t.IsComplete() {
+				logger.Infof("%s: %.1f%% %s down %s/s up %s/s eta %s", t.Name, t.Progress*100, t.State, formatBytes(t.DlSpeed), formatBytes(t.UpSpeed), formatETA(t.ETA))
+				lastLogged = time.Now()
+			}
+
+			switch {
+			case t.IsErrored():
+				finishProgress(opts)
+				return t, fmt.Errorf("torrent %s is in state %s", t.Name, t.State)
+			case t.IsComplete():
+				finishProgress(opts)
+				logger.Infof("%s completed", t.Name)
+				return t, nil
+			}
+		}
+
+		if opts.stallAfter > 0 && time.Since(lastMoved) > opts.stallAfter {
+			finishProgress(opts)
+			return t, fmt.Errorf("torrent %s made no progress for %s: %w", hash, opts.stallAfter, errStalled)
+		}
+		time.Sleep(opts.interval)
+	}
+}
+
+const progressBarWidth = 30
+
+// renderProgress redraws a single-line progress bar in place.
+func renderProgress(w io.Writer, t *qbclient.Torrent) {
+	filled := int(t.Progress * progressBarWidth)
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+	fmt.Fprintf(w, "\r[%s] %5.1f%%  %9s/s  eta %-10s %s\x1b[K", bar, t.Progress*100, formatBytes(t.DlSpeed), formatETA(t.ETA), truncate(t.Name, 40))
+}
+
+func finishProgress(opts watchOptions) {
+	if opts.tty {
+		fmt.Fprintln(opts.out)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (info.Mode() & os.ModeCharDevice) != 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"magnet2torrent/internal/logging"
+	"magnet2torrent/internal/qbclient"
+)
+
+func mainData(rid int64, full bool, torrents map[string]string, removed ...string) *qbclient.MainData {
+	d := &qbclient.MainData{Rid: rid, FullUpdate: full, Torrents: map[string]json.RawMessage{}, TorrentsRemoved: removed}
+	for hash, raw := range torrents {
+		d.Torrents[hash] = json.RawMessage(raw)
+	}
+	return d
+}
+
+func testWatchOptions(tty bool) (watchOptions, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return watchOptions{interval: time.Millisecond, stallAfter: time.Second, tty: tty, out: &buf}, &buf
+}
+
+func TestWatchTorrentCompletes(t *testing.T) {
+	stub := &stubQBClient{mainData: []*qbclient.MainData{
+		mainData(1, true, map[string]string{testHash: `{"name":"debian","progress":0.2,"state":"downloading"}`}),
+		mainData(2, false, map[string]string{testHash: `{"progress":0.7}`}),
+		mainData(3, false, map[string]string{testHash: `{"progress":1,"state":"uploading"}`}),
+	}}
+	opts, out := testWatchOptions(true)
+
+	got, err := watchTorrent(stub, testHash, opts, logging.NewLogger("error", ""))
+	if err != nil {
+		t.Fatalf("watchTorrent error: %v", err)
+	}
+	if got.Name != "debian" || !got.IsComplete() {
+		t.Fatalf("unexpected torrent: %+v", got)
+	}
+	if !strings.Contains(out.String(), "100.0%") || !strings.Contains(out.String(), "[###") {
+		t.Fatalf("expected progress bar output, got %q", out.String())
+	}
+}
+
+func TestWatchTorrentStallsAndRemoval(t *testing.T) {
+	logger := logging.NewLogger("error", "")
+
+	stalled := &stubQBClient{mainData: []*qbclient.MainData{
+		mainData(1, true, map[string]string{testHash: `{"name":"debian","progress":0.2,"state":"stalledDL"}`}),
+		mainData(1, false, nil),
+	}}
+	opts, _ := testWatchOptions(false)
+	opts.stallAfter = 5 * time.Millisecond
+	if _, err := watchTorrent(stalled, testHash, opts, logger); !errors.Is(err, errStalled) {
+		t.Fatalf("expected stall error, got %v", err)
+	}
+
+	removed := &stubQBClient{mainData: []*qbclient.MainData{
+		mainData(1, true, map[string]string{testHash: `{"name":"debian","progress":0.2}`}),
+		mainData(2, false, nil, testHash),
+	}}
+	opts, _ = testWatchOptions(false)
+	if _, err := watchTorrent(removed, testHash, opts, logger); !errors.Is(err, errRemoved) {
+		t.Fatalf("expected removed error, got %v", err)
+	}
+}
+
+func TestResolveTorrent(t *testing.T) {
+	stub := &stubQBClient{torrents: []qbclient.Torrent{
+		{Hash: "aaa", Name: "debian-12.iso"},
+		{Hash: "bbb", Name: "debian-11.iso"},
+		{Hash: "ccc", Name: "fedora.iso"},
+	}}
+
+	if got, err := resolveTorrent(stub, "fedora"); err != nil || got != "ccc" {
+		t.Fatalf("resolveTorrent(fedora) = %q, %v", got, err)
+	}
+	if got, err := resolveTorrent(stub, "DEBIAN-12.ISO"); err != nil || got != "aaa" {
+		t.Fatalf("resolveTorrent(exact) = %q, %v", got, err)
+	}
+	if _, err := resolveTorrent(stub, "debian"); err == nil || !strings.Contains(err.Error(), "matches 2 torrents") {
+		t.Fatalf("expected ambiguity error, got %v", err)
+	}
+	if got, err := resolveTorrent(stub, strings.ToUpper(testHash)); err != nil || got != testHash {
+		t.Fatalf("resolveTorrent(hash) = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,149 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+// FormatVersion is bumped when the manifest layout changes incompatibly.
+const FormatVersion = 1
+
+const manifestName = "manifest.json"
+
+// Manifest describes the contents of a backup archive.
+type Manifest struct {
+	Version    int                 `json:"version"`
+	CreatedAt  time.Time           `json:"createdAt"`
+	Server     string              `json:"server"`
+	AppVersion string              `json:"appVersion,omitempty"`
+	Categories map[string]Category `json:"categories,omitempty"`
+	Torrents   []Entry             `json:"torrents"`
+}
+
+// Category records a category's save path so restore can recreate it.
+type Category struct {
+	SavePath string `json:"savePath"`
+}
+
+// Entry is one torrent. File names the .torrent inside the archive; when the
+// torrent had no metadata yet, File is empty and MagnetURI is used instead.
+type Entry struct {
+	Hash             string   `json:"hash"`
+	Name             string   `json:"name"`
+	File             string   `json:"file,omitempty"`
+	MagnetURI        string   `json:"magnetUri,omitempty"`
+	SavePath         string   `json:"savePath"`
+	Category         string   `json:"category,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	Stopped          bool     `json:"stopped,omitempty"`
+	UpLimit          int64    `json:"upLimit,omitempty"`
+	DlLimit          int64    `json:"dlLimit,omitempty"`
+	RatioLimit       float64  `json:"ratioLimit"`
+	SeedingTimeLimit int64    `json:"seedingTimeLimit"`
+}
+
+// TorrentPath is where the .torrent for hash is stored in an archive.
+func TorrentPath(hash string) string {
+	return path.Join("torrents", hash+".torrent")
+}
+
+// Writer streams a gzip-compressed tar archive. Torrent files are added as
+// they are exported and the manifest is written last by Close.
+type Writer struct {
+	gz  *gzip.Writer
+	tw  *tar.Writer
+	now time.Time
+}
+
+// NewWriter starts an archive on w.
+func NewWriter(w io.Writer) *Writer {
+	gz := gzip.NewWriter(w)
+	return &Writer{gz: gz, tw: tar.NewWriter(gz), now: time.Now()}
+}
+
+// AddFile stores data under name.
+func (w *Writer) AddFile(name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: w.now, Typeflag: tar.TypeReg}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write %s header: %w", name, err)
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close writes the manifest and finishes the archive.
+func (w *Writer) Close(m *Manifest) error {
+	m.Version = FormatVersion
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	if err := w.AddFile(manifestName, data); err != nil {
+		return err
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// Archive is a fully read backup.
+type Archive struct {
+	Manifest Manifest
+	Files    map[string][]byte
+}
+
+// Read loads an archive written by Writer.
+func Read(r io.Reader) (*Archive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("open backup: %w", err)
+	}
+	defer gz.Close()
+
+	archive := &Archive{Files: map[string][]byte{}}
+	var sawManifest bool
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read backup: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		if hdr.Name == manifestName {
+			if err := json.Unmarshal(data, &archive.Manifest); err != nil {
+				return nil, fmt.Errorf("parse manifest: %w", err)
+			}
+			sawManifest = true
+			continue
+		}
+		archive.Files[hdr.Name] = data
+	}
+
+	if !sawManifest {
+		return nil, errors.New("backup has no manifest.json")
+	}
+	if archive.Manifest.Version > FormatVersion {
+		return nil, fmt.Errorf("backup format %d is newer than supported %d", archive.Manifest.Version, FormatVersion)
+	}
+	for _, e := range archive.Manifest.Torrents {
+		if e.File != "" && archive.Files[e.File] == nil {
+			return nil, fmt.Errorf("backup is missing %s for %s", e.File, e.Name)
+		}
+	}
+	return archive, nil
+}
@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.AddFile(TorrentPath("aaa"), []byte("d4:infoe")); err != nil {
+		t.Fatalf("AddFile error: %v", err)
+	}
+	err := w.Close(&Manifest{
+		Server:     "home",
+		Categories: map[string]Category{"linux": {SavePath: "/data/iso"}},
+		Torrents: []Entry{
+			{Hash: "aaa", Name: "debian", File: TorrentPath("aaa"), SavePath: "/data/iso", Category: "linux", Tags: []string{"keep"}, RatioLimit: -2},
+			{Hash: "bbb", Name: "pending", MagnetURI: "magnet:?xt=urn:btih:bbb", SavePath: "/data"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	archive, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	m := archive.Manifest
+	if m.Version != FormatVersion || m.Server != "home" || len(m.Torrents) != 2 || m.Categories["linux"].SavePath != "/data/iso" {
+		t.Fatalf("manifest mismatch: %+v", m)
+	}
+	if string(archive.Files[m.Torrents[0].File]) != "d4:infoe" {
+		t.Fatalf("torrent file mismatch: %q", archive.Files[m.Torrents[0].File])
+	}
+	if m.Torrents[0].RatioLimit != -2 || m.Torrents[1].MagnetURI == "" {
+		t.Fatalf("entry mismatch: %+v", m.Torrents)
+	}
+}
+
+func TestReadRejectsIncompleteArchives(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Close(&Manifest{Torrents: []Entry{{Hash: "aaa", Name: "debian", File: TorrentPath("aaa")}}}); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if _, err := Read(&buf); err == nil || !strings.Contains(err.Error(), "missing torrents/aaa.torrent") {
+		t.Fatalf("expected missing file error, got %v", err)
+	}
+
+	if _, err := Read(strings.NewReader("not gzip")); err == nil {
+		t.Fatalf("expected error for non-gzip input")
+	}
+}
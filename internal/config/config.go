@@ -1,16 +1,30 @@
 package config
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+)
+
+// Duplicate policies for Config.DuplicatePolicy.
+const (
+	DuplicateSkip  = "skip"
+	DuplicateMerge = "merge"
+	DuplicateForce = "force"
 )
 
 // Config captures user-adjustable settings.
 type Config struct {
+	// ConfigVersion is the file format version; older files are upgraded
+	// on load, see CurrentVersion.
+	ConfigVersion int `json:"configVersion"`
+	// Include lists files merged in before this one, relative to it; see
+	// ParseFile.
+	Include []string `json:"include,omitempty"`
+
 	SaveDir    string `json:"saveDir"`
 	LogLevel   string `json:"logLevel"`
 	LogFile    string `json:"logFile"`
@@ -18,6 +32,38 @@ type Config struct {
 	QbUsername string `json:"qbUsername"`
 	QbPassword string `json:"qbPassword"`
 	QbHost     string `json:"qbHost"`
+	QbAuth     string `json:"qbAuth,omitempty"`
+
+	// AddedTag, when set, is attached to every torrent this tool adds so
+	// `list -mine` can find them again. It is empty by default.
+	AddedTag string `json:"addedTag"`
+	// AutoCreateCategory creates a missing category before adding a torrent
+	// that references it.
+	AutoCreateCategory bool `json:"autoCreateCategory,omitempty"`
+	// HistoryFile records every magnet handled; an empty string disables it.
+	HistoryFile string `json:"historyFile"`
+	// DuplicatePolicy decides what happens to a magnet whose torrent is
+	// already on the server: "skip" (default), "merge" or "force".
+	DuplicatePolicy string `json:"duplicatePolicy,omitempty"`
+	// FilePermissions decides what happens when a config file holding a
+	// password can be read by other users: "warn" (default), "refuse" or
+	// "ignore".
+	FilePermissions string `json:"filePermissions,omitempty"`
+
+	// Servers holds named qBittorrent profiles; DefaultServer picks the one
+	// used when no -server flag is given.
+	Servers       map[string]Server `json:"servers,omitempty"`
+	DefaultServer string            `json:"defaultServer,omitempty"`
+
+	// PathMaps translate save paths when migrating torrents between servers.
+	PathMaps []PathMap `json:"pathMaps,omitempty"`
+
+	// SchemaRef points editors at the JSON Schema; it is kept when saving.
+	SchemaRef string `json:"$schema,omitempty"`
+
+	// parsed is set by Parse so Validate can report unknown keys and
+	// positions in the file.
+	parsed *parseInfo
 }
 
 // DefaultConfig returns a config populated with sensible defaults.
@@ -30,10 +76,23 @@ func DefaultConfig() *Config {
 func GetDefaultConfigPath() string {
 	home, _ := os.UserHomeDir()
 	appdata := os.Getenv("APPDATA")
-	return defaultConfigPath(runtime.GOOS, home, appdata)
+	return existingConfigPath(defaultConfigPath(runtime.GOOS, home, appdata))
+}
+
+// existingConfigPath returns the config.json, config.yaml, config.yml or
+// config.toml next to path that exists, in that order, or path itself.
+func existingConfigPath(path string) string {
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range []string{".json", ".yaml", ".yml", ".toml"} {
+		if _, err := os.Stat(stem + ext); err == nil {
+			return stem + ext
+		}
+	}
+	return path
 }
 
-// LoadConfig attempts to read a JSON config; if missing, defaults are returned.
+// LoadConfig attempts to read a JSON, YAML or TOML config, chosen by the file
+// extension; if missing, defaults are returned.
 // The returned boolean is true when defaults were used (file missing).
 func LoadConfig(path string) (*Config, bool, error) {
 	cfg := DefaultConfig()
@@ -46,7 +105,8 @@ func LoadConfig(path string) (*Config, bool, error) {
 		return nil, false, fmt.Errorf("read config %s: %w", path, err)
 	}
 
-	if err := json.Unmarshal(data, cfg); err != nil {
+	cfg, err = ParseFile(path, data)
+	if err != nil {
 		return nil, false, fmt.Errorf("parse config %s: %w", path, err)
 	}
 
@@ -54,11 +114,14 @@ func LoadConfig(path string) (*Config, bool, error) {
 }
 
 func defaultConfig(home string) *Config {
+	logFile := defaultLogFile(runtime.GOOS, home, os.Getenv("LOCALAPPDATA"), os.Getenv("XDG_CACHE_HOME"))
 	return &Config{
-		SaveDir:  defaultSaveDir(home),
-		LogLevel: "info",
-		LogFile:  defaultLogFile(runtime.GOOS, home, os.Getenv("LOCALAPPDATA"), os.Getenv("XDG_CACHE_HOME")),
-		AppName:  "magnet2torrent",
+		ConfigVersion: CurrentVersion,
+		SaveDir:       defaultSaveDir(home),
+		LogLevel:      "info",
+		LogFile:       logFile,
+		HistoryFile:   filepath.Join(filepath.Dir(logFile), "history.jsonl"),
+		AppName:       "magnet2torrent",
 	}
 }
 
@@ -96,20 +159,71 @@ func defaultLogFile(goos string, home string, localAppData string, xdgCache stri
 	return filepath.Join(home, ".cache", "magnet2torrent", "magnet2torrent.log")
 }
 
-// SaveConfig writes the config JSON to the given path, creating parent dirs.
+// SaveConfig writes the config to the given path, creating parent dirs, in
+// the format its extension names. Values that come from the file's includes
+// are left to them. The file is written as CurrentVersion; when cfg was
+// upgraded from an older version, the original file is first copied to
+// path + ".bak". The file is replaced atomically with mode 0600; callers
+// that read, change and save it hold Lock. A YAML or TOML file with
+// comments is not rewritten, since they would be lost: SaveConfig returns
+// ErrComments and the file has to be edited by hand.
 func SaveConfig(path string, cfg *Config) error {
+	if current, err := os.ReadFile(path); err == nil && hasComments(path, current) { // #nosec G304 - the config path.
+		return fmt.Errorf("save config %s: %w", path, ErrComments)
+	}
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return fmt.Errorf("create config dir %s: %w", dir, err)
 	}
 
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	out := *cfg
+	out.ConfigVersion = CurrentVersion
+	data, err := Marshal(path, &out)
 	if err != nil {
 		return fmt.Errorf("marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0o600); err != nil {
+	if cfg.parsed != nil && cfg.parsed.migrated {
+		if err := backupFile(path); err != nil {
+			return err
+		}
+	}
+	if err := writeFile(path, data); err != nil {
+		return fmt.Errorf("write config %s: %w", path, err)
+	}
+	if cfg.parsed != nil {
+		// The file is current now; a later save must not replace the backup.
+		cfg.parsed.migrated = false
+	}
+	cfg.ConfigVersion = CurrentVersion
+	return nil
+}
+
+// SaveConfigData writes data, the full text of a config file such as an
+// edited copy, to path as it is, so its comments and layout are kept. The
+// file is replaced atomically with mode 0600.
+func SaveConfigData(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create config dir %s: %w", dir, err)
+	}
+	if err := writeFile(path, data); err != nil {
 		return fmt.Errorf("write config %s: %w", path, err)
 	}
 	return nil
 }
+
+// backupFile copies path to path + ".bak", replacing an older backup.
+func backupFile(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 - the config path.
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("back up config %s: %w", path, err)
+	}
+	if err := writeFile(path+".bak", data); err != nil {
+		return fmt.Errorf("back up config %s: %w", path, err)
+	}
+	return nil
+}
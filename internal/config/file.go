@@ -0,0 +1,185 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// File permission policies for Config.FilePermissions.
+const (
+	PermissionsWarn   = "warn"
+	PermissionsRefuse = "refuse"
+	PermissionsIgnore = "ignore"
+)
+
+// ErrLocked is returned by Lock when another process keeps the config
+// locked for longer than the caller waits.
+var ErrLocked = errors.New("config is locked by another process")
+
+// ErrComments is returned by SaveConfig for a YAML or TOML file with
+// comments, which rewriting it would drop.
+var ErrComments = errors.New("it has comments that rewriting it would drop; edit the file by hand")
+
+// errLockHeld is returned by lockFile when another process holds the lock.
+var errLockHeld = errors.New("lock held")
+
+// lockPoll is how often Lock retries; tests shorten it.
+var lockPoll = 100 * time.Millisecond
+
+// Lock takes an exclusive lock on the config file at path, so that
+// processes reading, changing and saving it do not interleave, and returns
+// the function that releases it. It waits up to wait for another process to
+// release the lock. The lock is held on a path + ".lock" file by the
+// operating system, which releases it when the process exits, so a crash
+// never leaves the config locked and a lock held through a long prompt is
+// never mistaken for a stale one.
+func Lock(path string, wait time.Duration) (unlock func(), err error) {
+	lockPath := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0o755); err != nil {
+		return nil, fmt.Errorf("lock config %s: %w", path, err)
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		unlock, err := lockFile(lockPath)
+		if err == nil {
+			return unlock, nil
+		}
+		if !errors.Is(err, errLockHeld) {
+			return nil, fmt.Errorf("lock config %s: %w", path, err)
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: another magnet2torrent holds %s", ErrLocked, lockPath)
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// writeLockOwner records the process holding the lock in f, for whoever
+// looks at the file; Lock does not read it.
+func writeLockOwner(f *os.File) {
+	if err := f.Truncate(0); err == nil {
+		fmt.Fprintf(f, "%d\n", os.Getpid())
+	}
+}
+
+// writeFile replaces path with data so that a crash leaves either the old
+// file or the new one, never a truncated mix: data goes to a temporary file
+// in the same directory, is synced to disk and renamed over path, and the
+// directory is synced so the rename lasts. The new file has mode 0600. A
+// symlinked config is written through the link.
+func writeFile(path string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0o600)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes a directory's entries. Windows cannot open directories
+// for this, and some filesystems refuse it; the file itself is synced
+// either way, so failures are ignored.
+func syncDir(dir string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	d, err := os.Open(dir) // #nosec G304 - the config directory.
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	d.Close()
+}
+
+// ExposedFiles reports the config files holding a password or other secret
+// that users other than the owner can read or write, one Problem each. It is
+// always empty on Windows, where file modes do not say who has access.
+func (c *Config) ExposedFiles() []Problem {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	var problems []Problem
+	for _, path := range c.secretFiles() {
+		info, err := os.Stat(path)
+		if err != nil || !exposedMode(info.Mode()) {
+			continue
+		}
+		problems = append(problems, Problem{
+			File:    path,
+			Message: fmt.Sprintf("mode %04o lets other users read the passwords in it", info.Mode().Perm()),
+			Warning: true,
+		})
+	}
+	return problems
+}
+
+func exposedMode(mode fs.FileMode) bool {
+	return mode.Perm()&0o077 != 0
+}
+
+// secretFiles lists the files that set a setting Redacted masks.
+func (c *Config) secretFiles() []string {
+	info := c.parsed
+	if info == nil {
+		return nil
+	}
+	plain, err := c.Settings()
+	if err != nil {
+		return nil
+	}
+	masked, err := c.Redacted().Settings()
+	if err != nil || len(masked) != len(plain) {
+		return nil
+	}
+	seen := map[string]bool{}
+	var files []string
+	for i, s := range plain {
+		if sameValue(s.Value, masked[i].Value) {
+			continue
+		}
+		loc, ok := info.lookup(s.Key)
+		if !ok || loc.source != "" || loc.file == "" || seen[loc.file] {
+			continue
+		}
+		seen[loc.file] = true
+		files = append(files, loc.file)
+	}
+	return files
+}
+
+// FixPermissions removes group and other access from the config file at
+// path.
+func FixPermissions(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(path, info.Mode().Perm()&0o700)
+}
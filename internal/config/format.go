@@ -0,0 +1,491 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config file formats, chosen by file extension.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// maxIncludeDepth bounds nested includes.
+const maxIncludeDepth = 8
+
+// FormatOf returns the format of a config file from its extension; anything
+// unrecognised is JSON.
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// location is where a key was written: a line of file, or for settings
+// given outside any file, the environment variable or flag in source.
+type location struct {
+	file      string
+	source    string
+	line, col int
+}
+
+// where names the file or source of loc, leaving out main, the file being
+// read, as messages about it already name it.
+func (loc location) where(main string) string {
+	if loc.source != "" {
+		return loc.source
+	}
+	if loc.file != main {
+		return loc.file
+	}
+	return ""
+}
+
+// document is a config file decoded into generic values: map[string]any,
+// []any, string, bool, nil and numbers (json.Number, int64 or float64).
+// Layered configs merge several into one.
+type document struct {
+	values map[string]any
+	// base holds what the includes contributed, before the file's own keys
+	// were merged over it.
+	base      map[string]any
+	locations map[string]location
+	// files lists the files read, includes first.
+	files []string
+}
+
+// decodeDocument decodes data in the format of path and merges in its
+// includes. stack lists the including files, to detect cycles.
+func decodeDocument(path string, data []byte, stack []string) (*document, error) {
+	var (
+		values    map[string]any
+		locations = map[string]location{}
+		err       error
+	)
+	switch FormatOf(path) {
+	case FormatYAML:
+		values, err = decodeYAML(data, locations)
+	case FormatTOML:
+		values, err = decodeTOML(data, locations)
+	default:
+		values, err = decodeJSON(data, locations)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = map[string]any{}
+	}
+	for key, loc := range locations {
+		loc.file = path
+		locations[key] = loc
+	}
+
+	own := &document{values: values, locations: locations}
+	if path != "" {
+		own.files = []string{path}
+	}
+	includes, err := includeList(values["include"])
+	if err != nil {
+		return nil, at(locations["include"], err)
+	}
+	if len(includes) == 0 {
+		return own, nil
+	}
+	if len(stack) >= maxIncludeDepth {
+		return nil, at(locations["include"], fmt.Errorf("includes nested more than %d deep", maxIncludeDepth))
+	}
+
+	doc := &document{values: map[string]any{}, locations: map[string]location{}}
+	for _, inc := range includes {
+		incPath := inc
+		if !filepath.IsAbs(incPath) {
+			incPath = filepath.Join(filepath.Dir(path), incPath)
+		}
+		for _, p := range append(stack, path) {
+			if sameFile(p, incPath) {
+				return nil, at(locations["include"], fmt.Errorf("%s includes itself", incPath))
+			}
+		}
+		incData, err := os.ReadFile(incPath) // #nosec G304 - includes are user-provided paths.
+		if err != nil {
+			return nil, at(locations["include"], fmt.Errorf("include: %w", err))
+		}
+		included, err := decodeDocument(incPath, incData, append(stack, path))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", incPath, err)
+		}
+		included.dropFileKeys()
+		doc.merge(included)
+	}
+	doc.base = cloneValue(doc.values).(map[string]any)
+	doc.merge(own)
+	return doc, nil
+}
+
+// fileKeys describe a file itself rather than settings, so they are not
+// taken from included or lower-precedence files.
+var fileKeys = []string{"include", "configVersion", "$schema"}
+
+func (d *document) dropFileKeys() {
+	for _, key := range fileKeys {
+		delete(d.values, key)
+		forget(d.locations, key)
+	}
+}
+
+// forget drops the positions of key and everything under it.
+func forget(locations map[string]location, key string) {
+	for k := range locations {
+		if k == key || strings.HasPrefix(k, key+".") || strings.HasPrefix(k, key+"[") {
+			delete(locations, k)
+		}
+	}
+}
+
+// merge merges src over d as mergeValues does, keeping the positions of
+// whichever value wins.
+func (d *document) merge(src *document) {
+	var replaced func(src, dst map[string]any, path string)
+	replaced = func(src, dst map[string]any, path string) {
+		for k, v := range src {
+			child := joinKey(path, k)
+			srcMap, srcIsMap := v.(map[string]any)
+			dstMap, dstIsMap := dst[k].(map[string]any)
+			if srcIsMap && dstIsMap {
+				replaced(srcMap, dstMap, child)
+				continue
+			}
+			forget(d.locations, child)
+		}
+	}
+	replaced(src.values, d.values, "")
+	mergeValues(d.values, src.values)
+	for k, loc := range src.locations {
+		d.locations[k] = loc
+	}
+	d.files = append(d.files, src.files...)
+}
+
+func includeList(v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf("include must list file paths")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("include must list file paths")
+	}
+}
+
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	ai, errA := os.Stat(a)
+	bi, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(ai, bi)
+}
+
+// at prefixes err with a position when one is known.
+func at(loc location, err error) error {
+	if loc.line == 0 {
+		return err
+	}
+	return fmt.Errorf("line %d, column %d: %w", loc.line, loc.col, err)
+}
+
+// mergeValues merges src into dst: objects merge key by key, anything else,
+// lists included, is replaced.
+func mergeValues(dst, src map[string]any) map[string]any {
+	for key, v := range src {
+		srcMap, srcIsMap := v.(map[string]any)
+		dstMap, dstIsMap := dst[key].(map[string]any)
+		if srcIsMap && dstIsMap {
+			dst[key] = mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[key] = cloneValue(v)
+	}
+	return dst
+}
+
+func cloneValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = cloneValue(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = cloneValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// decodeJSON decodes a JSON document, recording where each key starts.
+func decodeJSON(data []byte, locations map[string]location) (map[string]any, error) {
+	var values map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			// Offset counts the offending byte.
+			line, col := position(data, max(syntaxErr.Offset-1, 0))
+			return nil, fmt.Errorf("line %d, column %d: %w", line, col, err)
+		}
+		return nil, fmt.Errorf("config must be a JSON object: %w", err)
+	}
+	if dec.More() {
+		line, col := position(data, dec.InputOffset())
+		return nil, fmt.Errorf("line %d, column %d: unexpected data after the config object", line, col)
+	}
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	jsonLocations(data, bytes.TrimSpace(trimmed), int64(len(data)-len(trimmed)), "", locations)
+	return values, nil
+}
+
+// jsonLocations records the position of every key in raw, a JSON value that
+// starts at offset base of data.
+func jsonLocations(data, raw []byte, base int64, path string, locations map[string]location) {
+	if len(raw) == 0 || (raw[0] != '{' && raw[0] != '[') {
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return
+	}
+	for i := 0; dec.More(); i++ {
+		child := fmt.Sprintf("%s[%d]", path, i)
+		var start int64
+		if raw[0] == '{' {
+			tok, err := dec.Token()
+			if err != nil {
+				return
+			}
+			key, _ := tok.(string)
+			child = joinKey(path, key)
+			start = int64(bytes.LastIndexByte(raw[:dec.InputOffset()-1], '"'))
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return
+		}
+		valueStart := dec.InputOffset() - int64(len(value))
+		if raw[0] == '[' {
+			start = valueStart
+		}
+		line, col := position(data, base+start)
+		locations[child] = location{line: line, col: col}
+		jsonLocations(data, value, base+valueStart, child, locations)
+	}
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// object is a JSON object that keeps its key order, so files are written in
+// the order of the Config fields.
+type object struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		value, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeOrdered decodes JSON keeping object key order.
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := &object{values: map[string]any{}}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := keyTok.(string)
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.keys = append(obj.keys, key)
+			obj.values[key] = value
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []any{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	default:
+		return tok, nil
+	}
+}
+
+// prune drops the keys of obj whose values equal those in base, so a saved
+// file keeps relying on its includes rather than copying them. Below the top
+// level, where a missing key decodes as the zero value rather than a default,
+// zero values the includes do not set are dropped too.
+func prune(obj *object, base map[string]any, nested bool) {
+	keys := obj.keys[:0]
+	for _, k := range obj.keys {
+		v := obj.values[k]
+		baseValue, inBase := base[k]
+		if child, ok := v.(*object); ok {
+			if baseMap, ok := baseValue.(map[string]any); ok {
+				prune(child, baseMap, true)
+				if len(child.keys) == 0 {
+					delete(obj.values, k)
+					continue
+				}
+			}
+		} else if (inBase && sameValue(v, baseValue)) || (nested && !inBase && isZero(v)) {
+			delete(obj.values, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	obj.keys = keys
+}
+
+// sameValue compares decoded values by their JSON encoding with object keys
+// sorted, which ignores key order and how numbers were decoded.
+func sameValue(a, b any) bool {
+	aj, errA := canonicalJSON(a)
+	bj, errB := canonicalJSON(b)
+	return errA == nil && errB == nil && bytes.Equal(aj, bj)
+}
+
+func canonicalJSON(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var plain any
+	if err := dec.Decode(&plain); err != nil {
+		return nil, err
+	}
+	return json.Marshal(plain)
+}
+
+func isZero(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	}
+	return false
+}
+
+// Marshal encodes cfg in the format of path, leaving out values that cfg's
+// includes already provide.
+func Marshal(path string, cfg *Config) ([]byte, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	tree, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	obj := tree.(*object)
+	if cfg.parsed != nil && cfg.parsed.base != nil {
+		prune(obj, cfg.parsed.base, false)
+	}
+
+	switch FormatOf(path) {
+	case FormatYAML:
+		return encodeYAML(obj), nil
+	case FormatTOML:
+		return encodeTOML(obj), nil
+	default:
+		return json.MarshalIndent(obj, "", "  ")
+	}
+}
+
+// hasComments reports whether data, a config file in the format of path, has
+// comments. JSON cannot.
+func hasComments(path string, data []byte) bool {
+	switch FormatOf(path) {
+	case FormatYAML:
+		return yamlHasComments(data)
+	case FormatTOML:
+		return tomlHasComments(data)
+	default:
+		return false
+	}
+}
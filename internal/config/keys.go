@@ -0,0 +1,253 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// redactedValue replaces secrets in Redacted output.
+const redactedValue = "********"
+
+// Get returns the setting at a dotted key as named in the config file, such
+// as "logLevel", "servers.nas.host" or "servers.nas.headers.X-Api-Key".
+func (c *Config) Get(key string) (any, error) {
+	v := reflect.ValueOf(c).Elem()
+	path := strings.Split(key, ".")
+	for i, seg := range path {
+		switch v.Kind() {
+		case reflect.Pointer:
+			if v.IsNil() {
+				return nil, fmt.Errorf("%s is not set", strings.Join(path[:i], "."))
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			f, ok := jsonField(v, seg)
+			if !ok {
+				return nil, unknownKeyError(key, path[:i], v.Type())
+			}
+			v = f
+		case reflect.Map:
+			elem := v.MapIndex(reflect.ValueOf(seg))
+			if !elem.IsValid() {
+				return nil, fmt.Errorf("%s is not set", strings.Join(path[:i+1], "."))
+			}
+			v = elem
+		default:
+			return nil, fmt.Errorf("%s is a %s and has no %q", strings.Join(path[:i], "."), kindName(v.Type()), seg)
+		}
+	}
+	return v.Interface(), nil
+}
+
+// Set parses value as the type of the setting at key and stores it. Strings
+// are taken as is, booleans and integers are parsed, and lists or objects
+// such as pathMaps must be given as JSON. Missing map entries, like a new
+// server profile, are created. The new value must pass Validate, though
+// problems elsewhere in the config do not block it; after an error c holds
+// the rejected value and should be discarded.
+func (c *Config) Set(key, value string) error {
+	if err := setPath(reflect.ValueOf(c).Elem(), key, strings.Split(key, "."), 0, value); err != nil {
+		return err
+	}
+	_, err := c.Validate()
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		for _, p := range invalid.Problems {
+			if p.Key == key || strings.HasPrefix(p.Key, key+".") || strings.HasPrefix(p.Key, key+"[") {
+				return fmt.Errorf("%s: %s", p.Key, p.Message)
+			}
+		}
+	}
+	return nil
+}
+
+func setPath(v reflect.Value, key string, path []string, i int, value string) error {
+	if v.Kind() == reflect.Pointer && i < len(path) {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if i == len(path) {
+		return parseValue(v, key, value)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		f, ok := jsonField(v, path[i])
+		if !ok {
+			return unknownKeyError(key, path[:i], v.Type())
+		}
+		return setPath(f, key, path, i+1, value)
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		// Map entries are not addressable: update a copy and store it back.
+		k := reflect.ValueOf(path[i])
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(k); existing.IsValid() {
+			elem.Set(existing)
+		}
+		if err := setPath(elem, key, path, i+1, value); err != nil {
+			return err
+		}
+		v.SetMapIndex(k, elem)
+		return nil
+	default:
+		return fmt.Errorf("%s is a %s and has no %q", strings.Join(path[:i], "."), kindName(v.Type()), path[i])
+	}
+}
+
+func parseValue(v reflect.Value, key, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, not %q", key, value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer, not %q", key, value)
+		}
+		v.SetInt(n)
+	default:
+		parsed := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+			return fmt.Errorf("%s must be a JSON %s: %w", key, kindName(v.Type()), err)
+		}
+		v.Set(parsed.Elem())
+	}
+	return nil
+}
+
+// jsonField finds the struct field serialized as name.
+func jsonField(v reflect.Value, name string) (reflect.Value, bool) {
+	f, ok := fieldByJSONName(v.Type(), name)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return v.FieldByIndex(f.Index), true
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" || !f.IsExported() {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func unknownKeyError(key string, parent []string, t reflect.Type) error {
+	names := fieldNames(t)
+	name := key
+	if len(parent) < len(strings.Split(key, ".")) {
+		name = strings.Split(key, ".")[len(parent)]
+	}
+	if s := suggest(name, names); s != "" {
+		return fmt.Errorf("unknown config key %q; did you mean %q?", key, strings.Join(append(parent[:len(parent):len(parent)], s), "."))
+	}
+	where := "the config"
+	if len(parent) > 0 {
+		where = strings.Join(parent, ".")
+	}
+	return fmt.Errorf("unknown config key %q; %s has %s", key, where, strings.Join(names, ", "))
+}
+
+func kindName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Slice:
+		return "list"
+	case reflect.Map, reflect.Struct, reflect.Pointer:
+		return "object"
+	default:
+		return t.Kind().String()
+	}
+}
+
+// Redacted returns a copy of the config with passwords, host and proxy
+// credentials and credential-like headers masked, for display.
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.QbPassword = redact(c.QbPassword)
+	out.QbHost = redactURL(c.QbHost)
+	if c.Servers != nil {
+		out.Servers = make(map[string]Server, len(c.Servers))
+		for name, srv := range c.Servers {
+			out.Servers[name] = srv.Redacted()
+		}
+	}
+	return &out
+}
+
+// Redacted returns a copy of the profile with its secrets masked.
+func (s Server) Redacted() Server {
+	s.Password = redact(s.Password)
+	s.Host = redactURL(s.Host)
+	if s.BasicAuth != nil {
+		basic := *s.BasicAuth
+		basic.Password = redact(basic.Password)
+		s.BasicAuth = &basic
+	}
+	s.Proxy = redactURL(s.Proxy)
+	if s.Headers != nil {
+		headers := make(map[string]string, len(s.Headers))
+		for k, v := range s.Headers {
+			if secretHeader(k) {
+				v = redact(v)
+			}
+			headers[k] = v
+		}
+		s.Headers = headers
+	}
+	return s
+}
+
+// redactURL masks the password in a URL's user:pass@ part, as hosts and
+// proxies may carry one.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redactedValue)
+	}
+	return u.String()
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// secretHeader reports whether a header name suggests it carries credentials,
+// like Authorization, Cookie, X-Api-Key or CF-Access-Client-Secret.
+func secretHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range []string{"auth", "cookie", "token", "key", "secret", "session"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
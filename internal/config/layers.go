@@ -0,0 +1,391 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// ExtraConfigEnv names a config file layered over the user's, for a project
+// or a one-off run.
+const ExtraConfigEnv = "MAGNET2TORRENT_CONFIG"
+
+// envPrefix starts the variables that override single settings.
+const envPrefix = "MAGNET2TORRENT_"
+
+// reservedEnv are MAGNET2TORRENT_ variables that are not settings; serve
+// reads the token itself.
+var reservedEnv = []string{ExtraConfigEnv, "MAGNET2TORRENT_TOKEN"}
+
+// Sources are the layers of the effective config, lowest precedence first.
+// Empty paths and missing files are skipped.
+type Sources struct {
+	// System holds defaults an administrator ships for every user.
+	System string
+	// User is the user's own file, the one config set and edit write.
+	User string
+	// Extra is the file named by MAGNET2TORRENT_CONFIG.
+	Extra string
+	// Environ is the environment as os.Environ returns it; MAGNET2TORRENT_*
+	// variables each override a setting.
+	Environ []string
+	// Flags are settings given on the command line.
+	Flags []Flag
+}
+
+// Flag is a setting given on the command line. Name is the flag as the user
+// typed it, for Settings and error messages.
+type Flag struct {
+	Name  string
+	Key   string
+	Value string
+}
+
+// DefaultSources returns the system file, user, MAGNET2TORRENT_CONFIG and
+// the process environment.
+func DefaultSources(user string) Sources {
+	return Sources{
+		System:  SystemConfigPath(),
+		User:    user,
+		Extra:   os.Getenv(ExtraConfigEnv),
+		Environ: os.Environ(),
+	}
+}
+
+// SystemConfigPath is where an administrator puts defaults for every user:
+// /etc/magnet2torrent/config.json, or under %ProgramData% on Windows. As for
+// the user file, a config.yaml, config.yml or config.toml there is used when
+// config.json does not exist.
+func SystemConfigPath() string {
+	return existingConfigPath(defaultSystemConfigPath(runtime.GOOS, os.Getenv("ProgramData")))
+}
+
+func defaultSystemConfigPath(goos, programData string) string {
+	if goos == "windows" {
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return filepath.Join(programData, "magnet2torrent", "config.json")
+	}
+	return filepath.Join("/etc", "magnet2torrent", "config.json")
+}
+
+// Load builds the effective config: the system file, the user file and the
+// MAGNET2TORRENT_CONFIG file merged in that order as includes are, then
+// environment variables, then flags. found is false when none of the files
+// exist. Problems are located in the file, variable or flag they came from.
+func Load(src Sources) (cfg *Config, found bool, err error) {
+	cfg, found, err = loadFiles(os.ReadFile, src.User, src.System, src.User, src.Extra)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := cfg.applyEnv(src.Environ); err != nil {
+		return nil, false, err
+	}
+	for _, f := range src.Flags {
+		if err := cfg.Override(f.Key, f.Value, f.Name); err != nil {
+			return nil, false, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return cfg, found, nil
+}
+
+// LoadUser loads the user file over the system file only, for changing and
+// saving the user file: SaveConfig then writes back just the settings that
+// differ from the system file, rather than copying it.
+func LoadUser(src Sources) (cfg *Config, found bool, err error) {
+	return loadFiles(os.ReadFile, src.User, src.System, src.User)
+}
+
+// ParseUser is LoadUser with data, such as an edited copy, in place of the
+// user file's contents.
+func ParseUser(src Sources, data []byte) (*Config, error) {
+	read := func(path string) ([]byte, error) {
+		if path == src.User {
+			return data, nil
+		}
+		return os.ReadFile(path) // #nosec G304 - config paths are user-provided.
+	}
+	cfg, _, err := loadFiles(read, src.User, src.System, src.User)
+	return cfg, err
+}
+
+// loadFiles merges the files at paths; user is the one to report
+// migrations for and to save to.
+func loadFiles(read func(string) ([]byte, error), user string, paths ...string) (*Config, bool, error) {
+	merged := &document{values: map[string]any{}, locations: map[string]location{}}
+	var (
+		found    bool
+		base     map[string]any
+		userFrom = CurrentVersion
+	)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if path == user {
+			base = userBase(merged.values)
+		}
+		data, err := read(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("read config %s: %w", path, err)
+		}
+		doc, from, err := parseDocument(path, data)
+		if err != nil {
+			return nil, false, fmt.Errorf("parse config %s: %w", path, err)
+		}
+		found = true
+		if path == user {
+			userFrom = from
+			if doc.base != nil {
+				if base == nil {
+					base = map[string]any{}
+				}
+				mergeValues(base, doc.base)
+			}
+		} else {
+			doc.dropFileKeys()
+		}
+		merged.merge(doc)
+	}
+
+	// Errors name their file, including the user's, until decoding is done.
+	info := &parseInfo{
+		locations:   merged.locations,
+		base:        base,
+		migrated:    userFrom != CurrentVersion,
+		fromVersion: userFrom,
+		files:       merged.files,
+	}
+	cfg, err := info.decode(merged.values)
+	if err != nil {
+		return nil, false, fmt.Errorf("parse config: %w", err)
+	}
+	info.path = user
+	return cfg, found, nil
+}
+
+// Files lists the files the config was read from, included files too, in
+// the order they were merged.
+func (c *Config) Files() []string {
+	if c.parsed == nil {
+		return nil
+	}
+	return append([]string(nil), c.parsed.files...)
+}
+
+// userBase is what the user file is saved against: the lower layers over
+// the defaults. Settings the user file does not change are left out when it
+// is saved, so an administrator's later changes still reach it.
+func userBase(lower map[string]any) map[string]any {
+	if len(lower) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(DefaultConfig())
+	if err != nil {
+		return nil
+	}
+	var defaults map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&defaults); err != nil {
+		return nil
+	}
+	for _, key := range fileKeys {
+		delete(defaults, key)
+	}
+	return mergeValues(defaults, cloneValue(lower).(map[string]any))
+}
+
+// applyEnv applies MAGNET2TORRENT_* variables. Names are the setting in
+// upper case with words split by _, and __ between levels:
+// MAGNET2TORRENT_QB_HOST sets qbHost and
+// MAGNET2TORRENT_SERVERS__NAS__PASSWORD sets servers.nas.password.
+func (c *Config) applyEnv(environ []string) error {
+	vars := map[string]string{}
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if ok && strings.HasPrefix(name, envPrefix) && !oneOf(name, reservedEnv) {
+			vars[name] = value
+		}
+	}
+	for _, name := range sortedKeys(vars) {
+		key, ok := c.envKey(strings.TrimPrefix(name, envPrefix))
+		if !ok {
+			if c.parsed != nil {
+				c.parsed.unknown = append(c.parsed.unknown, Problem{File: name, Message: "not a config setting, ignored", Warning: true})
+			}
+			continue
+		}
+		if err := c.Override(key, vars[name], name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// envKey maps a variable name, less its prefix, to a setting key. Profile
+// names match existing ones regardless of case, and are otherwise taken in
+// lower case.
+func (c *Config) envKey(name string) (string, bool) {
+	v := reflect.ValueOf(c).Elem()
+	var path []string
+	for i, seg := range strings.Split(name, "__") {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v = reflect.New(v.Type().Elem())
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			var field reflect.StructField
+			found := false
+			for j := 0; j < v.NumField(); j++ {
+				f := v.Type().Field(j)
+				if n := jsonName(f); n != "" && envName(n) == envName(seg) {
+					field, found = f, true
+					break
+				}
+			}
+			if !found || (i == 0 && oneOf(jsonName(field), fileKeys)) {
+				return "", false
+			}
+			path = append(path, jsonName(field))
+			v = v.FieldByIndex(field.Index)
+		case reflect.Map:
+			key := strings.ToLower(seg)
+			for _, k := range v.MapKeys() {
+				if envName(k.String()) == envName(seg) {
+					key = k.String()
+					break
+				}
+			}
+			path = append(path, key)
+			elem := v.MapIndex(reflect.ValueOf(key))
+			if !elem.IsValid() {
+				elem = reflect.New(v.Type().Elem()).Elem()
+			}
+			v = elem
+		default:
+			return "", false
+		}
+	}
+	return strings.Join(path, "."), true
+}
+
+func envName(s string) string {
+	return strings.ToUpper(strings.NewReplacer("_", "", "-", "").Replace(s))
+}
+
+// Override sets key as Set does, but without validating it, and records
+// source, an environment variable or flag, as where the value came from.
+func (c *Config) Override(key, value, source string) error {
+	if err := setPath(reflect.ValueOf(c).Elem(), key, strings.Split(key, "."), 0, value); err != nil {
+		return err
+	}
+	if c.parsed == nil {
+		c.parsed = &parseInfo{locations: map[string]location{}, present: map[string]bool{}}
+	}
+	info := c.parsed
+	forget(info.locations, key)
+	info.locations[key] = location{source: source}
+	info.present[key] = true
+	if v, err := c.Get(key); err == nil {
+		if data, err := json.Marshal(v); err == nil {
+			var tree any
+			if json.Unmarshal(data, &tree) == nil {
+				markPresent(info.present, tree, key)
+			}
+		}
+	}
+	return nil
+}
+
+func markPresent(present map[string]bool, v any, path string) {
+	present[path] = true
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			markPresent(present, item, joinKey(path, k))
+		}
+	case []any:
+		for i, item := range v {
+			markPresent(present, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// Setting is one effective value and where it came from.
+type Setting struct {
+	Key   string
+	Value any
+	// Origin is "file:line", an environment variable or flag, or
+	// "default".
+	Origin string
+}
+
+// Settings lists the config's values, one per setting and profile field, in
+// file order, each with its origin.
+func (c *Config) Settings() ([]Setting, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	tree, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings []Setting
+	var flatten func(v any, key string)
+	flatten = func(v any, key string) {
+		switch v := v.(type) {
+		case *object:
+			if len(v.keys) > 0 {
+				for _, k := range v.keys {
+					flatten(v.values[k], joinKey(key, k))
+				}
+				return
+			}
+		case []any:
+			if isTableList(v) {
+				for i, item := range v {
+					flatten(item, fmt.Sprintf("%s[%d]", key, i))
+				}
+				return
+			}
+		}
+		settings = append(settings, Setting{Key: key, Value: v, Origin: c.origin(key)})
+	}
+	flatten(tree, "")
+	return settings, nil
+}
+
+func (c *Config) origin(key string) string {
+	info := c.parsed
+	if info == nil || !info.present[key] {
+		return "default"
+	}
+	loc, ok := info.lookup(key)
+	switch {
+	case !ok:
+		return "default"
+	case loc.source != "":
+		return loc.source
+	case loc.file == "":
+		return fmt.Sprintf("line %d", loc.line)
+	}
+	return fmt.Sprintf("%s:%d", loc.file, loc.line)
+}
@@ -0,0 +1,25 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// lockFile creates path exclusively and removes it on unlock. Unlike the
+// flock and Windows versions, a file left by a crashed process has to be
+// removed by hand.
+func lockFile(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600) // #nosec G304 - next to the config path.
+	if errors.Is(err, fs.ErrExist) {
+		return nil, errLockHeld
+	}
+	if err != nil {
+		return nil, err
+	}
+	writeLockOwner(f)
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+)
+
+// CurrentVersion is the configVersion this release reads natively and writes.
+// Files without configVersion are version 0, as written by 0.1.0.
+const CurrentVersion = 1
+
+// migrations[i] upgrades a version i document to version i+1. Steps work on
+// the decoded file, includes merged in, rather than Config, so they can
+// rename or restructure keys the current struct no longer has. Never edit a
+// released step; add a new one and bump CurrentVersion.
+var migrations = []func(doc map[string]any) error{
+	migrateV0,
+}
+
+// migrateV0 upgrades 0.1.0 files. Their first-run prompt stored qbHost as
+// typed, so "localhost:8080" without a scheme was accepted and then failed
+// on every request; it is now rejected by Validate, so add the http:// the
+// user meant.
+func migrateV0(doc map[string]any) error {
+	host, ok := doc["qbHost"].(string)
+	if !ok || host == "" || strings.Contains(host, "://") {
+		return nil
+	}
+	if u, err := url.Parse("http://" + host); err == nil && u.Host != "" {
+		doc["qbHost"] = "http://" + host
+	}
+	return nil
+}
+
+// migrate upgrades a decoded document to CurrentVersion in place and returns
+// the version it had, which is CurrentVersion when no step applied.
+func migrate(doc map[string]any) (from int, err error) {
+	if raw, ok := doc["configVersion"]; ok {
+		v, ok := wholeNumber(raw)
+		if !ok || v < 0 {
+			return 0, fmt.Errorf("configVersion must be a non-negative integer, not %v", raw)
+		}
+		from = int(v)
+	}
+	switch {
+	case from > CurrentVersion:
+		return from, fmt.Errorf("configVersion %d is newer than this magnet2torrent supports (%d); upgrade magnet2torrent", from, CurrentVersion)
+	case from == CurrentVersion:
+		return from, nil
+	}
+
+	for v := from; v < CurrentVersion; v++ {
+		if err := migrations[v](doc); err != nil {
+			return from, fmt.Errorf("migrate config from version %d: %w", v, err)
+		}
+	}
+	doc["configVersion"] = int64(CurrentVersion)
+	return from, nil
+}
+
+// wholeNumber accepts an integer as any of the decoders produce it.
+func wholeNumber(v any) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), n == math.Trunc(n)
+	}
+	return 0, false
+}
+
+// MigratedFrom returns the configVersion the file had when Parse upgraded it,
+// or CurrentVersion when it needed no migration.
+func (c *Config) MigratedFrom() int {
+	if c.parsed == nil || !c.parsed.migrated {
+		return CurrentVersion
+	}
+	return c.parsed.fromVersion
+}
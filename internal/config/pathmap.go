@@ -0,0 +1,51 @@
+package config
+
+import "strings"
+
+// PathMap translates save paths seen on server From into the paths under
+// which server To sees the same data, e.g. {"/data": "/mnt/seedbox/data"}.
+type PathMap struct {
+	From  string            `json:"from"`
+	To    string            `json:"to"`
+	Paths map[string]string `json:"paths"`
+}
+
+// PathMapping merges the path tables configured for moving from one server to
+// another.
+func (c *Config) PathMapping(from, to string) map[string]string {
+	paths := map[string]string{}
+	for _, m := range c.PathMaps {
+		if m.From != from || m.To != to {
+			continue
+		}
+		for k, v := range m.Paths {
+			paths[k] = v
+		}
+	}
+	return paths
+}
+
+// TranslatePath rewrites p using the longest prefix in paths that matches on a
+// path boundary. ok is false when no prefix matched and p is returned as is.
+func TranslatePath(paths map[string]string, p string) (string, bool) {
+	var from, to string
+	matched := false
+	for prefix, target := range paths {
+		prefix = strings.TrimRight(prefix, `/\`)
+		if !hasPathPrefix(p, prefix) || (matched && len(prefix) <= len(from)) {
+			continue
+		}
+		from, to, matched = prefix, target, true
+	}
+	if !matched {
+		return p, false
+	}
+	return strings.TrimRight(to, `/\`) + p[len(from):], true
+}
+
+func hasPathPrefix(p, prefix string) bool {
+	if !strings.HasPrefix(p, prefix) {
+		return false
+	}
+	return len(p) == len(prefix) || p[len(prefix)] == '/' || p[len(prefix)] == '\\'
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultServerName is the profile built from the top-level qb* settings.
+const DefaultServerName = "default"
+
+// Auth modes for a server profile.
+const (
+	AuthPassword = "password"
+	AuthNone     = "none"
+)
+
+// Server describes how to reach a single qBittorrent WebUI.
+type Server struct {
+	Name     string `json:"-"`
+	Host     string `json:"host"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Auth is "password" (default) or "none" when qBittorrent bypasses
+	// authentication for this machine.
+	Auth      string            `json:"auth,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	BasicAuth *BasicAuth        `json:"basicAuth,omitempty"`
+	// Proxy is an http://, https://, socks5:// or socks5h:// URL, optionally
+	// with user:pass credentials.
+	Proxy string `json:"proxy,omitempty"`
+}
+
+// BasicAuth holds HTTP basic auth credentials for a reverse proxy in front of
+// qBittorrent. They are independent from the qBittorrent WebUI login.
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Server resolves a server profile by name. An empty name selects
+// DefaultServer, falling back to the profile built from qbHost, qbUsername
+// and qbPassword.
+func (c *Config) Server(name string) (Server, error) {
+	if name == "" {
+		name = c.DefaultServer
+	}
+	if name == "" {
+		name = DefaultServerName
+	}
+
+	srv, ok := c.Servers[name]
+	if !ok && name != DefaultServerName {
+		return Server{}, fmt.Errorf("unknown server %q; known servers: %v", name, c.ServerNames())
+	}
+	srv.Name = name
+
+	if name == DefaultServerName {
+		if srv.Host == "" {
+			srv.Host = c.QbHost
+		}
+		if srv.Username == "" {
+			srv.Username = c.QbUsername
+		}
+		if srv.Password == "" {
+			srv.Password = c.QbPassword
+		}
+		if srv.Auth == "" {
+			srv.Auth = c.QbAuth
+		}
+	}
+	return srv, nil
+}
+
+// SetServer stores a server profile. The default profile is written back to the
+// top-level qb* settings unless it is declared under servers.
+func (c *Config) SetServer(srv Server) {
+	if srv.Name == "" {
+		srv.Name = DefaultServerName
+	}
+	if _, declared := c.Servers[srv.Name]; srv.Name == DefaultServerName && !declared {
+		c.QbHost = srv.Host
+		c.QbUsername = srv.Username
+		c.QbPassword = srv.Password
+		c.QbAuth = srv.Auth
+		if len(srv.Headers) == 0 && srv.BasicAuth == nil && srv.Proxy == "" {
+			return
+		}
+		srv.Host, srv.Username, srv.Password, srv.Auth = "", "", "", ""
+	}
+	if c.Servers == nil {
+		c.Servers = map[string]Server{}
+	}
+	c.Servers[srv.Name] = srv
+}
+
+// ServerNames lists all configured profiles, including the implicit default.
+func (c *Config) ServerNames() []string {
+	names := []string{}
+	if _, ok := c.Servers[DefaultServerName]; !ok && c.QbHost != "" {
+		names = append(names, DefaultServerName)
+	}
+	for name := range c.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NoAuth reports whether the profile skips the qBittorrent login.
+func (s Server) NoAuth() bool {
+	return s.Auth == AuthNone
+}
+
+// SettingName returns the config key a user edits to change field for this
+// profile, for use in error messages.
+func (s Server) SettingName(field string) string {
+	name := s.Name
+	if name == "" {
+		name = DefaultServerName
+	}
+	if name == DefaultServerName {
+		switch field {
+		case "host", "username", "password", "auth":
+			return "qb" + strings.ToUpper(field[:1]) + field[1:]
+		}
+	}
+	return "servers." + name + "." + field
+}
@@ -0,0 +1,627 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The TOML support covers TOML 1.0 apart from dates and times, which no
+// setting uses, and the special floats inf and nan, which JSON cannot hold.
+
+type tomlParser struct {
+	data      string
+	pos       int
+	line, col int
+	locations map[string]location
+
+	root map[string]any
+	// current is the table the latest header opened; path is its key.
+	current map[string]any
+	path    string
+	// comments records whether the file has any.
+	comments bool
+	// defined tracks tables opened by a header, to catch duplicates.
+	defined map[string]bool
+}
+
+func decodeTOML(data []byte, locations map[string]location) (map[string]any, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("config is not valid UTF-8")
+	}
+	p := newTOMLParser(data, locations)
+	if err := p.document(); err != nil {
+		return nil, fmt.Errorf("line %d, column %d: %w", p.line, p.col, err)
+	}
+	return p.root, nil
+}
+
+func newTOMLParser(data []byte, locations map[string]location) *tomlParser {
+	root := map[string]any{}
+	return &tomlParser{
+		data:      strings.TrimPrefix(string(data), "\ufeff"),
+		line:      1,
+		col:       1,
+		locations: locations,
+		root:      root,
+		current:   root,
+		defined:   map[string]bool{},
+	}
+}
+
+// tomlHasComments reports whether data has a comment. A file that does not
+// parse counts as having one, so it is never rewritten blindly.
+func tomlHasComments(data []byte) bool {
+	p := newTOMLParser(data, map[string]location{})
+	err := p.document()
+	return p.comments || err != nil
+}
+
+func (p *tomlParser) peek() byte {
+	if p.pos >= len(p.data) {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+func (p *tomlParser) advance(n int) {
+	for i := 0; i < n && p.pos < len(p.data); i++ {
+		if p.data[p.pos] == '\n' {
+			p.line++
+			p.col = 1
+		} else {
+			p.col++
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(p.data[p.pos:], s)
+}
+
+// skipSpace skips spaces and tabs, and with newlines also line breaks and
+// comments.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for p.pos < len(p.data) {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t':
+			p.advance(1)
+		case newlines && (c == '\n' || c == '\r'):
+			p.advance(1)
+		case newlines && c == '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	p.comments = true
+	for p.pos < len(p.data) && p.peek() != '\n' {
+		p.advance(1)
+	}
+}
+
+// endOfLine consumes the rest of a line, which may only hold a comment.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace(false)
+	if p.peek() == '#' {
+		p.skipComment()
+	}
+	switch {
+	case p.pos >= len(p.data):
+		return nil
+	case p.hasPrefix("\n"), p.hasPrefix("\r\n"):
+		p.advance(1)
+		return nil
+	}
+	return fmt.Errorf("expected the end of the line, found %q", p.peek())
+}
+
+func (p *tomlParser) document() error {
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.data) {
+			return nil
+		}
+		var err error
+		if p.peek() == '[' {
+			err = p.header()
+		} else {
+			err = p.keyValue(p.current, p.path)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// header parses [table] and [[array of tables]].
+func (p *tomlParser) header() error {
+	line, col := p.line, p.col
+	array := p.hasPrefix("[[")
+	if array {
+		p.advance(2)
+	} else {
+		p.advance(1)
+	}
+	p.skipSpace(false)
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace(false)
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !p.hasPrefix(closing) {
+		return fmt.Errorf("expected %q after the table name", closing)
+	}
+	p.advance(len(closing))
+
+	parent, path := p.root, ""
+	for _, k := range keys[:len(keys)-1] {
+		if parent, path, err = p.descend(parent, path, k); err != nil {
+			return err
+		}
+	}
+	last := keys[len(keys)-1]
+	path = joinKey(path, last)
+
+	if array {
+		list, ok := parent[last].([]any)
+		if _, exists := parent[last]; exists && !ok {
+			return fmt.Errorf("%s is already defined", path)
+		}
+		table := map[string]any{}
+		parent[last] = append(list, table)
+		path = fmt.Sprintf("%s[%d]", path, len(list))
+		p.current, p.path = table, path
+	} else {
+		if p.defined[path] {
+			return fmt.Errorf("table %s is defined twice", path)
+		}
+		table, err := p.table(parent, path, last)
+		if err != nil {
+			return err
+		}
+		p.current, p.path = table, path
+	}
+	p.defined[path] = true
+	p.locations[path] = location{line: line, col: col}
+	return nil
+}
+
+// descend steps from parent into its table k, creating it when missing; for
+// an array of tables it steps into the latest element.
+func (p *tomlParser) descend(parent map[string]any, path, k string) (map[string]any, string, error) {
+	path = joinKey(path, k)
+	if list, ok := parent[k].([]any); ok && len(list) > 0 {
+		if table, ok := list[len(list)-1].(map[string]any); ok {
+			return table, fmt.Sprintf("%s[%d]", path, len(list)-1), nil
+		}
+	}
+	table, err := p.table(parent, path, k)
+	return table, path, err
+}
+
+func (p *tomlParser) table(parent map[string]any, path, k string) (map[string]any, error) {
+	switch v := parent[k].(type) {
+	case nil:
+		table := map[string]any{}
+		parent[k] = table
+		return table, nil
+	case map[string]any:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("%s is already set to a value", path)
+	}
+}
+
+// keyValue parses key = value into table, whose own path is path.
+func (p *tomlParser) keyValue(table map[string]any, path string) error {
+	line, col := p.line, p.col
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace(false)
+	if p.peek() != '=' {
+		return fmt.Errorf("expected '=' after the key")
+	}
+	p.advance(1)
+	p.skipSpace(false)
+
+	for _, k := range keys[:len(keys)-1] {
+		if table, path, err = p.descend(table, path, k); err != nil {
+			return err
+		}
+	}
+	last := keys[len(keys)-1]
+	path = joinKey(path, last)
+	if _, exists := table[last]; exists {
+		return fmt.Errorf("%s is defined twice", path)
+	}
+	p.locations[path] = location{line: line, col: col}
+	v, err := p.value(path)
+	if err != nil {
+		return err
+	}
+	table[last] = v
+	return nil
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+
+// key parses a possibly dotted key.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		switch p.peek() {
+		case '"', '\'':
+			if p.hasPrefix(`"""`) || p.hasPrefix(`'''`) {
+				return nil, fmt.Errorf("keys cannot be multi-line strings")
+			}
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, s)
+		default:
+			bare := tomlBareKey.FindString(p.data[p.pos:])
+			if bare == "" {
+				return nil, fmt.Errorf("expected a key, found %q", p.peek())
+			}
+			p.advance(len(bare))
+			keys = append(keys, bare)
+		}
+		p.skipSpace(false)
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.advance(1)
+	}
+}
+
+func (p *tomlParser) value(path string) (any, error) {
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		return p.array(path)
+	case c == '{':
+		return p.inlineTable(path)
+	case p.hasPrefix("true") && !isTOMLWordByte(p.at(4)):
+		p.advance(4)
+		return true, nil
+	case p.hasPrefix("false") && !isTOMLWordByte(p.at(5)):
+		p.advance(5)
+		return false, nil
+	case c == 0 || c == '\n' || c == '\r' || c == '#':
+		return nil, fmt.Errorf("missing value")
+	}
+	return p.number()
+}
+
+func (p *tomlParser) at(offset int) byte {
+	if p.pos+offset >= len(p.data) {
+		return 0
+	}
+	return p.data[p.pos+offset]
+}
+
+func isTOMLWordByte(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c == ':' || c == '+' ||
+		('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+var (
+	tomlDate  = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}|^\d{2}:\d{2}`)
+	tomlInt   = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)$|^0x[0-9A-Fa-f](_?[0-9A-Fa-f])*$|^0o[0-7](_?[0-7])*$|^0b[01](_?[01])*$`)
+	tomlFloat = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][-+]?[0-9](_?[0-9])*)?$`)
+)
+
+func (p *tomlParser) number() (any, error) {
+	if tomlDate.MatchString(p.data[p.pos:]) {
+		return nil, fmt.Errorf("dates and times are not supported; quote the value")
+	}
+	end := p.pos
+	for end < len(p.data) && isTOMLWordByte(p.data[end]) {
+		end++
+	}
+	tok := p.data[p.pos:end]
+	switch {
+	case tomlInt.MatchString(tok):
+		n, err := strconv.ParseInt(tok, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("integer %s is out of range", tok)
+		}
+		p.advance(len(tok))
+		return n, nil
+	case tomlFloat.MatchString(tok):
+		f, err := strconv.ParseFloat(strings.ReplaceAll(tok, "_", ""), 64)
+		if err != nil {
+			return nil, fmt.Errorf("float %s is out of range", tok)
+		}
+		p.advance(len(tok))
+		return f, nil
+	case strings.TrimLeft(tok, "+-") == "inf" || strings.TrimLeft(tok, "+-") == "nan":
+		return nil, fmt.Errorf("%s is not supported", tok)
+	case tok == "":
+		return nil, fmt.Errorf("unexpected %q", p.peek())
+	}
+	return nil, fmt.Errorf("invalid value %q; quote strings", tok)
+}
+
+func (p *tomlParser) array(path string) ([]any, error) {
+	p.advance(1)
+	list := []any{}
+	for {
+		p.skipSpace(true)
+		if p.peek() == ']' {
+			p.advance(1)
+			return list, nil
+		}
+		child := fmt.Sprintf("%s[%d]", path, len(list))
+		p.locations[child] = location{line: p.line, col: p.col}
+		v, err := p.value(child)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		p.skipSpace(true)
+		switch p.peek() {
+		case ',':
+			p.advance(1)
+		case ']':
+		default:
+			return nil, fmt.Errorf("expected ',' or ']' in the array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable(path string) (map[string]any, error) {
+	p.advance(1)
+	table := map[string]any{}
+	p.skipSpace(false)
+	if p.peek() == '}' {
+		p.advance(1)
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table, path); err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		switch p.peek() {
+		case ',':
+			p.advance(1)
+			p.skipSpace(false)
+		case '}':
+			p.advance(1)
+			return table, nil
+		default:
+			return nil, fmt.Errorf("expected ',' or '}' in the inline table; inline tables must fit on one line")
+		}
+	}
+}
+
+// str parses any of the four string forms.
+func (p *tomlParser) str() (string, error) {
+	quote := p.peek()
+	multi := p.hasPrefix(strings.Repeat(string(quote), 3))
+	delim := string(quote)
+	if multi {
+		delim = strings.Repeat(delim, 3)
+	}
+	p.advance(len(delim))
+	if multi {
+		// A newline right after the opening delimiter is trimmed.
+		if p.hasPrefix("\r\n") {
+			p.advance(2)
+		} else if p.hasPrefix("\n") {
+			p.advance(1)
+		}
+	}
+
+	var buf strings.Builder
+	for {
+		if p.pos >= len(p.data) {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.peek()
+		switch {
+		case p.hasPrefix(delim):
+			n := len(delim)
+			if multi {
+				// Up to two quotes may end a multi-line string's content.
+				for p.at(n) == quote {
+					n++
+				}
+				if n > 5 {
+					return "", fmt.Errorf("too many quotes closing the string")
+				}
+				buf.WriteString(strings.Repeat(string(quote), n-3))
+			}
+			p.advance(n)
+			return buf.String(), nil
+		case c == '\n' && !multi:
+			return "", fmt.Errorf("newline in a single-line string")
+		case c == '\\' && quote == '"':
+			if err := p.escape(&buf, multi); err != nil {
+				return "", err
+			}
+		case c < ' ' && c != '\t' && c != '\n' && c != '\r':
+			return "", fmt.Errorf("control character in a string")
+		default:
+			buf.WriteByte(c)
+			p.advance(1)
+		}
+	}
+}
+
+func (p *tomlParser) escape(buf *strings.Builder, multi bool) error {
+	p.advance(1)
+	c := p.peek()
+	simple := map[byte]string{'b': "\b", 't': "\t", 'n': "\n", 'f': "\f", 'r': "\r", '"': `"`, '\\': `\`}
+	if s, ok := simple[c]; ok {
+		buf.WriteString(s)
+		p.advance(1)
+		return nil
+	}
+	if multi && (c == ' ' || c == '\t' || c == '\n' || c == '\r') {
+		// A line-ending backslash trims the break and following whitespace.
+		rest := strings.TrimLeft(p.data[p.pos:], " \t")
+		if !strings.HasPrefix(rest, "\n") && !strings.HasPrefix(rest, "\r\n") {
+			return fmt.Errorf("invalid escape %q", c)
+		}
+		for strings.IndexByte(" \t\r\n", p.peek()) >= 0 && p.pos < len(p.data) {
+			p.advance(1)
+		}
+		return nil
+	}
+	if c == 'u' || c == 'U' {
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		hex := p.data[p.pos+1 : min(p.pos+1+n, len(p.data))]
+		r, err := strconv.ParseUint(hex, 16, 32)
+		if len(hex) != n || err != nil || !utf8.ValidRune(rune(r)) {
+			return fmt.Errorf("invalid unicode escape \\%c%s", c, hex)
+		}
+		buf.WriteRune(rune(r))
+		p.advance(1 + n)
+		return nil
+	}
+	return fmt.Errorf("invalid escape \\%c", c)
+}
+
+// encodeTOML writes an ordered document as TOML: top-level values first,
+// then one [table] per object and [[table]] per list of objects.
+func encodeTOML(obj *object) []byte {
+	var buf bytes.Buffer
+	writeTOMLTable(&buf, obj, "", false)
+	return bytes.TrimLeft(buf.Bytes(), "\n")
+}
+
+func writeTOMLTable(buf *bytes.Buffer, obj *object, path string, arrayElem bool) {
+	var tables, arrays []string
+	var values bytes.Buffer
+	for _, k := range obj.keys {
+		switch v := obj.values[k].(type) {
+		case nil:
+			// TOML has no null; leaving the key out reads back the same.
+		case *object:
+			if len(v.keys) == 0 {
+				fmt.Fprintf(&values, "%s = {}\n", tomlKey(k))
+			} else {
+				tables = append(tables, k)
+			}
+		case []any:
+			if isTableList(v) {
+				arrays = append(arrays, k)
+			} else {
+				fmt.Fprintf(&values, "%s = %s\n", tomlKey(k), tomlValue(v))
+			}
+		default:
+			fmt.Fprintf(&values, "%s = %s\n", tomlKey(k), tomlValue(v))
+		}
+	}
+
+	switch {
+	case arrayElem:
+		fmt.Fprintf(buf, "\n[[%s]]\n", path)
+	case path != "" && (values.Len() > 0 || len(tables)+len(arrays) == 0):
+		fmt.Fprintf(buf, "\n[%s]\n", path)
+	}
+	buf.Write(values.Bytes())
+	for _, k := range tables {
+		writeTOMLTable(buf, obj.values[k].(*object), tomlPath(path, k), false)
+	}
+	for _, k := range arrays {
+		for _, item := range obj.values[k].([]any) {
+			writeTOMLTable(buf, item.(*object), tomlPath(path, k), true)
+		}
+	}
+}
+
+func isTableList(list []any) bool {
+	if len(list) == 0 {
+		return false
+	}
+	for _, item := range list {
+		if _, ok := item.(*object); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func tomlPath(path, key string) string {
+	if path == "" {
+		return tomlKey(key)
+	}
+	return path + "." + tomlKey(key)
+}
+
+var tomlBareKeyOnly = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(k string) string {
+	if tomlBareKeyOnly.MatchString(k) {
+		return k
+	}
+	return tomlString(k)
+}
+
+// tomlString quotes s as JSON, whose escapes are all valid in TOML basic
+// strings.
+func tomlString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// tomlValue writes a value inline.
+func tomlValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return tomlString(v)
+	case *object:
+		parts := make([]string, 0, len(v.keys))
+		for _, k := range v.keys {
+			if v.values[k] != nil {
+				parts = append(parts, tomlKey(k)+" = "+tomlValue(v.values[k]))
+			}
+		}
+		if len(parts) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(parts, ", ") + " }"
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, tomlValue(item))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case nil:
+		// Only reachable inside a list, which TOML cannot express.
+		return `""`
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
@@ -0,0 +1,465 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Schema is the JSON Schema of the config file, for editors.
+//
+//go:embed config.schema.json
+var Schema []byte
+
+// LogLevels are the accepted logLevel values.
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// Problem is one finding of config validation. Key is the dotted setting it
+// concerns; Line and Column locate it in the file when known. File names where
+// it came from when that is not the config file itself: an included or
+// system file, or an environment variable or flag.
+type Problem struct {
+	Key     string
+	File    string
+	Line    int
+	Column  int
+	Message string
+	// Warning problems do not stop the config from being used.
+	Warning bool
+}
+
+func (p Problem) String() string {
+	msg := p.Message
+	if p.Key != "" {
+		msg = p.Key + ": " + msg
+	}
+	if p.Line > 0 {
+		msg = fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, msg)
+	}
+	if p.File != "" {
+		msg = p.File + ": " + msg
+	}
+	return msg
+}
+
+// ValidationError lists the problems that make a config unusable.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return strings.Join(lines, "; ")
+}
+
+// parseInfo is what Parse learned about the file beyond the values.
+type parseInfo struct {
+	// path is the parsed file; keys from its includes carry their own.
+	path      string
+	locations map[string]location
+	// present holds every key the files, variables and flags set, as
+	// opposed to defaults.
+	present map[string]bool
+	unknown []Problem
+	// base holds the values the includes provide, so saving can leave
+	// them out.
+	base map[string]any
+	// migrated is set when the file had an older configVersion.
+	migrated    bool
+	fromVersion int
+	// files lists every file read, includes and other layers too.
+	files []string
+}
+
+// Parse decodes config JSON over the defaults, resolving includes against
+// the working directory. See ParseFile.
+func Parse(data []byte) (*Config, error) {
+	return ParseFile("", data)
+}
+
+// ParseFile decodes the config file at path, whose format follows its
+// extension, over the defaults. Files listed in include are merged in first,
+// so the file's own settings win. Syntax and type errors name the line and
+// column; unknown keys are recorded for Validate.
+func ParseFile(path string, data []byte) (*Config, error) {
+	doc, from, err := parseDocument(path, data)
+	if err != nil {
+		return nil, err
+	}
+	info := &parseInfo{
+		path:        path,
+		locations:   doc.locations,
+		base:        doc.base,
+		migrated:    from != CurrentVersion,
+		fromVersion: from,
+		files:       doc.files,
+	}
+	return info.decode(doc.values)
+}
+
+// parseDocument decodes a config file with its includes and upgrades it to
+// CurrentVersion, returning the version it had.
+func parseDocument(path string, data []byte) (*document, int, error) {
+	doc, err := decodeDocument(path, data, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	from, err := migrate(doc.values)
+	if err != nil {
+		return nil, 0, err
+	}
+	return doc, from, nil
+}
+
+// decode turns a document's values into a Config over the defaults.
+func (info *parseInfo) decode(values map[string]any) (*Config, error) {
+	info.present = map[string]bool{}
+	// Unknown keys are dropped so encoding/json, which matches field names
+	// case-insensitively, cannot take "qbhost" for qbHost.
+	info.walk(values, reflect.TypeOf(Config{}), "")
+
+	tree, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	cfg := DefaultConfig()
+	if err := json.Unmarshal(tree, cfg); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, info.errorAt(typeErr.Field, fmt.Errorf("%s must be %s, not %s", typeErr.Field, typeName(typeErr.Type), typeErr.Value))
+		}
+		return nil, err
+	}
+	cfg.parsed = info
+	return cfg, nil
+}
+
+// walk records which keys of a decoded document match no setting, and
+// removes them, and which are present.
+func (info *parseInfo) walk(v any, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if path != "" {
+		info.present[path] = true
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		if t.Kind() != reflect.Struct && t.Kind() != reflect.Map {
+			return
+		}
+		for _, key := range sortedKeys(v) {
+			child := joinKey(path, key)
+			var childType reflect.Type
+			if t.Kind() == reflect.Map {
+				childType = t.Elem()
+			} else if f, ok := fieldByJSONName(t, key); ok {
+				childType = f.Type
+			} else {
+				info.unknown = append(info.unknown, unknownKeyProblem(child, key, t))
+				delete(v, key)
+				continue
+			}
+			info.walk(v[key], childType, child)
+		}
+	case []any:
+		if t.Kind() != reflect.Slice {
+			return
+		}
+		for i, item := range v {
+			info.walk(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// lookup finds where key, or the closest enclosing key, was written.
+func (info *parseInfo) lookup(key string) (location, bool) {
+	for key != "" {
+		if loc, ok := info.locations[key]; ok {
+			return loc, true
+		}
+		cut := strings.LastIndexAny(key, ".[")
+		if cut < 0 {
+			break
+		}
+		key = key[:cut]
+	}
+	return location{}, false
+}
+
+// errorAt prefixes err with the position of key.
+func (info *parseInfo) errorAt(key string, err error) error {
+	loc, ok := info.lookup(key)
+	if !ok {
+		return err
+	}
+	err = at(loc, err)
+	if where := loc.where(info.path); where != "" {
+		err = fmt.Errorf("%s: %w", where, err)
+	}
+	return err
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func fieldByJSONName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); jsonName(f) == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func unknownKeyProblem(key, name string, t reflect.Type) Problem {
+	msg := "unknown key, ignored"
+	if s := suggest(name, fieldNames(t)); s != "" {
+		msg += fmt.Sprintf("; did you mean %q?", s)
+	}
+	return Problem{Key: key, Message: msg, Warning: true}
+}
+
+func fieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if name := jsonName(t.Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// suggest returns the candidate closest to name, if any is close enough to
+// be a likely typo.
+func suggest(name string, candidates []string) string {
+	best, bestDist := "", 0
+	lower := strings.ToLower(name)
+	for _, c := range candidates {
+		d := editDistance(lower, strings.ToLower(c))
+		if best == "" || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	if best == "" || bestDist > max(2, len(name)/3) {
+		return ""
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.Slice:
+		return "a list"
+	default:
+		return "an object"
+	}
+}
+
+// Validate checks the settings. Unknown keys found by Parse come back as
+// warnings; invalid values make up the error, a *ValidationError. Settings
+// that are merely empty are left to the first-run prompt.
+func (c *Config) Validate() (warnings []Problem, err error) {
+	var problems []Problem
+	add := func(key, format string, args ...any) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.LogLevel != "" && !oneOf(strings.ToLower(c.LogLevel), append(LogLevels, "warning")) {
+		add("logLevel", "%q is not a log level; use %s", c.LogLevel, strings.Join(LogLevels, ", "))
+	}
+	switch c.DuplicatePolicy {
+	case "", DuplicateSkip, DuplicateMerge, DuplicateForce:
+	default:
+		add("duplicatePolicy", "%q is not a policy; use %s, %s or %s", c.DuplicatePolicy, DuplicateSkip, DuplicateMerge, DuplicateForce)
+	}
+	switch c.FilePermissions {
+	case "", PermissionsWarn, PermissionsRefuse, PermissionsIgnore:
+	default:
+		add("filePermissions", "%q is not a policy; use %s, %s or %s", c.FilePermissions, PermissionsWarn, PermissionsRefuse, PermissionsIgnore)
+	}
+	for key, path := range map[string]string{"saveDir": c.SaveDir, "logFile": c.LogFile, "historyFile": c.HistoryFile} {
+		if msg := checkPath(path); msg != "" {
+			add(key, "%s", msg)
+		}
+	}
+
+	checkServer := func(prefix, hostKey, authKey string, srv Server) {
+		if msg := checkHost(srv.Host); msg != "" {
+			add(prefix+hostKey, "%s", msg)
+		}
+		switch srv.Auth {
+		case "", AuthPassword, AuthNone:
+		default:
+			add(prefix+authKey, "%q is not an auth mode; use %s or %s", srv.Auth, AuthPassword, AuthNone)
+		}
+		if msg := checkProxy(srv.Proxy); msg != "" {
+			add(prefix+"proxy", "%s", msg)
+		}
+	}
+	checkServer("", "qbHost", "qbAuth", Server{Host: c.QbHost, Auth: c.QbAuth})
+	for _, name := range sortedKeys(c.Servers) {
+		checkServer("servers."+name+".", "host", "auth", c.Servers[name])
+	}
+
+	if c.DefaultServer != "" {
+		if _, err := c.Server(c.DefaultServer); err != nil {
+			add("defaultServer", "%v", err)
+		}
+	}
+	known := c.ServerNames()
+	for i, m := range c.PathMaps {
+		for field, name := range map[string]string{"from": m.From, "to": m.To} {
+			if !oneOf(name, known) {
+				add(fmt.Sprintf("pathMaps[%d].%s", i, field), "%q is not a server profile; known servers: %v", name, known)
+			}
+		}
+	}
+
+	if c.parsed != nil {
+		warnings = append(warnings, c.parsed.unknown...)
+		c.parsed.locate(warnings)
+		c.parsed.locate(problems)
+	}
+	sortProblems(warnings)
+	sortProblems(problems)
+	if len(problems) > 0 {
+		return warnings, &ValidationError{Problems: problems}
+	}
+	return warnings, nil
+}
+
+// locate fills in the position of problems whose key, or the closest
+// enclosing key, appeared in the parsed files.
+func (info *parseInfo) locate(problems []Problem) {
+	for i := range problems {
+		loc, ok := info.lookup(problems[i].Key)
+		if !ok {
+			continue
+		}
+		problems[i].Line, problems[i].Column = loc.line, loc.col
+		problems[i].File = loc.where(info.path)
+	}
+}
+
+func sortProblems(problems []Problem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Key < problems[j].Key
+	})
+}
+
+func checkHost(host string) string {
+	if host == "" {
+		return ""
+	}
+	if socket, ok := strings.CutPrefix(host, "unix://"); ok {
+		if !strings.HasPrefix(socket, "/") {
+			return fmt.Sprintf("%q must be an absolute socket path, e.g. unix:///run/qbittorrent.sock", host)
+		}
+		return ""
+	}
+	u, err := url.Parse(host)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Sprintf("%q must include a scheme and address, e.g. http://localhost:8080", host)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Sprintf("%q has unsupported scheme %q; use http, https or unix", host, u.Scheme)
+	}
+	return ""
+}
+
+func checkProxy(proxy string) string {
+	if proxy == "" {
+		return ""
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Sprintf("cannot parse proxy URL: %v", err)
+	}
+	if !oneOf(u.Scheme, []string{"http", "https", "socks5", "socks5h"}) {
+		return fmt.Sprintf("unsupported proxy scheme %q; use http, https, socks5 or socks5h", u.Scheme)
+	}
+	if u.Host == "" {
+		return "proxy URL is missing an address"
+	}
+	return ""
+}
+
+// checkPath rejects paths whose meaning depends on the working directory,
+// which for a browser-launched magnet handler is anyone's guess.
+func checkPath(path string) string {
+	switch {
+	case path == "":
+		return ""
+	case strings.HasPrefix(path, "~"):
+		return fmt.Sprintf("%q: ~ is not expanded; write the full path", path)
+	case !filepath.IsAbs(path):
+		return fmt.Sprintf("%q must be an absolute path", path)
+	}
+	return ""
+}
+
+func oneOf(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,547 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The YAML support covers what a config file needs: block mappings and
+// sequences, single-line flow collections, quoted and plain scalars, and
+// comments. Anchors, tags, block scalars and multi-line plain scalars are
+// rejected rather than misread.
+
+// yamlLine is a line of content, with comments and indentation removed.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines     []yamlLine
+	pos       int
+	locations map[string]location
+}
+
+func decodeYAML(data []byte, locations map[string]location) (map[string]any, error) {
+	lines, err := yamlLines(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &yamlParser{lines: lines, locations: locations}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+	first := lines[0]
+	if strings.HasPrefix(first.text, "- ") || first.text == "-" || !isYAMLMapping(first.text) {
+		return nil, yamlErrorf(first, 0, "config must be a mapping of keys to values")
+	}
+	v, err := p.block(first.indent, "")
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, yamlErrorf(p.lines[p.pos], 0, "unexpected indentation")
+	}
+	return v.(map[string]any), nil
+}
+
+// yamlLines splits data into content lines, dropping blank lines, comments
+// and document markers.
+func yamlLines(data []byte) ([]yamlLine, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		if i == 0 {
+			raw = strings.TrimPrefix(raw, "\ufeff")
+		}
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		line := yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: trimmed}
+		if trimmed[0] == '\t' {
+			return nil, yamlErrorf(line, 0, "indent with spaces, not tabs")
+		}
+		if trimmed[0] == '%' {
+			return nil, yamlErrorf(line, 0, "YAML directives are not supported")
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// yamlHasComments reports whether data has a comment.
+func yamlHasComments(data []byte) bool {
+	for _, raw := range strings.Split(string(data), "\n") {
+		if stripYAMLComment(raw) != raw {
+			return true
+		}
+	}
+	return false
+}
+
+// stripYAMLComment removes a trailing # comment outside quotes.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				if quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t:[{,-", s[i-1]) >= 0):
+			quote = c
+		}
+	}
+	return s
+}
+
+func yamlErrorf(line yamlLine, offset int, format string, args ...any) error {
+	return fmt.Errorf("line %d, column %d: %s", line.num, line.indent+offset+1, fmt.Sprintf(format, args...))
+}
+
+// block parses the mapping or sequence starting at the current line.
+func (p *yamlParser) block(indent int, path string) (any, error) {
+	line := p.lines[p.pos]
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.sequence(indent, path)
+	}
+	return p.mapping(indent, path)
+}
+
+func (p *yamlParser) mapping(indent int, path string) (map[string]any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, yamlErrorf(line, 0, "unexpected indentation")
+		}
+		if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+			return nil, yamlErrorf(line, 0, "expected a key, found a list item")
+		}
+		key, rest, offset, err := splitYAMLKey(line)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := m[key]; dup {
+			return nil, yamlErrorf(line, 0, "duplicate key %q", key)
+		}
+		child := joinKey(path, key)
+		p.locations[child] = location{line: line.num, col: line.indent + 1}
+		p.pos++
+
+		if rest != "" {
+			v, err := yamlInline(line, offset, rest)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			isItem := next.text == "-" || strings.HasPrefix(next.text, "- ")
+			// A sequence may sit at the same indentation as its key.
+			if next.indent > indent || (next.indent == indent && isItem) {
+				v, err := p.block(next.indent, child)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+				continue
+			}
+		}
+		m[key] = nil
+	}
+	return m, nil
+}
+
+func (p *yamlParser) sequence(indent int, path string) ([]any, error) {
+	list := []any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !(line.text == "-" || strings.HasPrefix(line.text, "- ")) {
+			if line.indent > indent {
+				return nil, yamlErrorf(line, 0, "unexpected indentation")
+			}
+			break
+		}
+		child := fmt.Sprintf("%s[%d]", path, len(list))
+		p.locations[child] = location{line: line.num, col: line.indent + 1}
+
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			var v any
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				var err error
+				if v, err = p.block(p.lines[p.pos].indent, child); err != nil {
+					return nil, err
+				}
+			}
+			list = append(list, v)
+			continue
+		}
+
+		offset := len(line.text) - len(rest)
+		if strings.HasPrefix(rest, "- ") || rest == "-" || isYAMLMapping(rest) {
+			// "- key: value" opens a nested block whose indentation is the
+			// column of its first key.
+			p.lines[p.pos] = yamlLine{num: line.num, indent: line.indent + offset, text: rest}
+			v, err := p.block(line.indent+offset, child)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			continue
+		}
+		v, err := yamlInline(line, offset, rest)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		p.pos++
+	}
+	return list, nil
+}
+
+// isYAMLMapping reports whether text starts with a "key:" entry.
+func isYAMLMapping(text string) bool {
+	if text == "" || strings.IndexByte("[{", text[0]) >= 0 {
+		return false
+	}
+	_, _, _, err := splitYAMLKey(yamlLine{text: text})
+	return err == nil
+}
+
+// splitYAMLKey splits "key: value" into the key and the value text, which
+// starts offset bytes into the line.
+func splitYAMLKey(line yamlLine) (key, rest string, offset int, err error) {
+	text := line.text
+	var end int
+	switch text[0] {
+	case '"', '\'':
+		s, n, err := yamlQuoted(text)
+		if err != nil {
+			return "", "", 0, yamlErrorf(line, 0, "%v", err)
+		}
+		key, end = s, n
+		if end >= len(text) || text[end] != ':' {
+			return "", "", 0, yamlErrorf(line, end, "expected ':' after the key")
+		}
+	default:
+		end = strings.Index(text, ": ")
+		if end < 0 {
+			if !strings.HasSuffix(text, ":") {
+				return "", "", 0, yamlErrorf(line, 0, "expected key: value")
+			}
+			end = len(text) - 1
+		}
+		key = strings.TrimRight(text[:end], " ")
+		if key == "" {
+			return "", "", 0, yamlErrorf(line, 0, "missing key")
+		}
+		if strings.IndexByte("&*!|>?@`", key[0]) >= 0 {
+			return "", "", 0, yamlErrorf(line, 0, "unsupported YAML syntax %q", key[:1])
+		}
+	}
+	rest = strings.TrimLeft(text[end+1:], " ")
+	return key, rest, len(text) - len(rest), nil
+}
+
+// yamlInline decodes a value written on the same line as its key or dash.
+func yamlInline(line yamlLine, offset int, text string) (any, error) {
+	switch text[0] {
+	case '|', '>':
+		return nil, yamlErrorf(line, offset, "block scalars (| and >) are not supported; use a quoted string")
+	case '&', '*':
+		return nil, yamlErrorf(line, offset, "anchors and aliases are not supported")
+	case '!':
+		return nil, yamlErrorf(line, offset, "tags are not supported")
+	case '[', '{':
+		f := &yamlFlow{text: text}
+		v, err := f.value()
+		if err == nil {
+			f.skipSpace()
+			if f.pos < len(f.text) {
+				err = fmt.Errorf("unexpected %q after the value", f.text[f.pos:])
+			}
+		}
+		if err != nil {
+			return nil, yamlErrorf(line, offset+f.pos, "%v", err)
+		}
+		return v, nil
+	case '"', '\'':
+		s, n, err := yamlQuoted(text)
+		if err != nil {
+			return nil, yamlErrorf(line, offset, "%v", err)
+		}
+		if n != len(text) {
+			return nil, yamlErrorf(line, offset+n, "unexpected text after the quoted string")
+		}
+		return s, nil
+	}
+	return yamlScalar(text), nil
+}
+
+// yamlQuoted decodes the quoted string at the start of s, returning it and
+// the number of bytes it took.
+func yamlQuoted(s string) (string, int, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			if quote == '\'' {
+				return strings.ReplaceAll(s[1:i], "''", "'"), i + 1, nil
+			}
+			out, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid escape in %s", s[:i+1])
+			}
+			return out, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// yamlScalar resolves a plain scalar by the YAML 1.2 core schema.
+func yamlScalar(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if yamlInt.MatchString(s) {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0o") {
+		if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return n
+		}
+	}
+	if yamlFloat.MatchString(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) {
+			return f
+		}
+	}
+	return s
+}
+
+// yamlFlow parses a single-line flow collection such as [a, b] or {k: v}.
+type yamlFlow struct {
+	text string
+	pos  int
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *yamlFlow) value() (any, error) {
+	f.skipSpace()
+	if f.pos >= len(f.text) {
+		return nil, fmt.Errorf("missing value; flow collections must fit on one line")
+	}
+	switch c := f.text[f.pos]; c {
+	case '[':
+		f.pos++
+		list := []any{}
+		for {
+			f.skipSpace()
+			if f.pos < len(f.text) && f.text[f.pos] == ']' {
+				f.pos++
+				return list, nil
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.pos++
+		m := map[string]any{}
+		for {
+			f.skipSpace()
+			if f.pos < len(f.text) && f.text[f.pos] == '}' {
+				f.pos++
+				return m, nil
+			}
+			k, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				key = fmt.Sprint(k)
+			}
+			f.skipSpace()
+			if f.pos >= len(f.text) || f.text[f.pos] != ':' {
+				return nil, fmt.Errorf("expected ':' after %q", key)
+			}
+			f.pos++
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '"', '\'':
+		s, n, err := yamlQuoted(f.text[f.pos:])
+		if err != nil {
+			return nil, err
+		}
+		f.pos += n
+		return s, nil
+	default:
+		start := f.pos
+		for f.pos < len(f.text) && strings.IndexByte(",[]{}", f.text[f.pos]) < 0 &&
+			!(f.text[f.pos] == ':' && (f.pos+1 == len(f.text) || f.text[f.pos+1] == ' ')) {
+			f.pos++
+		}
+		return yamlScalar(strings.TrimRight(f.text[start:f.pos], " ")), nil
+	}
+}
+
+// separator consumes the comma between items, or leaves the closing bracket.
+func (f *yamlFlow) separator(closing byte) error {
+	f.skipSpace()
+	switch {
+	case f.pos >= len(f.text):
+		return fmt.Errorf("missing %q; flow collections must fit on one line", closing)
+	case f.text[f.pos] == ',':
+		f.pos++
+	case f.text[f.pos] != closing:
+		return fmt.Errorf("expected ',' or %q", closing)
+	}
+	return nil
+}
+
+// encodeYAML writes an ordered document as block YAML.
+func encodeYAML(obj *object) []byte {
+	var buf bytes.Buffer
+	writeYAMLObject(&buf, obj, 0)
+	return buf.Bytes()
+}
+
+func writeYAMLObject(buf *bytes.Buffer, obj *object, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, k := range obj.keys {
+		key := yamlString(k)
+		switch v := obj.values[k].(type) {
+		case *object:
+			if len(v.keys) == 0 {
+				fmt.Fprintf(buf, "%s%s: {}\n", pad, key)
+				continue
+			}
+			fmt.Fprintf(buf, "%s%s:\n", pad, key)
+			writeYAMLObject(buf, v, indent+2)
+		case []any:
+			if len(v) == 0 {
+				fmt.Fprintf(buf, "%s%s: []\n", pad, key)
+				continue
+			}
+			fmt.Fprintf(buf, "%s%s:\n", pad, key)
+			writeYAMLList(buf, v, indent+2)
+		default:
+			fmt.Fprintf(buf, "%s%s: %s\n", pad, key, yamlValue(v))
+		}
+	}
+}
+
+func writeYAMLList(buf *bytes.Buffer, list []any, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, item := range list {
+		child, ok := item.(*object)
+		if !ok || len(child.keys) == 0 {
+			fmt.Fprintf(buf, "%s- %s\n", pad, yamlValue(item))
+			continue
+		}
+		// Write the object two columns in, then hang its first line on
+		// the dash.
+		var nested bytes.Buffer
+		writeYAMLObject(&nested, child, indent+2)
+		buf.WriteString(pad + "- ")
+		buf.Write(nested.Bytes()[indent+2:])
+	}
+}
+
+// yamlValue writes a scalar, or a collection in flow style as JSON, which
+// is valid YAML.
+func yamlValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return yamlString(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// yamlString leaves s plain when it reads back as the same string, and
+// quotes it otherwise.
+func yamlString(s string) string {
+	if _, isString := yamlScalar(s).(string); isString && yamlPlainSafe(s) {
+		return s
+	}
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func yamlPlainSafe(s string) bool {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return false
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return false
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f || r == '\ufeff' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Results recorded for an entry.
+const (
+	ResultAdded     = "added"
+	ResultDuplicate = "duplicate"
+	ResultMerged    = "merged"
+	ResultFailed    = "failed"
+)
+
+// Entry is one handled magnet.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Source says how the input arrived: "cli", "stdin", "file" or "resend".
+	Source string `json:"source"`
+	// Magnet is the link as given; File is the absolute path of a .torrent
+	// input instead.
+	Magnet   string  `json:"magnet,omitempty"`
+	File     string  `json:"file,omitempty"`
+	InfoHash string  `json:"infoHash,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Server   string  `json:"server"`
+	Options  Options `json:"options"`
+	Result   string  `json:"result"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Options are the add options applied to an entry.
+type Options struct {
+	Category      string   `json:"category,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	SavePath      string   `json:"savePath,omitempty"`
+	Stopped       bool     `json:"stopped,omitempty"`
+	ContentLayout string   `json:"contentLayout,omitempty"`
+	SkipChecking  bool     `json:"skipChecking,omitempty"`
+	Rename        string   `json:"rename,omitempty"`
+	OnDuplicate   string   `json:"onDuplicate,omitempty"`
+}
+
+// Store is an append-only history file with one JSON entry per line.
+type Store struct {
+	path string
+}
+
+// NewStore returns the store kept at path. The file is created on first Append.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path returns the file backing the store.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append writes e as a single line, so concurrent writers do not interleave.
+func (s *Store) Append(e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("create history dir: %w", err)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode history entry: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open history: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("write history: %w", err)
+	}
+	return f.Close()
+}
+
+// Load returns all entries, oldest first. A missing file is an empty history;
+// lines that do not parse, such as one cut short by a crash, are skipped.
+func (s *Store) Load() ([]Entry, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open history: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	return entries, nil
+}
+
+// Filter selects entries; zero fields match everything.
+type Filter struct {
+	// Query matches the name, info-hash, magnet or file, case-insensitively.
+	Query  string
+	Hash   string
+	Server string
+	Result string
+	Since  time.Time
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e Entry) bool {
+	if f.Hash != "" && !strings.HasPrefix(e.InfoHash, strings.ToLower(f.Hash)) {
+		return false
+	}
+	if f.Server != "" && e.Server != f.Server {
+		return false
+	}
+	if f.Result != "" && e.Result != f.Result {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(e.Name), q) && !strings.Contains(e.InfoHash, q) && !strings.Contains(strings.ToLower(e.Magnet), q) && !strings.Contains(strings.ToLower(e.File), q) {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the entries matching f, oldest first.
+func Select(entries []Entry, f Filter) []Entry {
+	var out []Entry
+	for _, e := range entries {
+		if f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// LastAdded returns the most recent successful add of hash to server.
+func LastAdded(entries []Entry, hash, server string) (Entry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.InfoHash == hash && e.Server == server && e.Result == ResultAdded {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
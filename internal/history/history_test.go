@@ -0,0 +1,67 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendLoadAndFilter(t *testing.T) {
+	t.Parallel()
+
+	store := NewStore(filepath.Join(t.TempDir(), "sub", "history.jsonl"))
+	entries, err := store.Load()
+	if err != nil || entries != nil {
+		t.Fatalf("Load() on missing file = %v, %v", entries, err)
+	}
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, e := range []Entry{
+		{Time: base, Source: "cli", InfoHash: "aaa111", Name: "Debian ISO", Server: "home", Result: ResultAdded},
+		{Time: base.Add(time.Hour), Source: "cli", InfoHash: "bbb222", Name: "Fedora", Server: "seedbox", Result: ResultFailed, Error: "boom"},
+		{Time: base.Add(2 * time.Hour), Source: "resend", InfoHash: "aaa111", Name: "Debian ISO", Server: "home", Result: ResultDuplicate},
+	} {
+		if err := store.Append(e); err != nil {
+			t.Fatalf("Append error: %v", err)
+		}
+	}
+
+	// A truncated trailing line from an interrupted write is ignored.
+	f, err := os.OpenFile(store.Path(), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"time":"2024-05`)
+	f.Close()
+
+	entries, err = store.Load()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("Load() = %d entries, %v", len(entries), err)
+	}
+
+	cases := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"all", Filter{}, 3},
+		{"query name", Filter{Query: "debian"}, 2},
+		{"hash prefix", Filter{Hash: "BBB"}, 1},
+		{"server", Filter{Server: "home"}, 2},
+		{"result", Filter{Result: ResultFailed}, 1},
+		{"since", Filter{Since: base.Add(90 * time.Minute)}, 1},
+	}
+	for _, tc := range cases {
+		if got := len(Select(entries, tc.filter)); got != tc.want {
+			t.Errorf("%s: got %d entries, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	if e, ok := LastAdded(entries, "aaa111", "home"); !ok || e.Source != "cli" {
+		t.Fatalf("LastAdded() = %+v, %t", e, ok)
+	}
+	if _, ok := LastAdded(entries, "bbb222", "seedbox"); ok {
+		t.Fatalf("failed entries must not count as added")
+	}
+}
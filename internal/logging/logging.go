@@ -6,44 +6,89 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Logger is a thin wrapper around the standard log.Logger to allow future upgrades.
 type Logger struct {
-	level string
+	level int
+	file  io.Writer
 	base  *log.Logger
 }
 
-// NewLogger builds a logger; level is accepted for future compatibility.
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// NewLogger builds a logger writing to stdout and, when set, logPath. Messages
+// below level (debug, info, warn, error) are dropped.
 func NewLogger(level string, logPath string) *Logger {
-	writers := []io.Writer{os.Stdout}
+	l := &Logger{level: parseLevel(level)}
 
 	if logPath != "" {
 		if f, err := openLogFile(logPath); err != nil {
 			fmt.Fprintf(os.Stderr, "magnet2torrent: could not open log file %s: %v\n", logPath, err)
 		} else {
-			writers = append(writers, f)
+			l.file = f
 		}
 	}
 
-	return &Logger{
-		level: level,
-		base:  log.New(io.MultiWriter(writers...), "magnet2torrent: ", log.LstdFlags),
+	l.SetConsole(os.Stdout)
+	return l
+}
+
+// SetConsole redirects console output (stdout by default), e.g. to stderr for
+// commands whose stdout is meant to be parsed. A nil writer silences the
+// console; the log file is unaffected.
+func (l *Logger) SetConsole(w io.Writer) {
+	writers := []io.Writer{}
+	if w != nil {
+		writers = append(writers, w)
+	}
+	if l.file != nil {
+		writers = append(writers, l.file)
+	}
+	l.base = log.New(io.MultiWriter(writers...), "magnet2torrent: ", log.LstdFlags)
+}
+
+func (l *Logger) Debugf(format string, args ...any) {
+	if l.level <= levelDebug {
+		l.base.Printf("[DEBUG] "+format, args...)
 	}
 }
 
 func (l *Logger) Infof(format string, args ...any) {
-	l.base.Printf("[INFO] "+format, args...)
+	if l.level <= levelInfo {
+		l.base.Printf("[INFO] "+format, args...)
+	}
 }
 
 func (l *Logger) Warnf(format string, args ...any) {
-	l.base.Printf("[WARN] "+format, args...)
+	if l.level <= levelWarn {
+		l.base.Printf("[WARN] "+format, args...)
+	}
 }
 
 func (l *Logger) Errorf(format string, args ...any) {
 	l.base.Printf("[ERROR] "+format, args...)
 }
 
+func parseLevel(level string) int {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return levelDebug
+	case "warn", "warning":
+		return levelWarn
+	case "error":
+		return levelError
+	default:
+		return levelInfo
+	}
+}
+
 func openLogFile(path string) (io.Writer, error) {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
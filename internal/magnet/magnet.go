@@ -0,0 +1,104 @@
+package magnet
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Link is the subset of a magnet URI this tool cares about.
+type Link struct {
+	// InfoHash is the lowercase hex identifier qBittorrent uses for the
+	// torrent: the v1 SHA-1 hash, or the v2 SHA-256 hash truncated to 40
+	// characters for v2-only magnets.
+	InfoHash string
+	// Name is the dn (display name) parameter, if any.
+	Name string
+	// Trackers lists the tr parameters in order.
+	Trackers []string
+}
+
+// Parse extracts the info-hash, display name and trackers from a magnet URI.
+func Parse(link string) (*Link, error) {
+	link = strings.TrimSpace(link)
+	if !strings.HasPrefix(strings.ToLower(link), "magnet:?") {
+		return nil, errors.New("not a magnet link")
+	}
+
+	params, err := url.ParseQuery(link[len("magnet:?"):])
+	if err != nil {
+		return nil, fmt.Errorf("parse magnet: %w", err)
+	}
+
+	out := &Link{Name: params.Get("dn"), Trackers: params["tr"]}
+
+	var v2 string
+	for _, xt := range params["xt"] {
+		lower := strings.ToLower(xt)
+		switch {
+		case strings.HasPrefix(lower, "urn:btih:"):
+			hash, err := decodeBTIH(xt[len("urn:btih:"):])
+			if err != nil {
+				return nil, err
+			}
+			out.InfoHash = hash
+		case strings.HasPrefix(lower, "urn:btmh:"):
+			hash, err := decodeBTMH(xt[len("urn:btmh:"):])
+			if err != nil {
+				return nil, err
+			}
+			v2 = hash
+		}
+	}
+
+	if out.InfoHash == "" && v2 != "" {
+		out.InfoHash = v2[:40]
+	}
+	if out.InfoHash == "" {
+		return nil, errors.New("magnet has no urn:btih or urn:btmh info-hash")
+	}
+	return out, nil
+}
+
+// InfoHash is a convenience wrapper around Parse.
+func InfoHash(link string) (string, error) {
+	l, err := Parse(link)
+	if err != nil {
+		return "", err
+	}
+	return l.InfoHash, nil
+}
+
+// decodeBTIH accepts the 40-character hex or 32-character base32 forms.
+func decodeBTIH(s string) (string, error) {
+	switch len(s) {
+	case 40:
+		if _, err := hex.DecodeString(s); err != nil {
+			return "", fmt.Errorf("invalid hex info-hash %q", s)
+		}
+		return strings.ToLower(s), nil
+	case 32:
+		raw, err := base32.StdEncoding.DecodeString(strings.ToUpper(s))
+		if err != nil {
+			return "", fmt.Errorf("invalid base32 info-hash %q", s)
+		}
+		return hex.EncodeToString(raw), nil
+	default:
+		return "", fmt.Errorf("info-hash %q has unexpected length %d", s, len(s))
+	}
+}
+
+// decodeBTMH accepts a multihash-encoded SHA-256 (prefix 1220) info-hash.
+func decodeBTMH(s string) (string, error) {
+	s = strings.ToLower(s)
+	if len(s) != 68 || !strings.HasPrefix(s, "1220") {
+		return "", fmt.Errorf("unsupported btmh info-hash %q", s)
+	}
+	if _, err := hex.DecodeString(s[4:]); err != nil {
+		return "", fmt.Errorf("invalid btmh info-hash %q", s)
+	}
+	return s[4:], nil
+}
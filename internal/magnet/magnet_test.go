@@ -0,0 +1,72 @@
+package magnet
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		link     string
+		wantHash string
+		wantName string
+		wantErr  bool
+	}{
+		{
+			name:     "hex",
+			link:     "magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&dn=Debian+12&tr=udp%3A%2F%2Ftracker.example%3A1337",
+			wantHash: "c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+			wantName: "Debian 12",
+		},
+		{
+			name:     "base32",
+			link:     "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK",
+			wantHash: "c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+		},
+		{
+			name:     "hybrid_prefers_v1",
+			link:     "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&xt=urn:btmh:1220caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e",
+			wantHash: "c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+		},
+		{
+			name:     "v2_only_truncated",
+			link:     "magnet:?xt=urn:btmh:1220caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e",
+			wantHash: "caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa",
+		},
+		{name: "not_magnet", link: "http://example.com", wantErr: true},
+		{name: "no_hash", link: "magnet:?dn=nothing", wantErr: true},
+		{name: "bad_length", link: "magnet:?xt=urn:btih:example", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := Parse(tc.link)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%q) expected error, got %+v", tc.link, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tc.link, err)
+			}
+			if got.InfoHash != tc.wantHash || got.Name != tc.wantName {
+				t.Fatalf("Parse(%q) = %+v, want hash %q name %q", tc.link, got, tc.wantHash, tc.wantName)
+			}
+		})
+	}
+}
+
+func TestParseTrackers(t *testing.T) {
+	t.Parallel()
+
+	l, err := Parse("magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&tr=udp%3A%2F%2Fa%3A1&tr=http%3A%2F%2Fb%2Fannounce")
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if len(l.Trackers) != 2 || l.Trackers[0] != "udp://a:1" || l.Trackers[1] != "http://b/announce" {
+		t.Fatalf("unexpected trackers: %v", l.Trackers)
+	}
+}
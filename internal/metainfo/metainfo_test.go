@@ -0,0 +1,51 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	v1Info := "d6:lengthi12e4:name6:debian12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+	v2Info := "d9:file treed0:dee12:meta versioni2e4:name4:test12:piece lengthi16384ee"
+	sum1 := sha1.Sum([]byte(v1Info))
+	sum2 := sha256.Sum256([]byte(v2Info))
+
+	cases := []struct {
+		name     string
+		data     string
+		wantHash string
+		wantName string
+		trackers int
+		wantErr  bool
+	}{
+		{"v1", "d8:announce15:http://t.test/a13:announce-listll15:http://t.test/ael15:http://t.test/bee4:info" + v1Info + "e", hex.EncodeToString(sum1[:]), "debian", 2, false},
+		{"v2 only", "d4:info" + v2Info + "e", hex.EncodeToString(sum2[:])[:40], "test", 0, false},
+		{"no info", "d8:announce3:abce", "", "", 0, true},
+		{"truncated", "d4:infod4:name", "", "", 0, true},
+		{"not bencode", "<html>", "", "", 0, true},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			info, err := Parse([]byte(tc.data))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			if info.InfoHash != tc.wantHash || info.Name != tc.wantName || len(info.Trackers) != tc.trackers {
+				t.Fatalf("Parse() = %+v, want %s %s", info, tc.wantHash, tc.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package qbclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Category is an entry from /api/v2/torrents/categories.
+type Category struct {
+	Name     string `json:"name"`
+	SavePath string `json:"savePath"`
+}
+
+// Categories returns all categories keyed by name.
+func (c *Client) Categories() (map[string]Category, error) {
+	body, err := c.get("/api/v2/torrents/categories", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := map[string]Category{}
+	if err := json.Unmarshal(body, &categories); err != nil {
+		return nil, fmt.Errorf("decode categories: %w", err)
+	}
+	return categories, nil
+}
+
+// CreateCategory adds a category; an empty savePath uses the default.
+func (c *Client) CreateCategory(name, savePath string) error {
+	if name == "" {
+		return errors.New("category name is empty")
+	}
+	_, err := c.postForm("/api/v2/torrents/createCategory", url.Values{"category": {name}, "savePath": {savePath}})
+	return err
+}
+
+// EditCategory changes the save path of an existing category.
+func (c *Client) EditCategory(name, savePath string) error {
+	if name == "" {
+		return errors.New("category name is empty")
+	}
+	_, err := c.postForm("/api/v2/torrents/editCategory", url.Values{"category": {name}, "savePath": {savePath}})
+	return err
+}
+
+// RemoveCategories deletes categories; their torrents become uncategorized.
+func (c *Client) RemoveCategories(names []string) error {
+	if len(names) == 0 {
+		return errors.New("no categories given")
+	}
+	_, err := c.postForm("/api/v2/torrents/removeCategories", url.Values{"categories": {strings.Join(names, "\n")}})
+	return err
+}
+
+// Tags lists all tags known to the server.
+func (c *Client) Tags() ([]string, error) {
+	body, err := c.get("/api/v2/torrents/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	if err := json.Unmarshal(body, &tags); err != nil {
+		return nil, fmt.Errorf("decode tags: %w", err)
+	}
+	return tags, nil
+}
+
+// CreateTags adds tags to the server's tag list.
+func (c *Client) CreateTags(tags []string) error {
+	return c.postTags("/api/v2/torrents/createTags", tags)
+}
+
+// DeleteTags removes tags from the server and from every torrent.
+func (c *Client) DeleteTags(tags []string) error {
+	return c.postTags("/api/v2/torrents/deleteTags", tags)
+}
+
+func (c *Client) postTags(path string, tags []string) error {
+	if len(tags) == 0 {
+		return errors.New("no tags given")
+	}
+	_, err := c.postForm(path, url.Values{"tags": {strings.Join(tags, ",")}})
+	return err
+}
@@ -0,0 +1,99 @@
+package qbclient
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func hashesForm(hashes []string) (url.Values, error) {
+	if len(hashes) == 0 {
+		return nil, errors.New("no torrents selected")
+	}
+	return url.Values{"hashes": {strings.Join(hashes, "|")}}, nil
+}
+
+// Stop stops (pauses) torrents. qBittorrent 5 renamed torrents/pause to
+// torrents/stop; the name is chosen from the server's Web API version.
+func (c *Client) Stop(hashes []string) error {
+	return c.postHashesCompat(hashes, "/api/v2/torrents/stop", "/api/v2/torrents/pause")
+}
+
+// Start starts (resumes) torrents, using torrents/resume on servers older
+// than qBittorrent 5.
+func (c *Client) Start(hashes []string) error {
+	return c.postHashesCompat(hashes, "/api/v2/torrents/start", "/api/v2/torrents/resume")
+}
+
+// Delete removes torrents, and their downloaded data when deleteFiles is set.
+func (c *Client) Delete(hashes []string, deleteFiles bool) error {
+	form, err := hashesForm(hashes)
+	if err != nil {
+		return err
+	}
+	form.Set("deleteFiles", strconv.FormatBool(deleteFiles))
+	_, err = c.postForm("/api/v2/torrents/delete", form)
+	return err
+}
+
+// Recheck re-verifies downloaded data.
+func (c *Client) Recheck(hashes []string) error {
+	return c.postHashes(hashes, "/api/v2/torrents/recheck")
+}
+
+// Reannounce announces torrents to all their trackers now.
+func (c *Client) Reannounce(hashes []string) error {
+	return c.postHashes(hashes, "/api/v2/torrents/reannounce")
+}
+
+// SetForceStart toggles force start, which ignores queueing limits.
+func (c *Client) SetForceStart(hashes []string, value bool) error {
+	form, err := hashesForm(hashes)
+	if err != nil {
+		return err
+	}
+	form.Set("value", strconv.FormatBool(value))
+	_, err = c.postForm("/api/v2/torrents/setForceStart", form)
+	return err
+}
+
+// QueueTop, QueueBottom, QueueUp and QueueDown move torrents in the download
+// queue. qBittorrent answers 409 Conflict when queueing is disabled.
+func (c *Client) QueueTop(hashes []string) error {
+	return c.postHashes(hashes, "/api/v2/torrents/topPrio")
+}
+
+func (c *Client) QueueBottom(hashes []string) error {
+	return c.postHashes(hashes, "/api/v2/torrents/bottomPrio")
+}
+
+func (c *Client) QueueUp(hashes []string) error {
+	return c.postHashes(hashes, "/api/v2/torrents/increasePrio")
+}
+
+func (c *Client) QueueDown(hashes []string) error {
+	return c.postHashes(hashes, "/api/v2/torrents/decreasePrio")
+}
+
+func (c *Client) postHashes(hashes []string, path string) error {
+	form, err := hashesForm(hashes)
+	if err != nil {
+		return err
+	}
+	_, err = c.postForm(path, form)
+	return err
+}
+
+// postHashesCompat posts to path on servers with FeatureStopStart and to
+// legacyPath on older ones.
+func (c *Client) postHashesCompat(hashes []string, path, legacyPath string) error {
+	caps, err := c.Capabilities()
+	if err != nil {
+		return err
+	}
+	if !caps.Supports(FeatureStopStart) {
+		path = legacyPath
+	}
+	return c.postHashes(hashes, path)
+}
@@ -0,0 +1,36 @@
+package qbclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Preferences returns the application preferences as raw JSON values keyed
+// by qBittorrent's preference names (e.g. max_active_downloads).
+func (c *Client) Preferences() (map[string]any, error) {
+	body, err := c.get("/api/v2/app/preferences", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs := map[string]any{}
+	if err := json.Unmarshal(body, &prefs); err != nil {
+		return nil, fmt.Errorf("decode preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// SetPreferences changes only the given preferences.
+func (c *Client) SetPreferences(prefs map[string]any) error {
+	if len(prefs) == 0 {
+		return errors.New("no preferences given")
+	}
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return fmt.Errorf("encode preferences: %w", err)
+	}
+	_, err = c.postForm("/api/v2/app/setPreferences", url.Values{"json": {string(data)}})
+	return err
+}
@@ -0,0 +1,146 @@
+package qbclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// MainData is one reply from /api/v2/sync/maindata. Unless FullUpdate is set,
+// torrent and server state entries only carry the fields that changed since
+// the previous rid.
+type MainData struct {
+	Rid             int64                      `json:"rid"`
+	FullUpdate      bool                       `json:"full_update"`
+	Torrents        map[string]json.RawMessage `json:"torrents"`
+	TorrentsRemoved []string                   `json:"torrents_removed"`
+	ServerState     json.RawMessage            `json:"server_state"`
+}
+
+// ServerState is the global transfer state reported by sync/maindata.
+type ServerState struct {
+	ConnectionStatus string `json:"connection_status"`
+	DlInfoSpeed      int64  `json:"dl_info_speed"`
+	UpInfoSpeed      int64  `json:"up_info_speed"`
+	FreeSpaceOnDisk  int64  `json:"free_space_on_disk"`
+}
+
+// SyncMainData fetches changes since rid; pass 0 for a full snapshot.
+func (c *Client) SyncMainData(rid int64) (*MainData, error) {
+	body, err := c.get("/api/v2/sync/maindata", url.Values{"rid": {strconv.FormatInt(rid, 10)}})
+	if err != nil {
+		return nil, err
+	}
+
+	var data MainData
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("decode maindata: %w", err)
+	}
+	return &data, nil
+}
+
+// SyncState accumulates incremental MainData replies into a full view.
+type SyncState struct {
+	// Rid is the response id to pass to the next SyncMainData call.
+	Rid      int64
+	torrents map[string]map[string]json.RawMessage
+	server   map[string]json.RawMessage
+}
+
+// NewSyncState returns an empty state; its first request fetches everything.
+func NewSyncState() *SyncState {
+	return &SyncState{
+		torrents: map[string]map[string]json.RawMessage{},
+		server:   map[string]json.RawMessage{},
+	}
+}
+
+// Apply merges a MainData reply into the state.
+func (s *SyncState) Apply(d *MainData) error {
+	if d.FullUpdate {
+		s.torrents = map[string]map[string]json.RawMessage{}
+		s.server = map[string]json.RawMessage{}
+	}
+
+	for hash, raw := range d.Torrents {
+		fields := s.torrents[hash]
+		if fields == nil {
+			fields = map[string]json.RawMessage{}
+			s.torrents[hash] = fields
+		}
+		if err := mergeFields(fields, raw); err != nil {
+			return fmt.Errorf("merge torrent %s: %w", hash, err)
+		}
+	}
+	for _, hash := range d.TorrentsRemoved {
+		delete(s.torrents, hash)
+	}
+	if len(d.ServerState) > 0 {
+		if err := mergeFields(s.server, d.ServerState); err != nil {
+			return fmt.Errorf("merge server state: %w", err)
+		}
+	}
+
+	s.Rid = d.Rid
+	return nil
+}
+
+// Torrent returns the merged view of one torrent.
+func (s *SyncState) Torrent(hash string) (*Torrent, bool) {
+	fields, ok := s.torrents[hash]
+	if !ok {
+		return nil, false
+	}
+	t, err := decodeFields[Torrent](fields)
+	if err != nil {
+		return nil, false
+	}
+	t.Hash = hash
+	return &t, true
+}
+
+// Torrents returns every known torrent, ordered by hash.
+func (s *SyncState) Torrents() []Torrent {
+	hashes := make([]string, 0, len(s.torrents))
+	for hash := range s.torrents {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	out := make([]Torrent, 0, len(hashes))
+	for _, hash := range hashes {
+		if t, ok := s.Torrent(hash); ok {
+			out = append(out, *t)
+		}
+	}
+	return out
+}
+
+// ServerState returns the merged global state.
+func (s *SyncState) ServerState() ServerState {
+	st, _ := decodeFields[ServerState](s.server)
+	return st
+}
+
+func mergeFields(dst map[string]json.RawMessage, raw json.RawMessage) error {
+	var partial map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &partial); err != nil {
+		return err
+	}
+	for k, v := range partial {
+		dst[k] = v
+	}
+	return nil
+}
+
+func decodeFields[T any](fields map[string]json.RawMessage) (T, error) {
+	var out T
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return out, err
+	}
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
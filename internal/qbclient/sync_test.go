@@ -0,0 +1,76 @@
+package qbclient
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSyncMainDataIncremental(t *testing.T) {
+	replies := []string{
+		`{"rid":1,"full_update":true,"torrents":{"aaa":{"name":"debian","progress":0.1,"state":"downloading","size":100},"bbb":{"name":"old","progress":1}},"server_state":{"free_space_on_disk":5000,"connection_status":"connected"}}`,
+		`{"rid":2,"torrents":{"aaa":{"progress":0.6,"dlspeed":1024}},"torrents_removed":["bbb"],"server_state":{"free_space_on_disk":4000}}`,
+	}
+	var handlers []func(*http.Request) *http.Response
+	for i, reply := range replies {
+		i, reply := i, reply
+		handlers = append(handlers, func(r *http.Request) *http.Response {
+			if r.URL.Path != "/api/v2/sync/maindata" {
+				t.Fatalf("unexpected path: %s", r.URL.Path)
+			}
+			if want := []string{"0", "1"}[i]; r.URL.Query().Get("rid") != want {
+				t.Fatalf("request %d: rid = %s, want %s", i, r.URL.Query().Get("rid"), want)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(reply)),
+				Request:    r,
+			}
+		})
+	}
+	qb := NewWithClient("http://example.test", "admin", "password", &http.Client{Transport: &stubRoundTripper{t: t, handlers: handlers}})
+
+	state := NewSyncState()
+	for range replies {
+		data, err := qb.SyncMainData(state.Rid)
+		if err != nil {
+			t.Fatalf("SyncMainData() error = %v", err)
+		}
+		if err := state.Apply(data); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+	}
+
+	if state.Rid != 2 {
+		t.Fatalf("rid = %d, want 2", state.Rid)
+	}
+	got, ok := state.Torrent("aaa")
+	if !ok {
+		t.Fatalf("torrent aaa missing")
+	}
+	if got.Hash != "aaa" || got.Name != "debian" || got.Progress != 0.6 || got.DlSpeed != 1024 || got.Size != 100 {
+		t.Fatalf("merged torrent mismatch: %+v", got)
+	}
+	if _, ok := state.Torrent("bbb"); ok {
+		t.Fatalf("torrent bbb should have been removed")
+	}
+	if len(state.Torrents()) != 1 {
+		t.Fatalf("expected one torrent, got %d", len(state.Torrents()))
+	}
+	if st := state.ServerState(); st.FreeSpaceOnDisk != 4000 || st.ConnectionStatus != "connected" {
+		t.Fatalf("server state mismatch: %+v", st)
+	}
+}
+
+func TestSyncStateFullUpdateResets(t *testing.T) {
+	state := NewSyncState()
+	_ = state.Apply(&MainData{Rid: 1, FullUpdate: true, Torrents: map[string]json.RawMessage{"aaa": json.RawMessage(`{"name":"a"}`)}})
+	_ = state.Apply(&MainData{Rid: 2, FullUpdate: true, Torrents: map[string]json.RawMessage{"bbb": json.RawMessage(`{"name":"b"}`)}})
+
+	if _, ok := state.Torrent("aaa"); ok {
+		t.Fatalf("full update should drop torrents not in the snapshot")
+	}
+}
@@ -0,0 +1,221 @@
+package qbclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Torrent is an entry from /api/v2/torrents/info. Only the fields this tool
+// uses are decoded.
+type Torrent struct {
+	Hash        string  `json:"hash"`
+	Name        string  `json:"name"`
+	Size        int64   `json:"size"`
+	TotalSize   int64   `json:"total_size"`
+	Progress    float64 `json:"progress"`
+	DlSpeed     int64   `json:"dlspeed"`
+	UpSpeed     int64   `json:"upspeed"`
+	ETA         int64   `json:"eta"`
+	Ratio       float64 `json:"ratio"`
+	State       string  `json:"state"`
+	Category    string  `json:"category"`
+	Tags        string  `json:"tags"`
+	SavePath    string  `json:"save_path"`
+	ContentPath string  `json:"content_path"`
+	AddedOn     int64   `json:"added_on"`
+	CompletedOn int64   `json:"completion_on"`
+	MagnetURI   string  `json:"magnet_uri"`
+	// QueuePosition is 1-based; 0 or -1 when the torrent is not queued
+	// (seeding, or queueing disabled).
+	QueuePosition int `json:"priority"`
+	// Limits: speeds in bytes/s (0 or -1 unlimited); ratio and seeding time
+	// (minutes) use -2 for "global" and -1 for "no limit".
+	UpLimit          int64   `json:"up_limit"`
+	DlLimit          int64   `json:"dl_limit"`
+	RatioLimit       float64 `json:"ratio_limit"`
+	SeedingTimeLimit int64   `json:"seeding_time_limit"`
+}
+
+// TagList splits the comma-separated Tags field.
+func (t Torrent) TagList() []string {
+	var tags []string
+	for _, tag := range strings.Split(t.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ListOptions filter and order /api/v2/torrents/info. Zero values are omitted.
+type ListOptions struct {
+	// Filter is one of all, downloading, seeding, completed, paused/stopped,
+	// active, inactive, resumed/running, stalled, errored, ...
+	Filter   string
+	Category string
+	Tag      string
+	// Sort is any Torrent JSON field name, e.g. name, size or added_on.
+	Sort    string
+	Reverse bool
+	Limit   int
+	Offset  int
+	Hashes  []string
+}
+
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	if o.Filter != "" {
+		q.Set("filter", o.Filter)
+	}
+	if o.Category != "" {
+		q.Set("category", o.Category)
+	}
+	if o.Tag != "" {
+		q.Set("tag", o.Tag)
+	}
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	if o.Reverse {
+		q.Set("reverse", "true")
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset != 0 {
+		q.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if len(o.Hashes) > 0 {
+		q.Set("hashes", strings.Join(o.Hashes, "|"))
+	}
+	return q
+}
+
+// filterRenames maps state filters renamed in qBittorrent 5 to their old
+// names and back.
+var filterRenames = map[string]string{
+	"stopped": "paused",
+	"running": "resumed",
+	"paused":  "stopped",
+	"resumed": "running",
+}
+
+// Torrents lists torrents matching opts. The paused/stopped and
+// resumed/running filters are translated for the server version.
+func (c *Client) Torrents(opts ListOptions) ([]Torrent, error) {
+	if renamed, ok := filterRenames[opts.Filter]; ok {
+		caps, err := c.Capabilities()
+		if err != nil {
+			return nil, err
+		}
+		modern := opts.Filter == "stopped" || opts.Filter == "running"
+		if modern != caps.Supports(FeatureStopStart) {
+			opts.Filter = renamed
+		}
+	}
+
+	body, err := c.get("/api/v2/torrents/info", opts.query())
+	if err != nil {
+		return nil, err
+	}
+
+	var torrents []Torrent
+	if err := json.Unmarshal(body, &torrents); err != nil {
+		return nil, fmt.Errorf("decode torrents: %w", err)
+	}
+	return torrents, nil
+}
+
+// TorrentByHash returns the torrent with the given info-hash, or nil when
+// qBittorrent does not (yet) know about it.
+func (c *Client) TorrentByHash(hash string) (*Torrent, error) {
+	torrents, err := c.Torrents(ListOptions{Hashes: []string{strings.ToLower(hash)}})
+	if err != nil {
+		return nil, err
+	}
+	for i := range torrents {
+		if strings.EqualFold(torrents[i].Hash, hash) {
+			return &torrents[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// File is an entry from /api/v2/torrents/files.
+type File struct {
+	Index    int     `json:"index"`
+	Name     string  `json:"name"`
+	Size     int64   `json:"size"`
+	Progress float64 `json:"progress"`
+	Priority int     `json:"priority"`
+}
+
+// Files lists the files of a torrent. It is empty until metadata is known.
+func (c *Client) Files(hash string) ([]File, error) {
+	body, err := c.get("/api/v2/torrents/files", url.Values{"hash": {hash}})
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+	if err := json.Unmarshal(body, &files); err != nil {
+		return nil, fmt.Errorf("decode files: %w", err)
+	}
+	return files, nil
+}
+
+// IsMetadataPending reports whether qBittorrent is still fetching metadata.
+func (t Torrent) IsMetadataPending() bool {
+	return t.State == "metaDL" || t.State == "forcedMetaDL"
+}
+
+// IsChecking reports whether qBittorrent is checking the torrent's data or
+// loading its resume data.
+func (t Torrent) IsChecking() bool {
+	switch t.State {
+	case "checkingUP", "checkingDL", "checkingResumeData":
+		return true
+	}
+	return false
+}
+
+// IsErrored reports whether the torrent is in an error state.
+func (t Torrent) IsErrored() bool {
+	return t.State == "error" || t.State == "missingFiles"
+}
+
+// IsStopped reports whether the torrent is stopped (paused).
+func (t Torrent) IsStopped() bool {
+	switch t.State {
+	case "pausedDL", "pausedUP", "stoppedDL", "stoppedUP":
+		return true
+	}
+	return false
+}
+
+// IsComplete reports whether all wanted pieces have been downloaded.
+func (t Torrent) IsComplete() bool {
+	if t.Progress >= 1 {
+		return true
+	}
+	switch t.State {
+	case "uploading", "stalledUP", "pausedUP", "stoppedUP", "queuedUP", "forcedUP", "checkingUP":
+		return true
+	}
+	return false
+}
+
+// ExportTorrent returns the .torrent file of a torrent whose metadata is known.
+func (c *Client) ExportTorrent(hash string) ([]byte, error) {
+	caps, err := c.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	if err := caps.Require(FeatureExport); err != nil {
+		return nil, err
+	}
+	return c.get("/api/v2/torrents/export", url.Values{"hash": {hash}})
+}
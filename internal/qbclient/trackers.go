@@ -0,0 +1,41 @@
+package qbclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Tracker is an entry from /api/v2/torrents/trackers. The DHT, PeX and LSD
+// pseudo-trackers are listed too, with URLs like "** [DHT] **".
+type Tracker struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Msg    string `json:"msg"`
+}
+
+// Trackers lists the trackers of the torrent identified by hash.
+func (c *Client) Trackers(hash string) ([]Tracker, error) {
+	body, err := c.get("/api/v2/torrents/trackers", url.Values{"hash": {hash}})
+	if err != nil {
+		return nil, err
+	}
+
+	var trackers []Tracker
+	if err := json.Unmarshal(body, &trackers); err != nil {
+		return nil, fmt.Errorf("decode trackers: %w", err)
+	}
+	return trackers, nil
+}
+
+// AddTrackers appends tracker URLs to an existing torrent. qBittorrent ignores
+// URLs the torrent already has.
+func (c *Client) AddTrackers(hash string, urls []string) error {
+	if len(urls) == 0 {
+		return errors.New("no trackers given")
+	}
+	_, err := c.postForm("/api/v2/torrents/addTrackers", url.Values{"hash": {hash}, "urls": {strings.Join(urls, "\n")}})
+	return err
+}
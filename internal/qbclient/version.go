@@ -0,0 +1,126 @@
+package qbclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a dotted major.minor.patch version.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// ParseVersion accepts forms such as "2.9.3", "v4.6.2" and "v5.0.0beta1".
+func ParseVersion(s string) (Version, error) {
+	raw := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	parts := strings.SplitN(s, ".", 3)
+	nums := [3]int{}
+	for i, p := range parts {
+		end := 0
+		for end < len(p) && p[end] >= '0' && p[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			return Version{}, fmt.Errorf("invalid version %q", raw)
+		}
+		n, err := strconv.Atoi(p[:end])
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q", raw)
+		}
+		nums[i] = n
+	}
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v >= o.
+func (v Version) AtLeast(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major > o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor > o.Minor
+	}
+	return v.Patch >= o.Patch
+}
+
+// Feature is a Web API capability introduced in a given API version.
+type Feature struct {
+	Name string
+	// Since is the first Web API version providing the feature; Release is
+	// the matching qBittorrent release, for error messages.
+	Since   Version
+	Release string
+}
+
+// Known features the client adapts to.
+var (
+	FeatureTags          = Feature{Name: "tags", Since: Version{2, 3, 0}, Release: "4.2.0"}
+	FeatureContentLayout = Feature{Name: "contentLayout", Since: Version{2, 7, 0}, Release: "4.3.2"}
+	FeatureExport        = Feature{Name: "torrent export", Since: Version{2, 8, 14}, Release: "4.5.0"}
+	// FeatureStopStart covers the torrents/stop and torrents/start endpoints
+	// and the "stopped" add field that replaced pause/resume/"paused".
+	FeatureStopStart = Feature{Name: "stop/start", Since: Version{2, 11, 0}, Release: "5.0.0"}
+)
+
+// Capabilities describes the connected server.
+type Capabilities struct {
+	AppVersion    string
+	WebAPIVersion Version
+}
+
+// Supports reports whether the server provides f.
+func (c *Capabilities) Supports(f Feature) bool {
+	return c.WebAPIVersion.AtLeast(f.Since)
+}
+
+// Require returns a descriptive error when the server lacks f.
+func (c *Capabilities) Require(f Feature) error {
+	if c.Supports(f) {
+		return nil
+	}
+	return &UnsupportedError{Feature: f, Server: *c}
+}
+
+// UnsupportedError reports a feature the connected server is too old for.
+type UnsupportedError struct {
+	Feature Feature
+	Server  Capabilities
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s needs qBittorrent %s (Web API %s) or newer; server runs %s (Web API %s)",
+		e.Feature.Name, e.Feature.Release, e.Feature.Since, e.Server.AppVersion, e.Server.WebAPIVersion)
+}
+
+// Capabilities queries the application and Web API versions once per client
+// and caches the result.
+func (c *Client) Capabilities() (*Capabilities, error) {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	if c.caps != nil {
+		return c.caps, nil
+	}
+
+	app, err := c.get("/api/v2/app/version", nil)
+	if err != nil {
+		return nil, fmt.Errorf("query app version: %w", err)
+	}
+	api, err := c.get("/api/v2/app/webapiVersion", nil)
+	if err != nil {
+		return nil, fmt.Errorf("query web API version: %w", err)
+	}
+	webAPI, err := ParseVersion(string(api))
+	if err != nil {
+		return nil, err
+	}
+
+	c.caps = &Capabilities{AppVersion: strings.TrimSpace(string(app)), WebAPIVersion: webAPI}
+	c.logf("server qBittorrent %s, Web API %s", c.caps.AppVersion, c.caps.WebAPIVersion)
+	return c.caps, nil
+}